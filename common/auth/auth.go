@@ -0,0 +1,142 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/tengkuroman/microshop/common/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Roles granted by user service
+const (
+	RoleUser   = "user"
+	RoleSeller = "seller"
+	RoleAdmin  = "admin"
+)
+
+// Context keys set by RequireAuth
+const (
+	userIDKey = "user_id"
+	rolesKey  = "roles"
+)
+
+// OwnerFunc returns ID of the user owning the resource requested
+type OwnerFunc func(c *gin.Context) (uint, error)
+
+// Authenticator returns the logged in user of the request and the roles they hold
+type Authenticator func(c *gin.Context) (uint, []string, error)
+
+// Services verify the access token, user service itself sets one checking its own database
+var authenticate Authenticator = tokenUser
+
+// SetAuthenticator replaces how the logged in user is found, call it before serving requests
+func SetAuthenticator(authenticator Authenticator) {
+	authenticate = authenticator
+}
+
+// RequireAuth rejects requests without a logged in user (401)
+func RequireAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if authenticated(c) {
+			c.Next()
+		}
+	}
+}
+
+// RequireRole rejects logged in users holding none of the roles (403)
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !authenticated(c) {
+			return
+		}
+
+		for _, role := range roles {
+			if HasRole(c, role) {
+				c.Next()
+				return
+			}
+		}
+
+		response := utils.ResponseAPI(fmt.Sprintf("Only %s can access this!", strings.Join(roles, " or ")), http.StatusForbidden, "forbidden", nil)
+		c.AbortWithStatusJSON(http.StatusForbidden, response)
+	}
+}
+
+// RequireOwner rejects logged in users not owning the resource (403), unless they hold one of bypassRoles
+func RequireOwner(owner OwnerFunc, bypassRoles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !authenticated(c) {
+			return
+		}
+
+		for _, role := range bypassRoles {
+			if HasRole(c, role) {
+				c.Next()
+				return
+			}
+		}
+
+		ownerID, err := owner(c)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			response := utils.ResponseAPI("Not found!", http.StatusNotFound, "error", nil)
+			c.AbortWithStatusJSON(http.StatusNotFound, response)
+			return
+		}
+
+		if err != nil {
+			response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, response)
+			return
+		}
+
+		if ownerID != UserID(c) {
+			response := utils.ResponseAPI("You can only access your own resource!", http.StatusForbidden, "forbidden", nil)
+			c.AbortWithStatusJSON(http.StatusForbidden, response)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// Set user ID and roles of the logged in user once, false if request was aborted
+func authenticated(c *gin.Context) bool {
+	if _, ok := c.Get(userIDKey); ok {
+		return true
+	}
+
+	userID, roles, err := authenticate(c)
+	if err != nil || userID == 0 {
+		response := utils.ResponseAPI("Login required!", http.StatusUnauthorized, "unauthorized", nil)
+		c.AbortWithStatusJSON(http.StatusUnauthorized, response)
+		return false
+	}
+
+	c.Set(userIDKey, userID)
+	c.Set(rolesKey, roles)
+
+	return true
+}
+
+// UserID of the logged in user, 0 when RequireAuth didn't run
+func UserID(c *gin.Context) uint {
+	userID, _ := c.Get(userIDKey)
+	id, _ := userID.(uint)
+
+	return id
+}
+
+func HasRole(c *gin.Context, role string) bool {
+	for _, held := range c.GetStringSlice(rolesKey) {
+		if held == role {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,170 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+)
+
+// Connection to user service config (JWKS)
+var (
+	userHost    = os.Getenv("USER_HOST")
+	userPort    = os.Getenv("USER_PORT")
+	userBaseURL = fmt.Sprintf("%s:%s", userHost, userPort)
+)
+
+// Issuer of access tokens
+const tokenIssuer = "user-service"
+
+// Unknown key IDs refetch JWKS at most this often, so forged tokens can't flood user service
+const jwksRefetchInterval = 30 * time.Second
+
+var (
+	errTokenInvalid = errors.New("Token invalid!")
+	errKeyNotFound  = errors.New("Signing key not found!")
+)
+
+// Public keys of user service, fetched again when a token is signed by an unknown (rotated) key
+var jwks = struct {
+	sync.Mutex
+	keys      map[string]ed25519.PublicKey
+	fetchedAt time.Time
+}{}
+
+type jwkSet struct {
+	Keys []struct {
+		Kty string `json:"kty"`
+		Crv string `json:"crv"`
+		X   string `json:"x"`
+		Kid string `json:"kid"`
+	} `json:"keys"`
+}
+
+func fetchJWKS() (map[string]ed25519.PublicKey, error) {
+	client := http.Client{Timeout: 5 * time.Second}
+	res, err := client.Get("http://" + userBaseURL + "/.well-known/jwks.json")
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Get JWKS failed: %s", res.Status)
+	}
+
+	var set jwkSet
+	if err := json.NewDecoder(res.Body).Decode(&set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]ed25519.PublicKey)
+	for _, key := range set.Keys {
+		if key.Kty != "OKP" || key.Crv != "Ed25519" {
+			continue
+		}
+
+		x, err := base64.RawURLEncoding.DecodeString(key.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			continue
+		}
+
+		keys[key.Kid] = ed25519.PublicKey(x)
+	}
+
+	return keys, nil
+}
+
+func publicKey(kid string) (ed25519.PublicKey, error) {
+	jwks.Lock()
+	defer jwks.Unlock()
+
+	if key, ok := jwks.keys[kid]; ok {
+		return key, nil
+	}
+
+	if time.Since(jwks.fetchedAt) < jwksRefetchInterval {
+		return nil, errKeyNotFound
+	}
+
+	keys, err := fetchJWKS()
+	if err != nil {
+		return nil, err
+	}
+
+	jwks.keys = keys
+	jwks.fetchedAt = time.Now()
+
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+
+	return nil, errKeyNotFound
+}
+
+// Verify the bearer token with user service public keys and return its claims
+func tokenClaims(c *gin.Context) (jwt.MapClaims, error) {
+	bearerToken := strings.Split(c.Request.Header.Get("Authorization"), " ")
+	if len(bearerToken) != 2 {
+		return nil, errTokenInvalid
+	}
+
+	token, err := jwt.Parse(bearerToken[1], func(token *jwt.Token) (interface{}, error) {
+		if token.Method != jwt.SigningMethodEdDSA {
+			return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
+		}
+
+		kid, _ := token.Header["kid"].(string)
+		return publicKey(kid)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid || !claims.VerifyIssuer(tokenIssuer, true) {
+		return nil, errTokenInvalid
+	}
+
+	return claims, nil
+}
+
+func tokenRoles(claims map[string]interface{}) []string {
+	claimRoles, _ := claims["roles"].([]interface{})
+
+	var roles []string
+	for _, role := range claimRoles {
+		if role, ok := role.(string); ok {
+			roles = append(roles, role)
+		}
+	}
+
+	return roles
+}
+
+// Default authenticator, finds the logged in user and their roles in the access token. Tokens are short lived,
+// logged out sessions and suspended users are rejected by the API gateway.
+func tokenUser(c *gin.Context) (uint, []string, error) {
+	claims, err := tokenClaims(c)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	userID, err := strconv.ParseUint(fmt.Sprint(claims["user_id"]), 10, 32)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return uint(userID), tokenRoles(claims), nil
+}
@@ -0,0 +1,94 @@
+package idempotency
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/tengkuroman/microshop/common/auth"
+	"github.com/tengkuroman/microshop/common/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Keep a copy of the response body written by the handler
+type bodyRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *bodyRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *bodyRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Idempotent requires Idempotency-Key header and replays the first response for requests
+// retried with the same key, so the handler runs at most once per key.
+func Idempotent() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.Request.Header.Get("Idempotency-Key")
+		if key == "" {
+			response := utils.ResponseAPI("Idempotency-Key header required!", http.StatusBadRequest, "error", nil)
+			c.AbortWithStatusJSON(http.StatusBadRequest, response)
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			response := utils.ResponseAPI(err.Error(), http.StatusBadRequest, "error", nil)
+			c.AbortWithStatusJSON(http.StatusBadRequest, response)
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		// Same key can only be reused for the same request
+		hash := sha256.Sum256(append([]byte(c.Request.Method+" "+c.Request.URL.Path+"\n"), body...))
+		requestHash := hex.EncodeToString(hash[:])
+		scope := c.FullPath() + ":" + strconv.FormatUint(uint64(auth.UserID(c)), 10)
+
+		db := c.MustGet("db").(*gorm.DB)
+		record, replay, err := beginRequest(db, key, scope, requestHash)
+
+		switch {
+		case errors.Is(err, ErrKeyInUse):
+			response := utils.ResponseAPI(err.Error(), http.StatusConflict, "error", nil)
+			c.AbortWithStatusJSON(http.StatusConflict, response)
+			return
+		case errors.Is(err, ErrKeyMismatch):
+			response := utils.ResponseAPI(err.Error(), http.StatusUnprocessableEntity, "error", nil)
+			c.AbortWithStatusJSON(http.StatusUnprocessableEntity, response)
+			return
+		case err != nil:
+			response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, response)
+			return
+		}
+
+		if replay {
+			c.Header("Idempotent-Replayed", "true")
+			c.Data(record.ResponseCode, "application/json; charset=utf-8", []byte(record.ResponseBody))
+			c.Abort()
+			return
+		}
+
+		recorder := &bodyRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+
+		c.Next()
+
+		if err := record.complete(db, recorder.Status(), recorder.body.Bytes()); err != nil {
+			log.Printf("Store response of Idempotency-Key %s failed: %v\n", key, err)
+		}
+	}
+}
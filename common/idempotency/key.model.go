@@ -0,0 +1,106 @@
+package idempotency
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Idempotency key status
+const (
+	keyProcessing = "processing"
+	keyCompleted  = "completed"
+)
+
+// Processing key older than this is considered abandoned (e.g. service crashed) and can be taken over
+const lockTimeout = 5 * time.Minute
+
+var (
+	ErrKeyInUse    = errors.New("A request with this Idempotency-Key is in progress!")
+	ErrKeyMismatch = errors.New("Idempotency-Key already used for a different request!")
+)
+
+// First response of a request, replayed for retries with the same key
+type Key struct {
+	gorm.Model
+	Key          string `gorm:"not null;uniqueIndex:idx_idempotency_key_scope"`
+	Scope        string `gorm:"not null;uniqueIndex:idx_idempotency_key_scope"` // endpoint and user
+	RequestHash  string
+	Status       string
+	ResponseCode int
+	ResponseBody string
+}
+
+// Table of the keys stored before the middleware was shared
+func (Key) TableName() string {
+	return "idempotency_keys"
+}
+
+// Check and set the key in one transaction. Returns the stored key and true if its response should be replayed,
+// otherwise the key is now held by the caller until complete.
+func beginRequest(db *gorm.DB, key string, scope string, requestHash string) (Key, bool, error) {
+	var record Key
+	replay := false
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("key = ? AND scope = ?", key, scope).First(&record).Error
+
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			record = Key{
+				Key:         key,
+				Scope:       scope,
+				RequestHash: requestHash,
+				Status:      keyProcessing,
+			}
+
+			result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&record)
+			if result.Error != nil {
+				return result.Error
+			}
+
+			// Inserted by a concurrent request
+			if result.RowsAffected == 0 {
+				return ErrKeyInUse
+			}
+
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if record.RequestHash != requestHash {
+			return ErrKeyMismatch
+		}
+
+		if record.Status == keyCompleted {
+			replay = true
+			return nil
+		}
+
+		if time.Since(record.UpdatedAt) < lockTimeout {
+			return ErrKeyInUse
+		}
+
+		// Take over abandoned request
+		return tx.Model(&record).Update("updated_at", time.Now()).Error
+	})
+
+	return record, replay, err
+}
+
+// Store the response of the request. Server errors are not stored so the request can be retried.
+func (k *Key) complete(db *gorm.DB, code int, body []byte) error {
+	if code >= 500 {
+		return db.Unscoped().Delete(k).Error
+	}
+
+	return db.Model(k).Updates(Key{
+		Status:       keyCompleted,
+		ResponseCode: code,
+		ResponseBody: string(body),
+	}).Error
+}
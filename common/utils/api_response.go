@@ -0,0 +1,28 @@
+package utils
+
+// Response of the middlewares, the same shape as the responses of the services
+type Response struct {
+	Meta Meta        `json:"meta"`
+	Data interface{} `json:"data"`
+}
+
+type Meta struct {
+	Message string `json:"message"`
+	Code    int    `json:"code"`
+	Status  string `json:"status"`
+}
+
+func ResponseAPI(message string, code int, status string, data interface{}) Response {
+	meta := Meta{
+		Message: message,
+		Code:    code,
+		Status:  status,
+	}
+
+	response := Response{
+		Meta: meta,
+		Data: data,
+	}
+
+	return response
+}
@@ -59,21 +59,21 @@ const docTemplate = `{
                 }
             }
         },
-        "/auth/order/v1/order/payment/checkout/{order_detail_id}": {
-            "patch": {
+        "/auth/order/v1/order/history/{order_detail_id}": {
+            "get": {
                 "security": [
                     {
                         "BearerToken": []
                     }
                 ],
-                "description": "Pay the selected order. A user can only pay their own order.",
+                "description": "Get every status change of an order and its sub-orders. Available to the buyer, sellers of the order items (only their own sub-order) and admin.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
                     "Order Service"
                 ],
-                "summary": "Pay the order.",
+                "summary": "Get order status history.",
                 "parameters": [
                     {
                         "type": "integer",
@@ -94,21 +94,21 @@ const docTemplate = `{
                 }
             }
         },
-        "/auth/order/v1/order/payment/{order_detail_id}/{payment_provider_id}": {
+        "/auth/order/v1/order/payment/checkout/{order_detail_id}": {
             "patch": {
                 "security": [
                     {
                         "BearerToken": []
                     }
                 ],
-                "description": "Select payment merchant after checkout (order created). A user can only pay their own order.",
+                "description": "Pay the selected order. A user can only pay their own order. Retry with the same Idempotency-Key to get the first response instead of paying twice. Order not paid within UNPAID_ORDER_MINUTE_LIFESPAN (a day by default) is cancelled.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
                     "Order Service"
                 ],
-                "summary": "Select payment provider.",
+                "summary": "Pay the order.",
                 "parameters": [
                     {
                         "type": "integer",
@@ -118,10 +118,10 @@ const docTemplate = `{
                         "required": true
                     },
                     {
-                        "type": "integer",
-                        "description": "Param required.",
-                        "name": "payment_provider_id",
-                        "in": "path",
+                        "type": "string",
+                        "description": "Unique key per payment attempt, e.g. UUID.",
+                        "name": "Idempotency-Key",
+                        "in": "header",
                         "required": true
                     }
                 ],
@@ -136,21 +136,37 @@ const docTemplate = `{
                 }
             }
         },
-        "/auth/order/v1/orders": {
-            "get": {
+        "/auth/order/v1/order/payment/{order_detail_id}/{payment_provider_id}": {
+            "patch": {
                 "security": [
                     {
                         "BearerToken": []
                     }
                 ],
-                "description": "Get all user's order. Order retrieved only that made by logged user.",
+                "description": "Select payment merchant after checkout (order created). A user can only pay their own order.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
                     "Order Service"
                 ],
-                "summary": "Get all user's order.",
+                "summary": "Select payment provider.",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Param required.",
+                        "name": "order_detail_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Param required.",
+                        "name": "payment_provider_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
                 "responses": {
                     "200": {
                         "description": "OK",
@@ -162,30 +178,43 @@ const docTemplate = `{
                 }
             }
         },
-        "/auth/payment/v1/payment": {
-            "post": {
+        "/auth/order/v1/order/status/{order_detail_id}/{status}": {
+            "patch": {
                 "security": [
                     {
                         "BearerToken": []
                     }
                 ],
-                "description": "Post payment provider. Only admin can post it. Switch your role if you are not admin.",
+                "description": "Move order to the next status. Buyer and admin can cancel unpaid order. Processing, shipping and delivery are done per sub-order and rolled up to the order. Refunds are done through payment service. Deprecated: processing, shipped and delivered still move every sub-order of the order the user can move, use the sub-order status instead.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Payment Service"
+                    "Order Service"
                 ],
-                "summary": "Post payment provider (role: admin)",
+                "summary": "Change order status.",
                 "parameters": [
                     {
-                        "description": "Body required.",
+                        "description": "Optional note.",
                         "name": "body",
                         "in": "body",
-                        "required": true,
                         "schema": {
-                            "$ref": "#/definitions/models.PaymentProviderInput"
+                            "$ref": "#/definitions/models.OrderStatusInput"
                         }
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Param required.",
+                        "name": "order_detail_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Available status: cancelled (processing, shipped, delivered deprecated)",
+                        "name": "status",
+                        "in": "path",
+                        "required": true
                     }
                 ],
                 "responses": {
@@ -199,26 +228,26 @@ const docTemplate = `{
                 }
             }
         },
-        "/auth/payment/v1/payment/{payment_provider_id}": {
-            "delete": {
+        "/auth/order/v1/order/sub/payout/{sub_order_id}": {
+            "patch": {
                 "security": [
                     {
                         "BearerToken": []
                     }
                 ],
-                "description": "Delete payment provider. Only admin can delete it. Switch your role if you are not admin.",
+                "description": "Record that the subtotal of a delivered sub-order was paid out to its seller.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Payment Service"
+                    "Order Service"
                 ],
-                "summary": "Delete payment provider (role: admin)",
+                "summary": "Record sub-order payout (role: admin)",
                 "parameters": [
                     {
                         "type": "integer",
                         "description": "Param required.",
-                        "name": "payment_provider_id",
+                        "name": "sub_order_id",
                         "in": "path",
                         "required": true
                     }
@@ -232,35 +261,43 @@ const docTemplate = `{
                         }
                     }
                 }
-            },
+            }
+        },
+        "/auth/order/v1/order/sub/status/{sub_order_id}/{status}": {
             "patch": {
                 "security": [
                     {
                         "BearerToken": []
                     }
                 ],
-                "description": "Update payment provider. Only admin update it. Switch your role if you are not admin.",
+                "description": "Move the sub-order of a seller to the next status. Seller can process and ship (with courier and tracking number), buyer can confirm delivery, admin can do both. The order follows its least fulfilled sub-order, delivery makes the seller payout due.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Payment Service"
+                    "Order Service"
                 ],
-                "summary": "Update payment provider (role: admin)",
+                "summary": "Change sub-order status.",
                 "parameters": [
                     {
-                        "description": "Body required.",
+                        "description": "Optional note, courier and tracking number when shipped.",
                         "name": "body",
                         "in": "body",
-                        "required": true,
                         "schema": {
-                            "$ref": "#/definitions/models.PaymentProviderInput"
+                            "$ref": "#/definitions/models.SubOrderStatusInput"
                         }
                     },
                     {
                         "type": "integer",
                         "description": "Param required.",
-                        "name": "payment_provider_id",
+                        "name": "sub_order_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Available status: processing, shipped, delivered",
+                        "name": "status",
                         "in": "path",
                         "required": true
                     }
@@ -276,32 +313,47 @@ const docTemplate = `{
                 }
             }
         },
-        "/auth/product/v1/category": {
-            "post": {
+        "/auth/order/v1/orders": {
+            "get": {
                 "security": [
                     {
                         "BearerToken": []
                     }
                 ],
-                "description": "Post product category. Only admin can post category. Switch your role if you are not admin.",
+                "description": "Get all user's order. Order retrieved only that made by logged user. Each order has a sub-order per seller, shipped separately.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Product Service"
+                    "Order Service"
                 ],
-                "summary": "Post category (role: admin)",
-                "parameters": [
-                    {
-                        "description": "Body required.",
-                        "name": "body",
-                        "in": "body",
-                        "required": true,
+                "summary": "Get all user's order.",
+                "responses": {
+                    "200": {
+                        "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/models.CategoryInput"
+                            "type": "object",
+                            "additionalProperties": true
                         }
                     }
+                }
+            }
+        },
+        "/auth/order/v1/orders/seller": {
+            "get": {
+                "security": [
+                    {
+                        "BearerToken": []
+                    }
+                ],
+                "description": "Get sub-orders of logged in seller with their items, status, shipping and payout, and where to ship them. Other sellers' portions of the orders are not returned.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Order Service"
                 ],
+                "summary": "Get orders to fulfil (role: seller)",
                 "responses": {
                     "200": {
                         "description": "OK",
@@ -313,28 +365,30 @@ const docTemplate = `{
                 }
             }
         },
-        "/auth/product/v1/category/{category_id}": {
-            "delete": {
+        "/auth/payment/v1/payment": {
+            "post": {
                 "security": [
                     {
                         "BearerToken": []
                     }
                 ],
-                "description": "Delete product category. Only admin can delete category. Switch your role if you are not admin.",
+                "description": "Post payment provider. Only admin can post it. Driver processing its payments is required.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Product Service"
+                    "Payment Service"
                 ],
-                "summary": "Delete product category (role: admin)",
+                "summary": "Post payment provider (role: admin)",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "Param required.",
-                        "name": "category_id",
-                        "in": "path",
-                        "required": true
+                        "description": "Body required.",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.PaymentProviderInput"
+                        }
                     }
                 ],
                 "responses": {
@@ -346,35 +400,28 @@ const docTemplate = `{
                         }
                     }
                 }
-            },
-            "patch": {
+            }
+        },
+        "/auth/payment/v1/payment/refund/{payment_id}": {
+            "get": {
                 "security": [
                     {
                         "BearerToken": []
                     }
                 ],
-                "description": "Update product category by category_id. Only admin can update category. Switch your role if you are not admin.",
+                "description": "Get refunds of a payment. Seller can only see refunds of orders containing their products.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Product Service"
+                    "Payment Service"
                 ],
-                "summary": "Update product category (role: admin)",
+                "summary": "Get refunds of a payment (role: admin, seller)",
                 "parameters": [
-                    {
-                        "description": "Body required.",
-                        "name": "body",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/models.CategoryInput"
-                        }
-                    },
                     {
                         "type": "integer",
                         "description": "Param required.",
-                        "name": "category_id",
+                        "name": "payment_id",
                         "in": "path",
                         "required": true
                     }
@@ -388,23 +435,21 @@ const docTemplate = `{
                         }
                     }
                 }
-            }
-        },
-        "/auth/product/v1/product": {
+            },
             "post": {
                 "security": [
                     {
                         "BearerToken": []
                     }
                 ],
-                "description": "Post product to marketplace. Switch your role if you are not seller.",
+                "description": "Refund a payment fully (amount 0 or omitted) or partially. Admin can refund any payment, seller only up to their items in the order. A refund of a seller's items is taken off their payout, admin chooses the seller (seller_id) for a partial refund of an order with several sellers.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Product Service"
+                    "Payment Service"
                 ],
-                "summary": "Post product (role: seller)",
+                "summary": "Refund a payment (role: admin, seller)",
                 "parameters": [
                     {
                         "description": "Body required.",
@@ -412,8 +457,15 @@ const docTemplate = `{
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/models.ProductInput"
+                            "$ref": "#/definitions/models.RefundInput"
                         }
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Param required.",
+                        "name": "payment_id",
+                        "in": "path",
+                        "required": true
                     }
                 ],
                 "responses": {
@@ -427,26 +479,26 @@ const docTemplate = `{
                 }
             }
         },
-        "/auth/product/v1/product/{product_id}": {
+        "/auth/payment/v1/payment/{payment_provider_id}": {
             "delete": {
                 "security": [
                     {
                         "BearerToken": []
                     }
                 ],
-                "description": "Delete posted product by product_id. Seller can only delete their own products. Switch your role if you are not seller.",
+                "description": "Delete payment provider. Only admin can delete it.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Product Service"
+                    "Payment Service"
                 ],
-                "summary": "Delete product (role: seller)",
+                "summary": "Delete payment provider (role: admin)",
                 "parameters": [
                     {
                         "type": "integer",
                         "description": "Param required.",
-                        "name": "product_id",
+                        "name": "payment_provider_id",
                         "in": "path",
                         "required": true
                     }
@@ -467,14 +519,14 @@ const docTemplate = `{
                         "BearerToken": []
                     }
                 ],
-                "description": "Update posted product by product_id. Seller can only update their own products. Switch your role if you are not seller.",
+                "description": "Update payment provider. Only admin update it.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Product Service"
+                    "Payment Service"
                 ],
-                "summary": "Update product (role: seller)",
+                "summary": "Update payment provider (role: admin)",
                 "parameters": [
                     {
                         "description": "Body required.",
@@ -482,13 +534,13 @@ const docTemplate = `{
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/models.ProductInput"
+                            "$ref": "#/definitions/models.PaymentProviderInput"
                         }
                     },
                     {
                         "type": "integer",
                         "description": "Param required.",
-                        "name": "product_id",
+                        "name": "payment_provider_id",
                         "in": "path",
                         "required": true
                     }
@@ -504,53 +556,29 @@ const docTemplate = `{
                 }
             }
         },
-        "/auth/shopping/v1/cart": {
-            "get": {
-                "security": [
-                    {
-                        "BearerToken": []
-                    }
-                ],
-                "description": "Get all products from cart. Data retrieved based on logged in user.",
-                "produces": [
-                    "application/json"
-                ],
-                "tags": [
-                    "Shopping Service"
-                ],
-                "summary": "Get all products from cart.",
-                "responses": {
-                    "200": {
-                        "description": "OK",
-                        "schema": {
-                            "type": "object",
-                            "additionalProperties": true
-                        }
-                    }
-                }
-            },
+        "/auth/product/v1/category": {
             "post": {
                 "security": [
                     {
                         "BearerToken": []
                     }
                 ],
-                "description": "Add a product to cart.",
+                "description": "Post product category. Only admin can post category.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Shopping Service"
+                    "Product Service"
                 ],
-                "summary": "Add a product to cart.",
+                "summary": "Post category (role: admin)",
                 "parameters": [
                     {
-                        "description": "Body to add product to the cart.",
+                        "description": "Body required.",
                         "name": "body",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/models.CartItemInput"
+                            "$ref": "#/definitions/models.CategoryInput"
                         }
                     }
                 ],
@@ -563,21 +591,32 @@ const docTemplate = `{
                         }
                     }
                 }
-            },
+            }
+        },
+        "/auth/product/v1/category/{category_id}": {
             "delete": {
                 "security": [
                     {
                         "BearerToken": []
                     }
                 ],
-                "description": "Delete shopping session and all items in cart for current logged in user.",
+                "description": "Delete product category. Only admin can delete category.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Shopping Service"
+                    "Product Service"
+                ],
+                "summary": "Delete product category (role: admin)",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Param required.",
+                        "name": "category_id",
+                        "in": "path",
+                        "required": true
+                    }
                 ],
-                "summary": "Drop shopping cart.",
                 "responses": {
                     "200": {
                         "description": "OK",
@@ -594,23 +633,30 @@ const docTemplate = `{
                         "BearerToken": []
                     }
                 ],
-                "description": "Update a product quantity in cart.",
+                "description": "Update product category by category_id. Only admin can update category.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Shopping Service"
+                    "Product Service"
                 ],
-                "summary": "Update a product quantity in cart.",
+                "summary": "Update product category (role: admin)",
                 "parameters": [
                     {
-                        "description": "Body to update product quantity in the cart.",
+                        "description": "Body required.",
                         "name": "body",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/models.CartItemInput"
+                            "$ref": "#/definitions/models.CategoryInput"
                         }
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Param required.",
+                        "name": "category_id",
+                        "in": "path",
+                        "required": true
                     }
                 ],
                 "responses": {
@@ -624,23 +670,34 @@ const docTemplate = `{
                 }
             }
         },
-        "/auth/shopping/v1/cart/checkout": {
-            "get": {
+        "/auth/product/v1/product": {
+            "post": {
                 "security": [
                     {
                         "BearerToken": []
                     }
                 ],
-                "description": "Bring all the items in cart to order.",
+                "description": "Post product to marketplace. Apply as seller if you are not seller.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Shopping Service"
+                    "Product Service"
                 ],
-                "summary": "Checkout shopping cart.",
-                "responses": {
-                    "200": {
+                "summary": "Post product (role: seller)",
+                "parameters": [
+                    {
+                        "description": "Body required.",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.ProductInput"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
                         "description": "OK",
                         "schema": {
                             "type": "object",
@@ -650,30 +707,70 @@ const docTemplate = `{
                 }
             }
         },
-        "/auth/user/v1/change": {
+        "/auth/product/v1/product/{product_id}": {
+            "delete": {
+                "security": [
+                    {
+                        "BearerToken": []
+                    }
+                ],
+                "description": "Delete posted product by product_id. Seller can only delete their own products. Apply as seller if you are not seller.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Product Service"
+                ],
+                "summary": "Delete product (role: seller)",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Param required.",
+                        "name": "product_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            },
             "patch": {
                 "security": [
                     {
                         "BearerToken": []
                     }
                 ],
-                "description": "Change user detail: name, email, address, phone number.",
+                "description": "Update posted product by product_id. Seller can only update their own products. Apply as seller if you are not seller.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "User Service"
+                    "Product Service"
                 ],
-                "summary": "Change user details.",
+                "summary": "Update product (role: seller)",
                 "parameters": [
                     {
-                        "description": "Body required to user detail(s).",
+                        "description": "Body required.",
                         "name": "body",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/models.ChangeUserDetailInput"
+                            "$ref": "#/definitions/models.ProductInput"
                         }
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Param required.",
+                        "name": "product_id",
+                        "in": "path",
+                        "required": true
                     }
                 ],
                 "responses": {
@@ -687,30 +784,37 @@ const docTemplate = `{
                 }
             }
         },
-        "/auth/user/v1/change/password": {
+        "/auth/product/v1/product/{product_id}/stock": {
             "patch": {
                 "security": [
                     {
                         "BearerToken": []
                     }
                 ],
-                "description": "Change user password for all roles.",
+                "description": "Set quantity on hand of posted product by product_id. Seller can only update their own products.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "User Service"
+                    "Product Service"
                 ],
-                "summary": "Change user password.",
+                "summary": "Update product stock (role: seller)",
                 "parameters": [
                     {
-                        "description": "Body required to change password.",
+                        "description": "Body required.",
                         "name": "body",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/models.ChangePasswordInput"
+                            "$ref": "#/definitions/models.ProductStockInput"
                         }
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Param required.",
+                        "name": "product_id",
+                        "in": "path",
+                        "required": true
                     }
                 ],
                 "responses": {
@@ -724,28 +828,27 @@ const docTemplate = `{
                 }
             }
         },
-        "/auth/user/v1/switch/{role}": {
-            "patch": {
+        "/auth/shopping/v1/cart": {
+            "get": {
                 "security": [
                     {
                         "BearerToken": []
                     }
                 ],
-                "description": "Change user role. Available roles: user, seller, admin.",
+                "description": "Get all products from cart with current prices, line subtotals and total. Data retrieved based on logged in user, or the cart token of a guest.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "User Service"
+                    "Shopping Service"
                 ],
-                "summary": "Switch user role.",
+                "summary": "Get all products from cart.",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Available roles: user, seller, admin",
-                        "name": "role",
-                        "in": "path",
-                        "required": true
+                        "description": "Cart token of a guest cart, required instead of logging in on guest routes.",
+                        "name": "X-Cart-Token",
+                        "in": "header"
                     }
                 ],
                 "responses": {
@@ -757,18 +860,38 @@ const docTemplate = `{
                         }
                     }
                 }
-            }
-        },
-        "/order/v1": {
-            "get": {
-                "description": "Connection health check.",
+            },
+            "put": {
+                "security": [
+                    {
+                        "BearerToken": []
+                    }
+                ],
+                "description": "Replace every product in cart with the items given, an empty list empties the cart. Returns the cart.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Order Service"
+                    "Shopping Service"
+                ],
+                "summary": "Replace cart contents.",
+                "parameters": [
+                    {
+                        "description": "Body required.",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.CartReplaceInput"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Cart token of a guest cart, required instead of logging in on guest routes.",
+                        "name": "X-Cart-Token",
+                        "in": "header"
+                    }
                 ],
-                "summary": "Health check.",
                 "responses": {
                     "200": {
                         "description": "OK",
@@ -778,18 +901,38 @@ const docTemplate = `{
                         }
                     }
                 }
-            }
-        },
-        "/payment/v1": {
-            "get": {
-                "description": "Connection health check.",
+            },
+            "post": {
+                "security": [
+                    {
+                        "BearerToken": []
+                    }
+                ],
+                "description": "Add a product to cart. Adding a product already in the cart adds to its quantity. Returns the cart.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Payment Service"
+                    "Shopping Service"
+                ],
+                "summary": "Add a product to cart.",
+                "parameters": [
+                    {
+                        "description": "Body to add product to the cart.",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.CartItemInput"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Cart token of a guest cart, required instead of logging in on guest routes.",
+                        "name": "X-Cart-Token",
+                        "in": "header"
+                    }
                 ],
-                "summary": "Health check.",
                 "responses": {
                     "200": {
                         "description": "OK",
@@ -799,18 +942,29 @@ const docTemplate = `{
                         }
                     }
                 }
-            }
-        },
-        "/payment/v1/payment": {
-            "get": {
-                "description": "Get payment providers.",
+            },
+            "delete": {
+                "security": [
+                    {
+                        "BearerToken": []
+                    }
+                ],
+                "description": "Delete shopping session and all items in cart for current logged in user, or of the guest cart.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Payment Service"
+                    "Shopping Service"
+                ],
+                "summary": "Drop shopping cart.",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Cart token of a guest cart, required instead of logging in on guest routes.",
+                        "name": "X-Cart-Token",
+                        "in": "header"
+                    }
                 ],
-                "summary": "Get payment providers.",
                 "responses": {
                     "200": {
                         "description": "OK",
@@ -820,18 +974,38 @@ const docTemplate = `{
                         }
                     }
                 }
-            }
-        },
-        "/product/v1": {
-            "get": {
-                "description": "Connection health check.",
+            },
+            "patch": {
+                "security": [
+                    {
+                        "BearerToken": []
+                    }
+                ],
+                "description": "Update a product quantity in cart, quantity 0 removes the product. Returns the cart.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Product Service"
+                    "Shopping Service"
+                ],
+                "summary": "Update a product quantity in cart.",
+                "parameters": [
+                    {
+                        "description": "Body to update product quantity in the cart.",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.CartItemUpdateInput"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Cart token of a guest cart, required instead of logging in on guest routes.",
+                        "name": "X-Cart-Token",
+                        "in": "header"
+                    }
                 ],
-                "summary": "Health check.",
                 "responses": {
                     "200": {
                         "description": "OK",
@@ -843,16 +1017,29 @@ const docTemplate = `{
                 }
             }
         },
-        "/product/v1/categories": {
+        "/auth/shopping/v1/cart/checkout": {
             "get": {
-                "description": "Get all product categories, including unsigned to product categories.",
+                "security": [
+                    {
+                        "BearerToken": []
+                    }
+                ],
+                "description": "Bring all the items in cart to order, shipped to the address chosen from the address book (the default one when not chosen). Users need an address in their address book, add one with POST /auth/user/v1/addresses. A pending checkout tried again ships to the address chosen this time, the one chosen before when not chosen. The cart is kept if the order is rejected. When order service fails the checkout stays pending and is finished in the background or when tried again.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Product Service"
+                    "Shopping Service"
+                ],
+                "summary": "Checkout shopping cart.",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Shipping address ID from user service address book.",
+                        "name": "address_id",
+                        "in": "query"
+                    }
                 ],
-                "summary": "Get all product categories.",
                 "responses": {
                     "200": {
                         "description": "OK",
@@ -864,23 +1051,34 @@ const docTemplate = `{
                 }
             }
         },
-        "/product/v1/category/{category_id}": {
-            "get": {
-                "description": "Get product category by category_id.",
+        "/auth/shopping/v1/cart/items/{product_id}": {
+            "delete": {
+                "security": [
+                    {
+                        "BearerToken": []
+                    }
+                ],
+                "description": "Remove the line of a product from cart. Returns the cart.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Product Service"
+                    "Shopping Service"
                 ],
-                "summary": "Get product category by ID.",
+                "summary": "Remove a product from cart.",
                 "parameters": [
                     {
-                        "type": "string",
-                        "description": "Required param.",
-                        "name": "category_id",
+                        "type": "integer",
+                        "description": "Param required.",
+                        "name": "product_id",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Cart token of a guest cart, required instead of logging in on guest routes.",
+                        "name": "X-Cart-Token",
+                        "in": "header"
                     }
                 ],
                 "responses": {
@@ -894,16 +1092,21 @@ const docTemplate = `{
                 }
             }
         },
-        "/product/v1/product/{product_id}": {
-            "get": {
-                "description": "Get specific product by product_id.",
+        "/auth/shopping/v1/cart/items/{product_id}/save": {
+            "post": {
+                "security": [
+                    {
+                        "BearerToken": []
+                    }
+                ],
+                "description": "Move the line of a product from cart to the saved for later list. Returns the cart.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Product Service"
+                    "Shopping Service"
                 ],
-                "summary": "Get product by ID.",
+                "summary": "Save a product for later.",
                 "parameters": [
                     {
                         "type": "integer",
@@ -924,16 +1127,1911 @@ const docTemplate = `{
                 }
             }
         },
-        "/product/v1/products": {
-            "get": {
-                "description": "Get all products available in marketplace.",
+        "/auth/shopping/v1/cart/merge": {
+            "post": {
+                "security": [
+                    {
+                        "BearerToken": []
+                    }
+                ],
+                "description": "Fold a guest cart into the cart of the logged in user and delete the guest cart. Products in both carts are merged by the rule (sum, max, keep_user or keep_guest), the service default when not chosen. Sum and max are capped to the product stock. Returns the cart.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Product Service"
+                    "Shopping Service"
+                ],
+                "summary": "Merge guest cart.",
+                "parameters": [
+                    {
+                        "description": "Body required.",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.CartMergeInput"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/shopping/v1/cart/saved": {
+            "get": {
+                "security": [
+                    {
+                        "BearerToken": []
+                    }
+                ],
+                "description": "Get products moved out of cart to buy later, latest first. The list is kept after checkout.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Shopping Service"
+                ],
+                "summary": "Get products saved for later.",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/shopping/v1/cart/saved/{product_id}": {
+            "delete": {
+                "security": [
+                    {
+                        "BearerToken": []
+                    }
+                ],
+                "description": "Delete a product from the saved for later list.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Shopping Service"
+                ],
+                "summary": "Delete a saved product.",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Param required.",
+                        "name": "product_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/shopping/v1/cart/saved/{product_id}/restore": {
+            "post": {
+                "security": [
+                    {
+                        "BearerToken": []
+                    }
+                ],
+                "description": "Move a product from the saved for later list back to cart with its saved quantity and the current price. Returns the cart.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Shopping Service"
+                ],
+                "summary": "Move a saved product to cart.",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Param required.",
+                        "name": "product_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/user/v1/2fa/disable": {
+            "post": {
+                "security": [
+                    {
+                        "BearerToken": []
+                    }
+                ],
+                "description": "Disable two-factor authentication with a code of the authenticator app. Not allowed for roles requiring it (admin).",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "User Service"
+                ],
+                "summary": "Disable two-factor authentication.",
+                "parameters": [
+                    {
+                        "description": "Body required.",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.TwoFactorCodeInput"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/user/v1/2fa/enable": {
+            "post": {
+                "security": [
+                    {
+                        "BearerToken": []
+                    }
+                ],
+                "description": "Enable two-factor authentication with a code of the secret set up. Returns recovery codes, they are shown only once.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "User Service"
+                ],
+                "summary": "Enable two-factor authentication.",
+                "parameters": [
+                    {
+                        "description": "Body required.",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.TwoFactorCodeInput"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/user/v1/2fa/recovery-codes": {
+            "post": {
+                "security": [
+                    {
+                        "BearerToken": []
+                    }
+                ],
+                "description": "Replace every recovery code with new ones, with a code of the authenticator app or a recovery code.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "User Service"
+                ],
+                "summary": "Regenerate recovery codes.",
+                "parameters": [
+                    {
+                        "description": "Body required.",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.TwoFactorCodeInput"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/user/v1/2fa/setup": {
+            "post": {
+                "security": [
+                    {
+                        "BearerToken": []
+                    }
+                ],
+                "description": "Generate a TOTP secret and its provisioning URI (show it as QR code) to add in an authenticator app. Two-factor authentication is on after it is enabled with a code.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "User Service"
+                ],
+                "summary": "Set up two-factor authentication.",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/user/v1/addresses": {
+            "get": {
+                "security": [
+                    {
+                        "BearerToken": []
+                    }
+                ],
+                "description": "Get shipping addresses in the address book of the logged in user, default first.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "User Service"
+                ],
+                "summary": "Get addresses.",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "BearerToken": []
+                    }
+                ],
+                "description": "Add a shipping address to the address book. The first address becomes default.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "User Service"
+                ],
+                "summary": "Add address.",
+                "parameters": [
+                    {
+                        "description": "Body required.",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.AddressInput"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/user/v1/addresses/{address_id}": {
+            "put": {
+                "security": [
+                    {
+                        "BearerToken": []
+                    }
+                ],
+                "description": "Replace a shipping address in the address book. Orders already made keep the address they were made with.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "User Service"
+                ],
+                "summary": "Update address.",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Param required.",
+                        "name": "address_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Body required.",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.AddressInput"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "BearerToken": []
+                    }
+                ],
+                "description": "Delete a shipping address from the address book. When it's the default, the latest remaining address becomes default.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "User Service"
+                ],
+                "summary": "Delete address.",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Param required.",
+                        "name": "address_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/user/v1/addresses/{address_id}/default": {
+            "patch": {
+                "security": [
+                    {
+                        "BearerToken": []
+                    }
+                ],
+                "description": "Set the address used at checkout when none is chosen.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "User Service"
+                ],
+                "summary": "Set default address.",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Param required.",
+                        "name": "address_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/user/v1/change": {
+            "patch": {
+                "security": [
+                    {
+                        "BearerToken": []
+                    }
+                ],
+                "description": "Change user detail: name, email, address, phone number. A new email is mailed a verification token and replaces the current email once verified, the current email stays verified and in use until then.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "User Service"
+                ],
+                "summary": "Change user details.",
+                "parameters": [
+                    {
+                        "description": "Body required to user detail(s).",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.ChangeUserDetailInput"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/user/v1/change/password": {
+            "patch": {
+                "security": [
+                    {
+                        "BearerToken": []
+                    }
+                ],
+                "description": "Change user password for all roles.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "User Service"
+                ],
+                "summary": "Change user password.",
+                "parameters": [
+                    {
+                        "description": "Body required to change password.",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.ChangePasswordInput"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/user/v1/roles/{user_id}": {
+            "get": {
+                "security": [
+                    {
+                        "BearerToken": []
+                    }
+                ],
+                "description": "Get roles and role audit of a user. Users can see their own, admins can see everyone's.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "User Service"
+                ],
+                "summary": "Get user roles.",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Param required.",
+                        "name": "user_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/user/v1/roles/{user_id}/{role}": {
+            "post": {
+                "security": [
+                    {
+                        "BearerToken": []
+                    }
+                ],
+                "description": "Grant role to a user. Every grant is audited.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "User Service"
+                ],
+                "summary": "Grant role to user (role: admin)",
+                "parameters": [
+                    {
+                        "description": "Optional note.",
+                        "name": "body",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/models.RoleInput"
+                        }
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Param required.",
+                        "name": "user_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Available roles: seller, admin",
+                        "name": "role",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "BearerToken": []
+                    }
+                ],
+                "description": "Revoke role from a user. User role can't be revoked and the last admin can't be revoked. Every revoke is audited, the role stays in access tokens already issued until they expire.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "User Service"
+                ],
+                "summary": "Revoke role from user (role: admin)",
+                "parameters": [
+                    {
+                        "description": "Optional note.",
+                        "name": "body",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/models.RoleInput"
+                        }
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Param required.",
+                        "name": "user_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Available roles: seller, admin",
+                        "name": "role",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/user/v1/seller/applications": {
+            "get": {
+                "security": [
+                    {
+                        "BearerToken": []
+                    }
+                ],
+                "description": "Get seller applications by status, pending by default.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "User Service"
+                ],
+                "summary": "Get seller applications (role: admin)",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Available status: pending, approved, rejected",
+                        "name": "status",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/user/v1/seller/applications/{application_id}/{decision}": {
+            "patch": {
+                "security": [
+                    {
+                        "BearerToken": []
+                    }
+                ],
+                "description": "Approve or reject a pending seller application. Approving grants seller role to the applicant.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "User Service"
+                ],
+                "summary": "Review seller application (role: admin)",
+                "parameters": [
+                    {
+                        "description": "Optional note.",
+                        "name": "body",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/models.SellerApplicationReviewInput"
+                        }
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Param required.",
+                        "name": "application_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Available decision: approve, reject",
+                        "name": "decision",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/user/v1/seller/apply": {
+            "post": {
+                "security": [
+                    {
+                        "BearerToken": []
+                    }
+                ],
+                "description": "Apply to be a seller. Seller role is granted when an admin approves the application.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "User Service"
+                ],
+                "summary": "Apply as seller.",
+                "parameters": [
+                    {
+                        "description": "Body required.",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.SellerApplicationInput"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/user/v1/users": {
+            "get": {
+                "security": [
+                    {
+                        "BearerToken": []
+                    }
+                ],
+                "description": "Get users, paginated. Search by username, email or name, filter by role, status and email verification. Deleted users are only listed with status deleted.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "User Service"
+                ],
+                "summary": "Get users (role: admin)",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Page number, default 1.",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Users per page, default 20, max 100.",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Part of username, email or name.",
+                        "name": "q",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Filter by role.",
+                        "name": "role",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Available status: active, suspended, deleted",
+                        "name": "status",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Filter by email verification.",
+                        "name": "verified",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Available sort: newest, oldest, username",
+                        "name": "sort",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/user/v1/users/{user_id}": {
+            "delete": {
+                "security": [
+                    {
+                        "BearerToken": []
+                    }
+                ],
+                "description": "Soft delete a user and log out every session. The user can be restored, username and email stay taken.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "User Service"
+                ],
+                "summary": "Delete user (role: admin)",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Param required.",
+                        "name": "user_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/user/v1/users/{user_id}/logins": {
+            "get": {
+                "security": [
+                    {
+                        "BearerToken": []
+                    }
+                ],
+                "description": "Get the latest 100 login attempts of a user, successful or not.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "User Service"
+                ],
+                "summary": "Get login audit of user (role: admin)",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Param required.",
+                        "name": "user_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/user/v1/users/{user_id}/password/reset": {
+            "post": {
+                "security": [
+                    {
+                        "BearerToken": []
+                    }
+                ],
+                "description": "Log out every session of a user and refuse login until the password is reset with the token mailed to the user.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "User Service"
+                ],
+                "summary": "Force password reset (role: admin)",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Param required.",
+                        "name": "user_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/user/v1/users/{user_id}/restore": {
+            "post": {
+                "security": [
+                    {
+                        "BearerToken": []
+                    }
+                ],
+                "description": "Restore a deleted user, the user can login again.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "User Service"
+                ],
+                "summary": "Restore user (role: admin)",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Param required.",
+                        "name": "user_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/user/v1/users/{user_id}/suspend": {
+            "post": {
+                "security": [
+                    {
+                        "BearerToken": []
+                    }
+                ],
+                "description": "Suspend a user: login is refused and every session is logged out, access tokens already issued are rejected by the API gateway.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "User Service"
+                ],
+                "summary": "Suspend user (role: admin)",
+                "parameters": [
+                    {
+                        "description": "Body required.",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.SuspendUserInput"
+                        }
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Param required.",
+                        "name": "user_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "BearerToken": []
+                    }
+                ],
+                "description": "Lift the suspension of a user, the user can login again.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "User Service"
+                ],
+                "summary": "Unsuspend user (role: admin)",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Param required.",
+                        "name": "user_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/auth/user/v1/users/{user_id}/unlock": {
+            "post": {
+                "security": [
+                    {
+                        "BearerToken": []
+                    }
+                ],
+                "description": "Unlock an account locked by too many failed logins and forget its failed logins from every IP.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "User Service"
+                ],
+                "summary": "Unlock user (role: admin)",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Param required.",
+                        "name": "user_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/order/v1": {
+            "get": {
+                "description": "Connection health check.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Order Service"
+                ],
+                "summary": "Health check.",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/payment/v1": {
+            "get": {
+                "description": "Connection health check.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Payment Service"
+                ],
+                "summary": "Health check.",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/payment/v1/payment": {
+            "get": {
+                "description": "Get payment providers.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Payment Service"
+                ],
+                "summary": "Get payment providers.",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/product/v1": {
+            "get": {
+                "description": "Connection health check.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Product Service"
+                ],
+                "summary": "Health check.",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/product/v1/categories": {
+            "get": {
+                "description": "Get all product categories, including unsigned to product categories.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Product Service"
+                ],
+                "summary": "Get all product categories.",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/product/v1/category/{category_id}": {
+            "get": {
+                "description": "Get product category by category_id.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Product Service"
+                ],
+                "summary": "Get product category by ID.",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Required param.",
+                        "name": "category_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/product/v1/product/{product_id}": {
+            "get": {
+                "description": "Get specific product by product_id.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Product Service"
+                ],
+                "summary": "Get product by ID.",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Param required.",
+                        "name": "product_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/product/v1/products": {
+            "get": {
+                "description": "Get products available in marketplace, paginated. Filter by category, seller, price range and stock, sort by price, newest or name.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Product Service"
+                ],
+                "summary": "Get all products.",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Page number, default 1.",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Products per page, default 20, max 100.",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Filter by category.",
+                        "name": "category_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Filter by seller.",
+                        "name": "seller_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Minimum price.",
+                        "name": "min_price",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Maximum price.",
+                        "name": "max_price",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Only products available to order.",
+                        "name": "in_stock",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Available sort: price, -price, newest, name, -name",
+                        "name": "sort",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/product/v1/products/category/{category_id}": {
+            "get": {
+                "description": "Get specific products by category_id, paginated. Accepts the same query params as get all products.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Product Service"
+                ],
+                "summary": "Get products from specific category.",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Param required.",
+                        "name": "category_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page number, default 1.",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Products per page, default 20, max 100.",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Available sort: price, -price, newest, name, -name",
+                        "name": "sort",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/product/v1/products/lookup": {
+            "get": {
+                "description": "Get up to 100 products by product_id in one call, e.g. to show a cart. IDs of products not found (deleted) are listed in missing_ids.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Product Service"
+                ],
+                "summary": "Get products by IDs.",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Comma separated product IDs.",
+                        "name": "ids",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/product/v1/products/search": {
+            "get": {
+                "description": "Search products by name and description, most relevant first. Words are matched by prefix and names by similarity (typo tolerant). Highlight is HTML escaped with matched terms wrapped in \u003cmark\u003e\u003c/mark\u003e. Accepts the same filters as get all products.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Product Service"
+                ],
+                "summary": "Search products.",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Search text.",
+                        "name": "q",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page number, default 1.",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Products per page, default 20, max 100.",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Filter by category.",
+                        "name": "category_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Filter by seller.",
+                        "name": "seller_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Minimum price.",
+                        "name": "min_price",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Maximum price.",
+                        "name": "max_price",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Only products available to order.",
+                        "name": "in_stock",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/product/v1/products/seller/{user_id}": {
+            "get": {
+                "description": "Get specific products by seller_id, paginated. Accepts the same query params as get all products.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Product Service"
+                ],
+                "summary": "Get products from specific seller.",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Param required.",
+                        "name": "user_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page number, default 1.",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Products per page, default 20, max 100.",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Available sort: price, -price, newest, name, -name",
+                        "name": "sort",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/shopping/v1": {
+            "get": {
+                "description": "Connection health check.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Shopping Service"
+                ],
+                "summary": "Health check.",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/shopping/v1/guest/cart": {
+            "get": {
+                "security": [
+                    {
+                        "BearerToken": []
+                    }
+                ],
+                "description": "Get all products from cart with current prices, line subtotals and total. Data retrieved based on logged in user, or the cart token of a guest.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Shopping Service"
+                ],
+                "summary": "Get all products from cart.",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Cart token of a guest cart, required instead of logging in on guest routes.",
+                        "name": "X-Cart-Token",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            },
+            "put": {
+                "security": [
+                    {
+                        "BearerToken": []
+                    }
+                ],
+                "description": "Replace every product in cart with the items given, an empty list empties the cart. Returns the cart.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Shopping Service"
+                ],
+                "summary": "Replace cart contents.",
+                "parameters": [
+                    {
+                        "description": "Body required.",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.CartReplaceInput"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Cart token of a guest cart, required instead of logging in on guest routes.",
+                        "name": "X-Cart-Token",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "BearerToken": []
+                    }
+                ],
+                "description": "Add a product to cart. Adding a product already in the cart adds to its quantity. Returns the cart.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Shopping Service"
+                ],
+                "summary": "Add a product to cart.",
+                "parameters": [
+                    {
+                        "description": "Body to add product to the cart.",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.CartItemInput"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Cart token of a guest cart, required instead of logging in on guest routes.",
+                        "name": "X-Cart-Token",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "BearerToken": []
+                    }
+                ],
+                "description": "Delete shopping session and all items in cart for current logged in user, or of the guest cart.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Shopping Service"
+                ],
+                "summary": "Drop shopping cart.",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Cart token of a guest cart, required instead of logging in on guest routes.",
+                        "name": "X-Cart-Token",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "security": [
+                    {
+                        "BearerToken": []
+                    }
+                ],
+                "description": "Update a product quantity in cart, quantity 0 removes the product. Returns the cart.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Shopping Service"
+                ],
+                "summary": "Update a product quantity in cart.",
+                "parameters": [
+                    {
+                        "description": "Body to update product quantity in the cart.",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.CartItemUpdateInput"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Cart token of a guest cart, required instead of logging in on guest routes.",
+                        "name": "X-Cart-Token",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/shopping/v1/guest/cart/items/{product_id}": {
+            "delete": {
+                "security": [
+                    {
+                        "BearerToken": []
+                    }
+                ],
+                "description": "Remove the line of a product from cart. Returns the cart.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Shopping Service"
+                ],
+                "summary": "Remove a product from cart.",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Param required.",
+                        "name": "product_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Cart token of a guest cart, required instead of logging in on guest routes.",
+                        "name": "X-Cart-Token",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/shopping/v1/guest/carts": {
+            "post": {
+                "description": "Create an empty cart for a visitor who is not logged in. Send its cart token in X-Cart-Token header to the guest cart routes, and merge it into the user cart after login. Guest cart expires when not changed for GUEST_CART_DAY_LIFESPAN days (30 by default).",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Shopping Service"
+                ],
+                "summary": "Create guest cart.",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/user/v1": {
+            "get": {
+                "description": "Connection health check.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "User Service"
+                ],
+                "summary": "Health check.",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/user/v1/login": {
+            "post": {
+                "description": "Logging in to get JWT token to access certain API by roles. Failed logins slow down further attempts of the account and IP, too many lock the account for that IP for a while. With two-factor authentication enabled it returns a challenge token to finish login at /login/2fa, roles requiring two-factor authentication (admin) are only granted to sessions logged in with it.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "User Service"
+                ],
+                "summary": "Login as as user, seller, or admin.",
+                "parameters": [
+                    {
+                        "description": "Body required to login.",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.LoginInput"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/user/v1/login/2fa": {
+            "post": {
+                "description": "Finish login of a user with two-factor authentication, with the challenge token from login and a code of the authenticator app or a recovery code.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "User Service"
+                ],
+                "summary": "Login second step.",
+                "parameters": [
+                    {
+                        "description": "Body required.",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.LoginTwoFactorInput"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/user/v1/logout": {
+            "post": {
+                "description": "Logout the session of the refresh token. The refresh token can't be used anymore, access tokens already issued are rejected by the API gateway.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "User Service"
+                ],
+                "summary": "Logout.",
+                "parameters": [
+                    {
+                        "description": "Body required.",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.RefreshTokenInput"
+                        }
+                    }
                 ],
-                "summary": "Get all products.",
                 "responses": {
                     "200": {
                         "description": "OK",
@@ -945,23 +3043,25 @@ const docTemplate = `{
                 }
             }
         },
-        "/product/v1/products/category/{category_id}": {
-            "get": {
-                "description": "Get specific products by category_id.",
+        "/user/v1/password/forgot": {
+            "post": {
+                "description": "Mail a password reset token. Always succeeds so registered emails can't be guessed.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Product Service"
+                    "User Service"
                 ],
-                "summary": "Get products from specific category.",
+                "summary": "Forgot password.",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "Param required.",
-                        "name": "category_id",
-                        "in": "path",
-                        "required": true
+                        "description": "Body required.",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.EmailInput"
+                        }
                     }
                 ],
                 "responses": {
@@ -975,23 +3075,25 @@ const docTemplate = `{
                 }
             }
         },
-        "/product/v1/products/seller/{user_id}": {
-            "get": {
-                "description": "Get specific products by seller_id.",
+        "/user/v1/password/reset": {
+            "post": {
+                "description": "Set a new password with the token mailed by forgot password. Token can only be used once and every session is logged out.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Product Service"
+                    "User Service"
                 ],
-                "summary": "Get products from specific seller.",
+                "summary": "Reset password.",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "Param required.",
-                        "name": "user_id",
-                        "in": "path",
-                        "required": true
+                        "description": "Body required.",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.ResetPasswordInput"
+                        }
                     }
                 ],
                 "responses": {
@@ -1005,16 +3107,27 @@ const docTemplate = `{
                 }
             }
         },
-        "/shopping/v1": {
-            "get": {
-                "description": "Connection health check.",
+        "/user/v1/refresh": {
+            "post": {
+                "description": "Exchange refresh token for a new access token and refresh token. Refresh token can only be used once, reusing it logs out the session.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Shopping Service"
+                    "User Service"
+                ],
+                "summary": "Refresh access token.",
+                "parameters": [
+                    {
+                        "description": "Body required.",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.RefreshTokenInput"
+                        }
+                    }
                 ],
-                "summary": "Health check.",
                 "responses": {
                     "200": {
                         "description": "OK",
@@ -1026,16 +3139,27 @@ const docTemplate = `{
                 }
             }
         },
-        "/user/v1": {
-            "get": {
-                "description": "Connection health check.",
+        "/user/v1/register": {
+            "post": {
+                "description": "Registering a user from public access. A verification token is mailed to the email, login needs it verified. Address given becomes the default address of the address book, complete it there before checkout.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
                     "User Service"
                 ],
-                "summary": "Health check.",
+                "summary": "Register a user.",
+                "parameters": [
+                    {
+                        "description": "Body to register a user.",
+                        "name": "body",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.RegisterInput"
+                        }
+                    }
+                ],
                 "responses": {
                     "200": {
                         "description": "OK",
@@ -1047,24 +3171,24 @@ const docTemplate = `{
                 }
             }
         },
-        "/user/v1/login": {
+        "/user/v1/verify-email": {
             "post": {
-                "description": "Logging in to get JWT token to access certain API by roles.",
+                "description": "Verify email with the token mailed on registration or email change. Login needs a verified email, a verified new email replaces the current one.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
                     "User Service"
                 ],
-                "summary": "Login as as user, seller, or admin.",
+                "summary": "Verify email.",
                 "parameters": [
                     {
-                        "description": "Body required to login.",
+                        "description": "Body required.",
                         "name": "body",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/models.LoginInput"
+                            "$ref": "#/definitions/models.VerifyEmailInput"
                         }
                     }
                 ],
@@ -1079,24 +3203,24 @@ const docTemplate = `{
                 }
             }
         },
-        "/user/v1/register": {
+        "/user/v1/verify-email/resend": {
             "post": {
-                "description": "Registering a user from public access.",
+                "description": "Mail a new verification token, previous tokens can't be used anymore. Always succeeds so registered emails can't be guessed.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
                     "User Service"
                 ],
-                "summary": "Register a user.",
+                "summary": "Resend verification email.",
                 "parameters": [
                     {
-                        "description": "Body to register a user.",
+                        "description": "Body required.",
                         "name": "body",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/models.RegisterInput"
+                            "$ref": "#/definitions/models.EmailInput"
                         }
                     }
                 ],
@@ -1113,6 +3237,50 @@ const docTemplate = `{
         }
     },
     "definitions": {
+        "models.AddressInput": {
+            "type": "object",
+            "required": [
+                "city",
+                "country",
+                "phone",
+                "postal_code",
+                "recipient",
+                "street"
+            ],
+            "properties": {
+                "city": {
+                    "type": "string",
+                    "maxLength": 100
+                },
+                "country": {
+                    "type": "string",
+                    "maxLength": 100
+                },
+                "is_default": {
+                    "type": "boolean"
+                },
+                "label": {
+                    "description": "e.g. home, office",
+                    "type": "string",
+                    "maxLength": 50
+                },
+                "phone": {
+                    "type": "string"
+                },
+                "postal_code": {
+                    "type": "string",
+                    "maxLength": 20
+                },
+                "recipient": {
+                    "type": "string",
+                    "maxLength": 100
+                },
+                "street": {
+                    "type": "string",
+                    "maxLength": 255
+                }
+            }
+        },
         "models.CartItemInput": {
             "type": "object",
             "required": [
@@ -1124,7 +3292,55 @@ const docTemplate = `{
                     "type": "integer"
                 },
                 "quantity": {
+                    "type": "integer",
+                    "minimum": 1
+                }
+            }
+        },
+        "models.CartItemUpdateInput": {
+            "type": "object",
+            "required": [
+                "product_id",
+                "quantity"
+            ],
+            "properties": {
+                "product_id": {
                     "type": "integer"
+                },
+                "quantity": {
+                    "type": "integer",
+                    "minimum": 0
+                }
+            }
+        },
+        "models.CartMergeInput": {
+            "type": "object",
+            "required": [
+                "cart_token"
+            ],
+            "properties": {
+                "cart_token": {
+                    "type": "string"
+                },
+                "rule": {
+                    "type": "string",
+                    "enum": [
+                        "sum",
+                        "max",
+                        "keep_user",
+                        "keep_guest"
+                    ]
+                }
+            }
+        },
+        "models.CartReplaceInput": {
+            "type": "object",
+            "properties": {
+                "items": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.CartItemInput"
+                    }
                 }
             }
         },
@@ -1162,22 +3378,37 @@ const docTemplate = `{
             "type": "object",
             "properties": {
                 "address": {
-                    "type": "string"
+                    "type": "string",
+                    "maxLength": 500
                 },
                 "email": {
-                    "type": "string"
+                    "type": "string",
+                    "maxLength": 254
                 },
                 "first_name": {
-                    "type": "string"
+                    "type": "string",
+                    "maxLength": 100
                 },
                 "last_name": {
-                    "type": "string"
+                    "type": "string",
+                    "maxLength": 100
                 },
                 "phone_number": {
                     "type": "string"
                 }
             }
         },
+        "models.EmailInput": {
+            "type": "object",
+            "required": [
+                "email"
+            ],
+            "properties": {
+                "email": {
+                    "type": "string"
+                }
+            }
+        },
         "models.LoginInput": {
             "type": "object",
             "required": [
@@ -1193,12 +3424,40 @@ const docTemplate = `{
                 }
             }
         },
+        "models.LoginTwoFactorInput": {
+            "type": "object",
+            "required": [
+                "challenge_token",
+                "code"
+            ],
+            "properties": {
+                "challenge_token": {
+                    "type": "string"
+                },
+                "code": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.OrderStatusInput": {
+            "type": "object",
+            "properties": {
+                "note": {
+                    "type": "string"
+                }
+            }
+        },
         "models.PaymentProviderInput": {
             "type": "object",
             "required": [
+                "driver",
                 "name"
             ],
             "properties": {
+                "driver": {
+                    "description": "one of the registered drivers, e.g. fake for development",
+                    "type": "string"
+                },
                 "name": {
                     "type": "string"
                 }
@@ -1228,6 +3487,53 @@ const docTemplate = `{
                 },
                 "price": {
                     "type": "integer"
+                },
+                "stock": {
+                    "type": "integer",
+                    "minimum": 0
+                }
+            }
+        },
+        "models.ProductStockInput": {
+            "type": "object",
+            "required": [
+                "stock"
+            ],
+            "properties": {
+                "stock": {
+                    "type": "integer",
+                    "minimum": 0
+                }
+            }
+        },
+        "models.RefreshTokenInput": {
+            "type": "object",
+            "required": [
+                "refresh_token"
+            ],
+            "properties": {
+                "refresh_token": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.RefundInput": {
+            "type": "object",
+            "required": [
+                "reason"
+            ],
+            "properties": {
+                "amount": {
+                    "description": "0 refunds the remaining amount",
+                    "type": "integer",
+                    "minimum": 0
+                },
+                "reason": {
+                    "type": "string"
+                },
+                "seller_id": {
+                    "description": "admin only, refund items of the seller; sellers always refund their own items",
+                    "type": "integer"
                 }
             }
         },
@@ -1242,16 +3548,20 @@ const docTemplate = `{
             ],
             "properties": {
                 "address": {
-                    "type": "string"
+                    "type": "string",
+                    "maxLength": 500
                 },
                 "email": {
-                    "type": "string"
+                    "type": "string",
+                    "maxLength": 254
                 },
                 "first_name": {
-                    "type": "string"
+                    "type": "string",
+                    "maxLength": 100
                 },
                 "last_name": {
-                    "type": "string"
+                    "type": "string",
+                    "maxLength": 100
                 },
                 "password": {
                     "type": "string"
@@ -1263,6 +3573,103 @@ const docTemplate = `{
                     "type": "string"
                 }
             }
+        },
+        "models.ResetPasswordInput": {
+            "type": "object",
+            "required": [
+                "new_password",
+                "token"
+            ],
+            "properties": {
+                "new_password": {
+                    "type": "string"
+                },
+                "token": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.RoleInput": {
+            "type": "object",
+            "properties": {
+                "note": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.SellerApplicationInput": {
+            "type": "object",
+            "required": [
+                "description",
+                "store_name"
+            ],
+            "properties": {
+                "description": {
+                    "type": "string"
+                },
+                "store_name": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.SellerApplicationReviewInput": {
+            "type": "object",
+            "properties": {
+                "note": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.SubOrderStatusInput": {
+            "type": "object",
+            "properties": {
+                "courier": {
+                    "type": "string",
+                    "maxLength": 100
+                },
+                "note": {
+                    "type": "string"
+                },
+                "tracking_number": {
+                    "type": "string",
+                    "maxLength": 100
+                }
+            }
+        },
+        "models.SuspendUserInput": {
+            "type": "object",
+            "required": [
+                "reason"
+            ],
+            "properties": {
+                "reason": {
+                    "type": "string",
+                    "maxLength": 500
+                }
+            }
+        },
+        "models.TwoFactorCodeInput": {
+            "type": "object",
+            "required": [
+                "code"
+            ],
+            "properties": {
+                "code": {
+                    "description": "TOTP code, or recovery code where accepted",
+                    "type": "string"
+                }
+            }
+        },
+        "models.VerifyEmailInput": {
+            "type": "object",
+            "required": [
+                "token"
+            ],
+            "properties": {
+                "token": {
+                    "type": "string"
+                }
+            }
         }
     },
     "securityDefinitions": {
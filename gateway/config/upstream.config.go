@@ -0,0 +1,27 @@
+package config
+
+import "os"
+
+// Ports every service listens on
+const (
+	NonAuthPort = "8080" // public routes, /api/<service>/v1
+	AuthPort    = "8081" // routes of logged in users, /api/auth/<service>/v1
+	ServicePort = "8082" // routes invoked by other services, never routed
+	DocsPort    = "8080" // API documentation, /swagger
+)
+
+// Host of every service behind the gateway, keyed by the service name in the path
+func Upstreams() map[string]string {
+	return map[string]string{
+		"user":     os.Getenv("USER_HOST"),
+		"product":  os.Getenv("PRODUCT_HOST"),
+		"shopping": os.Getenv("SHOPPING_HOST"),
+		"order":    os.Getenv("ORDER_HOST"),
+		"payment":  os.Getenv("PAYMENT_HOST"),
+	}
+}
+
+// Host of the API documentation, served on /swagger
+func DocsHost() string {
+	return os.Getenv("DOCS_HOST")
+}
@@ -0,0 +1,80 @@
+package controllers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+
+	"github.com/tengkuroman/microshop/gateway/config"
+	"github.com/tengkuroman/microshop/gateway/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+func HealthCheck(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Connection OK!",
+		"service": "gateway",
+	})
+}
+
+func newProxy(host string, port string) *httputil.ReverseProxy {
+	proxy := httputil.NewSingleHostReverseProxy(&url.URL{Scheme: "http", Host: host + ":" + port})
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		log.Printf("Proxy %s %s to %s failed: %v\n", r.Method, r.URL.Path, host, err)
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusBadGateway)
+		json.NewEncoder(w).Encode(utils.ResponseAPI("Service unavailable!", http.StatusBadGateway, "error", nil))
+	}
+
+	return proxy
+}
+
+// Proxy forwards /api/[auth/]<service>/v1/<path> to /<path> of the service on the port
+func Proxy(port string) gin.HandlerFunc {
+	proxies := make(map[string]*httputil.ReverseProxy)
+	for service, host := range config.Upstreams() {
+		if host != "" {
+			proxies[service] = newProxy(host, port)
+		}
+	}
+
+	return func(c *gin.Context) {
+		proxy, ok := proxies[c.Param("service")]
+		if !ok {
+			response := utils.ResponseAPI("Service not found!", http.StatusNotFound, "error", nil)
+			c.JSON(http.StatusNotFound, response)
+			return
+		}
+
+		path := c.Param("path")
+		if path == "" {
+			path = "/"
+		}
+
+		c.Request.URL.Path = path
+		c.Request.URL.RawPath = ""
+
+		proxy.ServeHTTP(c.Writer, c.Request)
+	}
+}
+
+// ProxyDocs forwards /swagger to the API documentation
+func ProxyDocs() gin.HandlerFunc {
+	host := config.DocsHost()
+	if host == "" {
+		return func(c *gin.Context) {
+			response := utils.ResponseAPI("Service not found!", http.StatusNotFound, "error", nil)
+			c.JSON(http.StatusNotFound, response)
+		}
+	}
+
+	proxy := newProxy(host, config.DocsPort)
+
+	return func(c *gin.Context) {
+		proxy.ServeHTTP(c.Writer, c.Request)
+	}
+}
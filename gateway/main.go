@@ -0,0 +1,51 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+	"github.com/tengkuroman/microshop/gateway/config"
+	"github.com/tengkuroman/microshop/gateway/controllers"
+	"github.com/tengkuroman/microshop/gateway/middlewares"
+)
+
+func route() http.Handler {
+	r := gin.Default()
+
+	// Set allow CORS
+	r.Use(cors.Default())
+
+	// Services only trust user info from the access token
+	r.Use(middlewares.StripUserHeaders())
+
+	// Routes (health check)
+	r.GET("/", controllers.HealthCheck)
+
+	// Routes (API documentation)
+	r.GET("/swagger/*any", controllers.ProxyDocs())
+
+	// Routes (public), /api/<service>/v1/<path> to <service>:8080/<path>
+	nonAuth := controllers.Proxy(config.NonAuthPort)
+	r.Any("/api/:service/v1", nonAuth)
+	r.Any("/api/:service/v1/*path", nonAuth)
+
+	// Routes (registered), /api/auth/<service>/v1/<path> to <service>:8081/<path>
+	auth := controllers.Proxy(config.AuthPort)
+	r.Any("/api/auth/:service/v1", middlewares.RequireValidToken(), auth)
+	r.Any("/api/auth/:service/v1/*path", middlewares.RequireValidToken(), auth)
+
+	return r
+}
+
+func main() {
+	server := &http.Server{
+		Addr:    ":8000",
+		Handler: route(),
+	}
+
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,146 @@
+package middlewares
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tengkuroman/microshop/gateway/config"
+	"github.com/tengkuroman/microshop/gateway/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Token validation cache config
+var validateCacheSecond = os.Getenv("VALIDATE_CACHE_SECOND")
+
+var errTokenInvalid = errors.New("Token invalid!")
+
+// Headers services used to trust, only the access token carries user info now.
+// Client IP headers are set by the proxy from the connection, so IP based login throttling can't be bypassed.
+var userHeaders = []string{"X-User-ID", "X-User-Role", "X-User-Roles", "X-Forwarded-For", "X-Real-IP"}
+
+// Tokens validated by user service, keyed by token hash. A logged out session is rejected
+// once its cached validation expires, services themselves only check the token signature.
+var validations = struct {
+	sync.Mutex
+	expiresAt map[string]time.Time
+	sweptAt   time.Time
+}{expiresAt: make(map[string]time.Time)}
+
+// StripUserHeaders removes user info and client IP headers sent by clients
+func StripUserHeaders() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for _, header := range userHeaders {
+			c.Request.Header.Del(header)
+		}
+
+		c.Next()
+	}
+}
+
+// RequireValidToken rejects requests without a valid access token of an active session (401)
+func RequireValidToken() gin.HandlerFunc {
+	cacheLifespan := 30 * time.Second
+	if second, err := strconv.Atoi(validateCacheSecond); err == nil {
+		cacheLifespan = time.Second * time.Duration(second)
+	}
+
+	userBaseURL := config.Upstreams()["user"] + ":" + config.ServicePort
+
+	return func(c *gin.Context) {
+		bearerToken := c.Request.Header.Get("Authorization")
+		if len(strings.Split(bearerToken, " ")) != 2 {
+			response := utils.ResponseAPI("Login required!", http.StatusUnauthorized, "unauthorized", nil)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, response)
+			return
+		}
+
+		hash := sha256.Sum256([]byte(bearerToken))
+		tokenHash := hex.EncodeToString(hash[:])
+
+		if cachedValidation(tokenHash) {
+			c.Next()
+			return
+		}
+
+		err := validateToken(userBaseURL, bearerToken)
+		if err == errTokenInvalid {
+			response := utils.ResponseAPI("Login required!", http.StatusUnauthorized, "unauthorized", nil)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, response)
+			return
+		}
+
+		if err != nil {
+			log.Println("Validate token failed:", err)
+			response := utils.ResponseAPI("Validate token failed!", http.StatusBadGateway, "error", nil)
+			c.AbortWithStatusJSON(http.StatusBadGateway, response)
+			return
+		}
+
+		cacheValidation(tokenHash, cacheLifespan)
+
+		c.Next()
+	}
+}
+
+func validateToken(userBaseURL string, bearerToken string) error {
+	request, err := http.NewRequest(http.MethodPost, "http://"+userBaseURL+"/auth/validate", nil)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Authorization", bearerToken)
+
+	client := http.Client{Timeout: 5 * time.Second}
+	res, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusUnauthorized:
+		return errTokenInvalid
+	default:
+		return fmt.Errorf("Validate token failed: %s", res.Status)
+	}
+}
+
+func cachedValidation(tokenHash string) bool {
+	validations.Lock()
+	defer validations.Unlock()
+
+	expiresAt, ok := validations.expiresAt[tokenHash]
+
+	return ok && time.Now().Before(expiresAt)
+}
+
+func cacheValidation(tokenHash string, lifespan time.Duration) {
+	validations.Lock()
+	defer validations.Unlock()
+
+	now := time.Now()
+	validations.expiresAt[tokenHash] = now.Add(lifespan)
+
+	// Drop expired validations once per cache lifespan so the cache doesn't keep every token seen
+	if now.Sub(validations.sweptAt) < lifespan {
+		return
+	}
+
+	for hash, expiresAt := range validations.expiresAt {
+		if now.After(expiresAt) {
+			delete(validations.expiresAt, hash)
+		}
+	}
+	validations.sweptAt = now
+}
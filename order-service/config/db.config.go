@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/tengkuroman/microshop/common/idempotency"
 	"github.com/tengkuroman/microshop/order-service/models"
 
 	"gorm.io/driver/postgres"
@@ -23,7 +24,63 @@ func ConnectDatabase() *gorm.DB {
 		panic(err.Error())
 	}
 
-	db.AutoMigrate(&models.OrderDetail{}, &models.OrderItem{})
+	// Orders created before sub-orders get one per seller
+	backfillSubOrders := db.Migrator().HasTable(&models.OrderItem{}) && !db.Migrator().HasTable(&models.SubOrder{})
+
+	// Order histories recorded before sub-orders are of the order itself
+	backfillHistorySubOrder := db.Migrator().HasTable(&models.OrderHistory{}) && !db.Migrator().HasColumn(&models.OrderHistory{}, "SubOrderID")
+	hasRefundStatus := !db.Migrator().HasTable(&models.OrderDetail{}) || db.Migrator().HasColumn(&models.OrderDetail{}, "RefundStatus")
+
+	db.AutoMigrate(&models.OrderDetail{}, &models.OrderItem{}, &models.SubOrder{}, &models.OrderHistory{}, &models.SubOrderRefund{}, &idempotency.Key{})
+
+	if backfillHistorySubOrder {
+		db.Exec("UPDATE order_histories SET sub_order_id = 0 WHERE sub_order_id IS NULL")
+	}
+
+	if backfillSubOrders {
+		// Sub-orders continue from the fulfilment of the order, for a partially refunded order its last
+		// fulfilment status before the refund. Delivered orders were paid out to sellers before payouts
+		// were recorded, so their payout is settled (paid out, when is unknown).
+		db.Exec(`INSERT INTO sub_orders (created_at, updated_at, order_detail_id, seller_id, subtotal, status, payout_amount, payout_status)
+			SELECT NOW(), NOW(), d.id, i.seller_id, SUM(i.price * i.quantity), f.status, SUM(i.price * i.quantity),
+				CASE WHEN f.status = ? THEN ? WHEN f.status IN (?, ?) THEN ? ELSE ? END
+			FROM order_items i JOIN order_details d ON d.id = i.order_detail_id
+			CROSS JOIN LATERAL (
+				SELECT CASE WHEN d.status = ? THEN COALESCE((
+					SELECT h.to_status FROM order_histories h
+					WHERE h.order_detail_id = d.id AND h.to_status IN ? AND h.deleted_at IS NULL
+					ORDER BY h.id DESC LIMIT 1
+				), ?) ELSE d.status END AS status
+			) f
+			WHERE i.deleted_at IS NULL AND d.deleted_at IS NULL
+			GROUP BY d.id, f.status, i.seller_id`,
+			models.StatusDelivered, models.PayoutPaid, models.StatusCancelled, models.StatusRefunded, models.PayoutCancelled, models.PayoutPending,
+			models.StatusPartiallyRefunded,
+			[]string{models.StatusPaid, models.StatusProcessing, models.StatusShipped, models.StatusDelivered},
+			models.StatusPaid)
+		db.Exec(`UPDATE order_items SET sub_order_id = sub_orders.id FROM sub_orders
+			WHERE sub_orders.order_detail_id = order_items.order_detail_id AND sub_orders.seller_id = order_items.seller_id`)
+	}
+
+	// Partial refund moved from order status to refund status, the order gets back its last fulfilment status
+	if !hasRefundStatus {
+		db.Exec("UPDATE order_details SET refund_status = ? WHERE status = ?", models.StatusRefunded, models.StatusRefunded)
+		db.Exec(`UPDATE order_details d SET refund_status = ?, status = COALESCE((
+				SELECT h.to_status FROM order_histories h
+				WHERE h.order_detail_id = d.id AND h.sub_order_id = 0 AND h.to_status IN ? AND h.deleted_at IS NULL
+				ORDER BY h.id DESC LIMIT 1
+			), ?)
+			WHERE d.status = ?`,
+			models.StatusPartiallyRefunded,
+			[]string{models.StatusPaid, models.StatusProcessing, models.StatusShipped, models.StatusDelivered},
+			models.StatusPaid, models.StatusPartiallyRefunded)
+	}
+
+	// Payment status replaced by order status
+	if db.Migrator().HasColumn(&models.OrderDetail{}, "payment_status") {
+		db.Exec("UPDATE order_details SET status = CASE WHEN payment_status = 'paid' THEN ? ELSE ? END WHERE status IS NULL OR status = ''", models.StatusPaid, models.StatusPendingPayment)
+		db.Migrator().DropColumn(&models.OrderDetail{}, "payment_status")
+	}
 
 	return db
 }
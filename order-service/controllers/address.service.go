@@ -0,0 +1,52 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/tengkuroman/microshop/order-service/models"
+)
+
+// Connection to user service (address book) config
+var (
+	userHost    = os.Getenv("USER_HOST")
+	userPort    = os.Getenv("USER_PORT")
+	userBaseURL = fmt.Sprintf("%s:%s", userHost, userPort)
+)
+
+// Error response from user service, e.g. 404 when the user has no such address
+type addressError struct {
+	Code    int
+	Message string
+}
+
+func (e *addressError) Error() string {
+	return e.Message
+}
+
+// Shipping address of the user to snapshot to the order, the default one when addressID is 0
+func fetchShippingAddress(userID uint, addressID uint) (models.ShippingAddress, error) {
+	client := resty.New()
+	res, err := client.R().
+		SetQueryParam("address_id", strconv.FormatUint(uint64(addressID), 10)).
+		SetResult(&models.AddressResponse{}).
+		SetError(&models.AddressResponse{}).
+		Get("http://" + userBaseURL + "/users/" + strconv.FormatUint(uint64(userID), 10) + "/address")
+	if err != nil {
+		return models.ShippingAddress{}, err
+	}
+
+	if res.StatusCode() != http.StatusOK {
+		message := res.Status()
+		if addressResponse, ok := res.Error().(*models.AddressResponse); ok && addressResponse.Meta.Message != "" {
+			message = addressResponse.Meta.Message
+		}
+
+		return models.ShippingAddress{}, &addressError{Code: res.StatusCode(), Message: message}
+	}
+
+	return res.Result().(*models.AddressResponse).Data, nil
+}
@@ -1,13 +1,17 @@
 package controllers
 
 import (
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"os"
 	"strconv"
+	"time"
 
 	"github.com/go-resty/resty/v2"
 	"github.com/jinzhu/copier"
+	"github.com/tengkuroman/microshop/common/auth"
 	"github.com/tengkuroman/microshop/order-service/models"
 	"github.com/tengkuroman/microshop/order-service/utils"
 
@@ -22,6 +26,13 @@ var (
 	paymentBaseURL = fmt.Sprintf("%s:%s", paymentHost, paymentPort)
 )
 
+// Connection to product service config
+var (
+	productHost    = os.Getenv("PRODUCT_HOST")
+	productPort    = os.Getenv("PRODUCT_PORT")
+	productBaseURL = fmt.Sprintf("%s:%s", productHost, productPort)
+)
+
 // @Summary 	Health check.
 // @Description Connection health check.
 // @Tags 		Order Service
@@ -36,19 +47,19 @@ func HealthCheck(c *gin.Context) {
 }
 
 // @Summary 	Get all user's order.
-// @Description Get all user's order. Order retrieved only that made by logged user.
+// @Description Get all user's order. Order retrieved only that made by logged user. Each order has a sub-order per seller, shipped separately.
 // @Tags 		Order Service
 // @Produce 	json
 // @Success 	200 {object} map[string]interface{}
 // @Router 		/auth/order/v1/orders [get]
 // @Security 	BearerToken
 func GetOrdersDetail(c *gin.Context) {
-	// Get orders by user_id
+	// Get orders by user_id, with their sub-order per seller
 	db := c.MustGet("db").(*gorm.DB)
 	var orders []models.OrderDetail
-	userID := c.Request.Header.Get("X-User-ID")
+	userID := auth.UserID(c)
 
-	if err := db.Where("user_id = ?", userID).Find(&orders).Error; err != nil {
+	if err := db.Preload("OrderItem").Preload("SubOrder.OrderItem").Where("user_id = ?", userID).Find(&orders).Error; err != nil {
 		response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
 		c.JSON(http.StatusInternalServerError, response)
 		return
@@ -70,10 +81,11 @@ func GetOrdersDetail(c *gin.Context) {
 // @Param 		order_detail_id path int true "Param required."
 // @Security 	BearerToken
 func DeleteOrder(c *gin.Context) {
+	// Order owner is checked by RequireOwner
 	// Check if an order exist based on param :order_detail_id
-	// 		If order exist then check if order_detail.user.id == user_id
-	//			OK: delete order_item where order_item.order_detail_id == order_detail.id, delete order_detail
-	//			Not OK: Return message "You can only delete your order!"
+	// 		If order exist then check if order unpaid or cancelled
+	//			OK: release stock, delete order_item and sub_order where order_detail_id == order_detail.id, delete order_detail
+	//			Not OK: Return message "Only unpaid or cancelled order can be deleted!"
 	//		If order not exist then return "order detail not found"
 	db := c.MustGet("db").(*gorm.DB)
 
@@ -84,29 +96,43 @@ func DeleteOrder(c *gin.Context) {
 		return
 	}
 
-	orderUserID := strconv.FormatUint(uint64(order.UserID), 10)
-	userID := c.Request.Header.Get("X-User-ID")
+	if order.Status != models.StatusPendingPayment && order.Status != models.StatusCancelled {
+		response := utils.ResponseAPI("Only unpaid or cancelled order can be deleted!", http.StatusBadRequest, "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
 
-	if orderUserID == userID {
-		var item models.OrderItem
-		if err := db.Where("order_detail_id = ?", order.ID).Delete(&item).Error; err != nil {
+	// Unpaid order gives back its reserved stock
+	if order.Status == models.StatusPendingPayment {
+		if err := releaseStock(order); err != nil {
 			response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
 			c.JSON(http.StatusInternalServerError, response)
 			return
 		}
+	}
 
-		if err := db.Delete(&order).Error; err != nil {
-			response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
-			c.JSON(http.StatusInternalServerError, response)
-			return
-		}
+	var item models.OrderItem
+	if err := db.Where("order_detail_id = ?", order.ID).Delete(&item).Error; err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
 
-		response := utils.ResponseAPI("Order deleted successfully!", http.StatusOK, "success", nil)
-		c.JSON(http.StatusOK, response)
-	} else {
-		response := utils.ResponseAPI("You can only delete your order!", http.StatusUnauthorized, "unauthorized", nil)
-		c.JSON(http.StatusUnauthorized, response)
+	var subOrder models.SubOrder
+	if err := db.Where("order_detail_id = ?", order.ID).Delete(&subOrder).Error; err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
+		c.JSON(http.StatusInternalServerError, response)
+		return
 	}
+
+	if err := db.Delete(&order).Error; err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	response := utils.ResponseAPI("Order deleted successfully!", http.StatusOK, "success", nil)
+	c.JSON(http.StatusOK, response)
 }
 
 // @Summary 	Select payment provider.
@@ -119,10 +145,9 @@ func DeleteOrder(c *gin.Context) {
 // @Param 		payment_provider_id path int true "Param required."
 // @Security 	BearerToken
 func SelectPaymentProvider(c *gin.Context) {
+	// Order owner is checked by RequireOwner
 	// Check if an order exist based on param :order_detail_id
-	// 		If order exist then check if order_detail.user.id == user_id
-	//			OK: Update order_detail.payment_provider_id
-	//			Not OK: Return message "You can only process payment of your order!"
+	// 		If order exist then update order_detail.payment_provider_id
 	//		If order not exist then return "order detail not found"
 	db := c.MustGet("db").(*gorm.DB)
 
@@ -133,39 +158,40 @@ func SelectPaymentProvider(c *gin.Context) {
 		return
 	}
 
-	orderUserID := strconv.FormatUint(uint64(order.UserID), 10)
-	userID := c.Request.Header.Get("X-User-ID")
-
-	if orderUserID == userID {
-		if err := db.Model(&order).Update("payment_provider_id", c.Param("payment_provider_id")).Error; err != nil {
-			response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
-			c.JSON(http.StatusInternalServerError, response)
-			return
-		}
+	if order.Status != models.StatusPendingPayment {
+		response := utils.ResponseAPI("Order is not waiting for payment!", http.StatusBadRequest, "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
 
-		response := utils.ResponseAPI("Set payment provider success!", http.StatusOK, "success", nil)
-		c.JSON(http.StatusOK, response)
-	} else {
-		response := utils.ResponseAPI("You can only process payment of your order!", http.StatusUnauthorized, "unauthorized", nil)
-		c.JSON(http.StatusUnauthorized, response)
+	if err := db.Model(&order).Update("payment_provider_id", c.Param("payment_provider_id")).Error; err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
+		c.JSON(http.StatusInternalServerError, response)
+		return
 	}
+
+	response := utils.ResponseAPI("Set payment provider success!", http.StatusOK, "success", nil)
+	c.JSON(http.StatusOK, response)
 }
 
 // @Summary 	Pay the order.
-// @Description	Pay the selected order. A user can only pay their own order.
+// @Description	Pay the selected order. A user can only pay their own order. Retry with the same Idempotency-Key to get the first response instead of paying twice. Order not paid within UNPAID_ORDER_MINUTE_LIFESPAN (a day by default) is cancelled.
 // @Tags 		Order Service
 // @Produce 	json
 // @Success 	200 {object} map[string]interface{}
 // @Router 		/auth/order/v1/order/payment/checkout/{order_detail_id} [patch]
 // @Param 		order_detail_id path int true "Param required."
+// @Param 		Idempotency-Key header string true "Unique key per payment attempt, e.g. UUID."
 // @Security 	BearerToken
 func PayOrder(c *gin.Context) {
+	// Order owner is checked by RequireOwner
 	// Check if an order exist based on param :order_detail_id
-	// 		If order exist then check if order_detail.user.id == user_id
-	//			OK: If order paid?
-	//					OK: Update order_detail.payment_status
-	//					Not OK: Return message "Order already paid!"
-	//			Not OK: Return message "You can only pay your order!"
+	// 		If order exist then check if order waiting for payment
+	//			OK: Renew stock reservation, commit stock (taken out of products before charging),
+	//				process payment (declined: give the stock back, already paid: take its payment),
+	//				verify payment record committed,
+	//				change order and sub-orders status to paid
+	//			Not OK: Return message "Order is not waiting for payment!" (or expired, cancelled soon by CancelUnpaidOrders)
 	//		If order not exist then return "order detail not found"
 	db := c.MustGet("db").(*gorm.DB)
 
@@ -176,51 +202,119 @@ func PayOrder(c *gin.Context) {
 		return
 	}
 
-	orderUserID := strconv.FormatUint(uint64(order.UserID), 10)
-	userID := c.Request.Header.Get("X-User-ID")
+	if order.Status != models.StatusPendingPayment {
+		response := utils.ResponseAPI("Order is not waiting for payment!", http.StatusBadRequest, "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+	} else if time.Since(order.CreatedAt) > unpaidOrderLifespan() {
+		response := utils.ResponseAPI("Order payment expired, please checkout again!", http.StatusBadRequest, "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+	} else if order.PaymentProviderID == 0 {
+		response := utils.ResponseAPI("Please select payment provider!", http.StatusBadRequest, "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+	} else {
+		var items []models.OrderItem
+		if err := db.Where("order_detail_id = ?", order.ID).Find(&items).Error; err != nil {
+			response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
+			c.JSON(http.StatusInternalServerError, response)
+			return
+		}
 
-	if orderUserID == userID {
-		if order.PaymentStatus == "paid" {
-			response := utils.ResponseAPI("Order already paid!", http.StatusBadRequest, "error", nil)
-			c.JSON(http.StatusBadRequest, response)
-		} else {
-			data := map[string]interface{}{
-				"total":               order.Total,
-				"payment_provider_id": order.PaymentProviderID,
-			}
+		// Renew stock reservation, it may have expired while waiting for payment
+		if err := reserveStock(order, items); err != nil {
+			stockErrorResponse(c, err)
+			return
+		}
 
-			client := resty.New()
-			resp, err := client.R().SetBody(data).Post("http://" + paymentBaseURL + "/payment/process")
+		// Take the stock out of products before charging, so a paid order is never oversold.
+		// Committed stock is given back when the payment is declined or the order is cancelled.
+		if err := commitStock(order); err != nil {
+			stockErrorResponse(c, err)
+			return
+		}
 
-			if err != nil {
-				response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
-				c.JSON(http.StatusInternalServerError, response)
+		// Retried request with the same key gets the same payment instead of being charged twice
+		idempotencyKey := fmt.Sprintf("order-%d-%s", order.ID, c.Request.Header.Get("Idempotency-Key"))
+
+		paymentID, err := processPayment(order, idempotencyKey)
+		if err != nil {
+			var paymentErr *paymentError
+			if errors.As(err, &paymentErr) && paymentErr.Code < http.StatusInternalServerError {
+				// Declined, give the stock back. Conflict means another payment of the order is in progress.
+				if paymentErr.Code != http.StatusConflict {
+					if err := releaseStock(order); err != nil {
+						log.Printf("Release stock of order %d failed: %v\n", order.ID, err)
+					}
+				}
+
+				response := utils.ResponseAPI("Payment failed: "+paymentErr.Message, paymentErr.Code, "error", nil)
+				c.JSON(paymentErr.Code, response)
 				return
 			}
 
-			fmt.Println(resp)
+			response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
+			c.JSON(http.StatusInternalServerError, response)
+			return
+		}
 
-			if err := db.Model(&order).Update("payment_status", "paid").Error; err != nil {
-				response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
-				c.JSON(http.StatusInternalServerError, response)
-				return
-			}
+		// Only mark the order paid when payment service has the committed payment record
+		if err := verifyPayment(paymentID, order); err != nil {
+			response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
+			c.JSON(http.StatusInternalServerError, response)
+			return
+		}
 
-			response := utils.ResponseAPI("Order payment success!", http.StatusOK, "success", nil)
-			c.JSON(http.StatusOK, response)
+		if err := markOrderPaid(db, &order, paymentID); err != nil {
+			response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
+			c.JSON(http.StatusInternalServerError, response)
+			return
 		}
-	} else {
-		response := utils.ResponseAPI("You can only process payment of your order!", http.StatusUnauthorized, "unauthorized", nil)
-		c.JSON(http.StatusUnauthorized, response)
+
+		response := utils.ResponseAPI("Order payment success!", http.StatusOK, "success", nil)
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// Change order and sub-orders status to paid with the verified payment
+func markOrderPaid(db *gorm.DB, order *models.OrderDetail, paymentID uint) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(order).Update("payment_id", paymentID).Error; err != nil {
+			return err
+		}
+
+		if err := order.Transition(tx, models.StatusPaid, models.ActorSystem, 0, "Payment processed"); err != nil {
+			return err
+		}
+
+		return models.TransitionSubOrders(tx, order.ID, models.StatusPaid, "Payment processed")
+	})
+}
+
+// Buyer of the order in :order_detail_id, for RequireOwner
+func OrderOwner(c *gin.Context) (uint, error) {
+	db := c.MustGet("db").(*gorm.DB)
+	var order models.OrderDetail
+
+	if err := db.Where("id = ?", c.Param("order_detail_id")).First(&order).Error; err != nil {
+		return 0, err
 	}
+
+	return order.UserID, nil
 }
 
 // Invoked by shopping service
 func CreateOrder(c *gin.Context) {
+	// If order for the checkout already created then return it (checkout retried by shopping service)
 	// Bind session to order detail
-	// Set payment status unpaid
+	// Get shipping address from user service address book, snapshot it to order detail
+	// Get each product from product service, snapshot name, price and seller to order item
+	// Compute total from snapshotted prices
+	// Set status pending payment
 	// Create to DB, get order detail ID
-	// Create order item using order detail ID and items from REST
+	// Split items per seller, create a sub-order per seller using order detail ID
+	// Create order item using order detail ID, its sub-order ID and items from REST
+	// All created in one transaction
+	// Reserve stock of order items in product service, remove the order if it can't be reserved,
+	// so an error response means no order was created
 	var orderInput models.OrderInput
 
 	if err := c.ShouldBindJSON(&orderInput); err != nil {
@@ -229,38 +323,155 @@ func CreateOrder(c *gin.Context) {
 		return
 	}
 
-	orderDetailInput := orderInput.Session
+	if len(orderInput.Items) == 0 {
+		response := utils.ResponseAPI("Order has no items!", http.StatusBadRequest, "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	db := c.MustGet("db").(*gorm.DB)
 
 	var orderDetail models.OrderDetail
-	orderDetail.Total = orderDetailInput.Total
-	orderDetail.PaymentStatus = "unpaid" //default when checkout
-	orderDetail.UserID = orderDetailInput.UserID
+	if orderInput.CheckoutID != 0 {
+		if err := db.Where("checkout_id = ?", orderInput.CheckoutID).First(&orderDetail).Error; err == nil {
+			response := utils.ResponseAPI("Order already created!", http.StatusOK, "success", gin.H{"order_detail_id": orderDetail.ID})
+			c.JSON(http.StatusOK, response)
+			return
+		}
+
+		orderDetail.CheckoutID = &orderInput.CheckoutID
+	}
+
+	shippingAddress, err := fetchShippingAddress(orderInput.Session.UserID, orderInput.AddressID)
+	if err != nil {
+		var addressErr *addressError
+		if errors.As(err, &addressErr) && addressErr.Code == http.StatusNotFound {
+			response := utils.ResponseAPI("Shipping address not found, add one to your address book first (POST /auth/user/v1/addresses)!", http.StatusBadRequest, "error", nil)
+			c.JSON(http.StatusBadRequest, response)
+			return
+		}
 
-	db := c.MustGet("db").(*gorm.DB)
-	if err := db.Create(&orderDetail).Error; err != nil {
 		response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
 		c.JSON(http.StatusInternalServerError, response)
 		return
 	}
 
-	orderItemsInput := orderInput.Items
+	orderDetail.ShippingAddress = shippingAddress
 
+	// Snapshot product data at order time, total is computed here instead of trusting the caller
 	var orderItems []models.OrderItem
-	for i := range orderItemsInput {
-		var orderItem models.OrderItem
+	var total int
+
+	client := resty.New()
+	for _, itemInput := range orderInput.Items {
+		productID := strconv.FormatUint(uint64(itemInput.ProductID), 10)
+		res, err := client.R().SetResult(&models.ProductResponse{}).Get("http://" + productBaseURL + "/product/" + productID)
+
+		if err != nil {
+			response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
+			c.JSON(http.StatusInternalServerError, response)
+			return
+		}
+
+		if res.StatusCode() != http.StatusOK {
+			response := utils.ResponseAPI(fmt.Sprintf("Product %d is not available!", itemInput.ProductID), http.StatusBadRequest, "error", nil)
+			c.JSON(http.StatusBadRequest, response)
+			return
+		}
 
-		orderItem.Quantity = orderItemsInput[i].Quantity
-		orderItem.ProductID = orderItemsInput[i].ProductID
-		orderItem.OrderDetailID = orderDetail.ID
+		product := res.Result().(*models.ProductResponse).Data
 
-		orderItems = append(orderItems, orderItem)
+		orderItems = append(orderItems, models.OrderItem{
+			Quantity:    itemInput.Quantity,
+			ProductID:   itemInput.ProductID,
+			ProductName: product.Name,
+			Price:       product.Price,
+			SellerID:    product.UserID,
+		})
+
+		total += product.Price * itemInput.Quantity
 	}
 
-	if err := db.Create(&orderItems).Error; err != nil {
+	orderDetail.Total = total
+	orderDetail.Status = models.StatusPendingPayment //default when checkout
+	orderDetail.UserID = orderInput.Session.UserID
+	orderDetail.OrderHistory = []models.OrderHistory{{
+		ToStatus:  models.StatusPendingPayment,
+		ActorID:   orderDetail.UserID,
+		ActorRole: models.ActorBuyer,
+		Note:      "Order created",
+	}}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&orderDetail).Error; err != nil {
+			return err
+		}
+
+		// Each seller fulfils and is paid out for their own sub-order
+		subOrders := models.SplitSubOrders(orderItems)
+		for i := range subOrders {
+			subOrders[i].OrderDetailID = orderDetail.ID
+		}
+
+		if err := tx.Create(&subOrders).Error; err != nil {
+			return err
+		}
+
+		subOrderIDs := make(map[uint]uint)
+		for _, subOrder := range subOrders {
+			subOrderIDs[subOrder.SellerID] = subOrder.ID
+		}
+
+		for i := range orderItems {
+			orderItems[i].OrderDetailID = orderDetail.ID
+			orderItems[i].SubOrderID = subOrderIDs[orderItems[i].SellerID]
+		}
+
+		return tx.Create(&orderItems).Error
+	})
+
+	if err != nil {
 		response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
 		c.JSON(http.StatusInternalServerError, response)
 		return
 	}
 
-	c.JSON(http.StatusOK, nil)
+	// Hold the stock until the order is paid, the order is removed if out of stock.
+	// Invoked after the transaction so no rows stay locked while product service is called.
+	if err := reserveStock(orderDetail, orderItems); err != nil {
+		// Reservation could be made before the call failed
+		if err := releaseStock(orderDetail); err != nil {
+			log.Printf("Release stock of order %d failed: %v\n", orderDetail.ID, err)
+		}
+
+		if err := db.Transaction(func(tx *gorm.DB) error {
+			return models.PurgeOrder(tx, orderDetail.ID)
+		}); err != nil {
+			log.Printf("Remove order %d without stock failed: %v\n", orderDetail.ID, err)
+		}
+
+		stockErrorResponse(c, err)
+		return
+	}
+
+	response := utils.ResponseAPI("Order created successfully!", http.StatusOK, "success", gin.H{"order_detail_id": orderDetail.ID})
+	c.JSON(http.StatusOK, response)
+}
+
+// Invoked by payment service
+func GetOrderDetail(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	var order models.OrderDetail
+
+	if err := db.Preload("OrderItem").Where("id = ?", c.Param("order_detail_id")).First(&order).Error; err != nil {
+		response := utils.ResponseAPI("Order detail not found!", http.StatusNotFound, "error", nil)
+		c.JSON(http.StatusNotFound, response)
+		return
+	}
+
+	var orderDetailResponse models.OrderDetailResponse
+	copier.Copy(&orderDetailResponse, &order)
+
+	response := utils.ResponseAPI("Get order detail success!", http.StatusOK, "success", orderDetailResponse)
+	c.JSON(http.StatusOK, response)
 }
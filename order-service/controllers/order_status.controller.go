@@ -0,0 +1,440 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/jinzhu/copier"
+	"github.com/tengkuroman/microshop/common/auth"
+	"github.com/tengkuroman/microshop/order-service/models"
+	"github.com/tengkuroman/microshop/order-service/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Actors the logged in user can act as for the order: buyer (order owner), seller (owns an item), admin
+func orderActors(c *gin.Context, db *gorm.DB, order models.OrderDetail) ([]string, uint, error) {
+	var actors []string
+	userID := auth.UserID(c)
+
+	if order.UserID == userID {
+		actors = append(actors, models.ActorBuyer)
+	}
+
+	var sellerItems int64
+	if err := db.Model(&models.OrderItem{}).Where("order_detail_id = ? AND seller_id = ?", order.ID, userID).Count(&sellerItems).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if sellerItems > 0 {
+		actors = append(actors, models.ActorSeller)
+	}
+
+	if auth.HasRole(c, auth.RoleAdmin) {
+		actors = append(actors, models.ActorAdmin)
+	}
+
+	return actors, userID, nil
+}
+
+// @Summary 	Change order status.
+// @Description Move order to the next status. Buyer and admin can cancel unpaid order. Processing, shipping and delivery are done per sub-order and rolled up to the order. Refunds are done through payment service. Deprecated: processing, shipped and delivered still move every sub-order of the order the user can move, use the sub-order status instead.
+// @Tags 		Order Service
+// @Param 		body body models.OrderStatusInput false "Optional note."
+// @Produce 	json
+// @Success 	200 {object} map[string]interface{}
+// @Router 		/auth/order/v1/order/status/{order_detail_id}/{status} [patch]
+// @Param 		order_detail_id path int true "Param required."
+// @Param 		status path string true "Available status: cancelled (processing, shipped, delivered deprecated)"
+// @Security 	BearerToken
+func UpdateOrderStatus(c *gin.Context) {
+	// Check if an order exist based on param :order_detail_id
+	// 		If order exist then check what the user is to the order (buyer, seller, admin)
+	//			Allowed to change current status to requested status?
+	//				OK: Change status of order and its sub-orders, record order history (release stock if cancelled)
+	//				Not OK: Return message "Order status change not allowed!"
+	//			Deprecated processing, shipped, delivered: move the sub-orders the user can move instead
+	//		If order not exist then return "order detail not found"
+	db := c.MustGet("db").(*gorm.DB)
+
+	var order models.OrderDetail
+	if err := db.Where("id = ?", c.Param("order_detail_id")).First(&order).Error; err != nil {
+		response := utils.ResponseAPI("Order detail not found!", http.StatusBadRequest, "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	var statusInput models.OrderStatusInput
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&statusInput); err != nil {
+			response := utils.ResponseAPI(err.Error(), http.StatusBadRequest, "error", nil)
+			c.JSON(http.StatusBadRequest, response)
+			return
+		}
+	}
+
+	actors, userID, err := orderActors(c, db, order)
+	if err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	if len(actors) == 0 {
+		response := utils.ResponseAPI("You can only update your order!", http.StatusForbidden, "forbidden", nil)
+		c.JSON(http.StatusForbidden, response)
+		return
+	}
+
+	newStatus := c.Param("status")
+
+	if models.DeprecatedOrderTransitions[newStatus] {
+		updateSubOrdersStatus(c, db, order, newStatus, statusInput)
+		return
+	}
+
+	actor, err := models.AllowedActor(order.Status, newStatus, actors)
+	if err != nil {
+		response := utils.ResponseAPI(fmt.Sprintf("Order status can't be changed from %s to %s!", order.Status, newStatus), http.StatusBadRequest, "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := order.Transition(tx, newStatus, actor, userID, statusInput.Note); err != nil {
+			return err
+		}
+
+		return models.TransitionSubOrders(tx, order.ID, newStatus, statusInput.Note)
+	})
+
+	if err == models.ErrInvalidTransition {
+		response := utils.ResponseAPI("Order status changed by another request, please try again!", http.StatusConflict, "error", nil)
+		c.JSON(http.StatusConflict, response)
+		return
+	}
+
+	if err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	// Cancelled order gives back its reserved stock
+	if newStatus == models.StatusCancelled {
+		if err := releaseStock(order); err != nil {
+			log.Printf("Release stock of order %d failed: %v\n", order.ID, err)
+		}
+	}
+
+	response := utils.ResponseAPI("Order status changed successfully!", http.StatusOK, "success", gin.H{"status": order.Status})
+	c.JSON(http.StatusOK, response)
+}
+
+var unpaidOrderMinuteLifespan = os.Getenv("UNPAID_ORDER_MINUTE_LIFESPAN")
+
+// Payment started just before the order expired is given this long to finish before the order is cancelled
+const unpaidOrderGracePeriod = time.Hour
+
+// How long an order waits for payment, a day by default
+func unpaidOrderLifespan() time.Duration {
+	minutes, err := strconv.Atoi(unpaidOrderMinuteLifespan)
+	if err != nil || minutes <= 0 {
+		minutes = 24 * 60
+	}
+
+	return time.Duration(minutes) * time.Minute
+}
+
+// Cancel orders not paid in time and give back their stock, also committed stock of payments that failed midway
+func CancelUnpaidOrders(db *gorm.DB) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		cancelUnpaidOrders(db)
+		<-ticker.C
+	}
+}
+
+func cancelUnpaidOrders(db *gorm.DB) {
+	var orders []models.OrderDetail
+
+	expiredAt := time.Now().Add(-unpaidOrderLifespan() - unpaidOrderGracePeriod)
+	if err := db.Where("status = ? AND created_at < ?", models.StatusPendingPayment, expiredAt).Order("id").Find(&orders).Error; err != nil {
+		log.Println("Cancel unpaid orders failed:", err)
+		return
+	}
+
+	for i := range orders {
+		if err := cancelUnpaidOrder(db, orders[i]); err != nil {
+			log.Printf("Cancel unpaid order %d failed: %v\n", orders[i].ID, err)
+		}
+	}
+}
+
+// Order charged without being marked paid (e.g. crashed after payment) is marked paid instead.
+// Payment left pending is finished first, payment service charges an abandoned payment again.
+func cancelUnpaidOrder(db *gorm.DB, order models.OrderDetail) error {
+	payment, err := findOrderPayment(order)
+	if err == nil {
+		paymentID := payment.Data.ID
+		if payment.Data.Status == models.PaymentPending {
+			// Declined payment is failed, the order is cancelled on the next run
+			idempotencyKey := fmt.Sprintf("order-%d-recover-%d", order.ID, time.Now().Unix())
+			if paymentID, err = processPayment(order, idempotencyKey); err != nil {
+				return err
+			}
+		}
+
+		if err := verifyPayment(paymentID, order); err != nil {
+			return err
+		}
+
+		return markOrderPaid(db, &order, paymentID)
+	}
+
+	if !errors.Is(err, errPaymentNotFound) {
+		return err
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := order.Transition(tx, models.StatusCancelled, models.ActorSystem, 0, "Payment not received in time"); err != nil {
+			return err
+		}
+
+		return models.TransitionSubOrders(tx, order.ID, models.StatusCancelled, "Payment not received in time")
+	})
+	if err != nil {
+		return err
+	}
+
+	return releaseStock(order)
+}
+
+// Deprecated order status change: move every sub-order of the order the user can move to the status, then roll up the order
+func updateSubOrdersStatus(c *gin.Context, db *gorm.DB, order models.OrderDetail, newStatus string, statusInput models.OrderStatusInput) {
+	c.Header("Deprecation", "true")
+
+	moved := 0
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, order.ID).Error; err != nil {
+			return err
+		}
+
+		var subOrders []models.SubOrder
+		if err := tx.Where("order_detail_id = ?", order.ID).Order("id").Find(&subOrders).Error; err != nil {
+			return err
+		}
+
+		for i := range subOrders {
+			actor, err := models.AllowedSubOrderActor(subOrders[i].Status, newStatus, subOrderActors(c, order, subOrders[i]))
+			if err != nil {
+				continue
+			}
+
+			if err := subOrders[i].Transition(tx, newStatus, actor, auth.UserID(c), statusInput.Note); err != nil {
+				return err
+			}
+			moved++
+		}
+
+		if moved == 0 {
+			return models.ErrInvalidTransition
+		}
+
+		return models.RollUpOrderStatus(tx, &order)
+	})
+
+	if err == models.ErrInvalidTransition {
+		response := utils.ResponseAPI(fmt.Sprintf("Order status can't be changed from %s to %s!", order.Status, newStatus), http.StatusBadRequest, "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	if err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	message := "Order status changed successfully! Changing processing, shipped or delivered on the order is deprecated, use the sub-order status."
+	response := utils.ResponseAPI(message, http.StatusOK, "success", gin.H{"status": order.Status, "sub_orders_changed": moved})
+	c.JSON(http.StatusOK, response)
+}
+
+// @Summary 	Get order status history.
+// @Description Get every status change of an order and its sub-orders. Available to the buyer, sellers of the order items (only their own sub-order) and admin.
+// @Tags 		Order Service
+// @Produce 	json
+// @Success 	200 {object} map[string]interface{}
+// @Router 		/auth/order/v1/order/history/{order_detail_id} [get]
+// @Param 		order_detail_id path int true "Param required."
+// @Security 	BearerToken
+func GetOrderHistory(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+
+	var order models.OrderDetail
+	if err := db.Where("id = ?", c.Param("order_detail_id")).First(&order).Error; err != nil {
+		response := utils.ResponseAPI("Order detail not found!", http.StatusBadRequest, "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	actors, _, err := orderActors(c, db, order)
+	if err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	if len(actors) == 0 {
+		response := utils.ResponseAPI("You can only see your order!", http.StatusForbidden, "forbidden", nil)
+		c.JSON(http.StatusForbidden, response)
+		return
+	}
+
+	// Seller only sees the order and their own sub-order
+	query := db.Where("order_detail_id = ?", order.ID)
+	if order.UserID != auth.UserID(c) && !auth.HasRole(c, auth.RoleAdmin) {
+		query = query.Where("sub_order_id = 0 OR sub_order_id IN (?)", db.Model(&models.SubOrder{}).Select("id").Where("order_detail_id = ? AND seller_id = ?", order.ID, auth.UserID(c)))
+	}
+
+	var histories []models.OrderHistory
+	if err := query.Order("id").Find(&histories).Error; err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	var historiesResponse []models.OrderHistoryResponse
+	copier.Copy(&historiesResponse, &histories)
+
+	response := utils.ResponseAPI("Get order history success!", http.StatusOK, "success", historiesResponse)
+	c.JSON(http.StatusOK, response)
+}
+
+// @Summary 	Get orders to fulfil (role: seller)
+// @Description Get sub-orders of logged in seller with their items, status, shipping and payout, and where to ship them. Other sellers' portions of the orders are not returned.
+// @Tags 		Order Service
+// @Produce 	json
+// @Success 	200 {object} map[string]interface{}
+// @Router 		/auth/order/v1/orders/seller [get]
+// @Security 	BearerToken
+func GetSellerOrders(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	var subOrders []models.SubOrder
+	userID := auth.UserID(c)
+
+	if err := db.Preload("OrderItem").Where("seller_id = ?", userID).Order("id DESC").Find(&subOrders).Error; err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	var orderDetailIDs []uint
+	for _, subOrder := range subOrders {
+		orderDetailIDs = append(orderDetailIDs, subOrder.OrderDetailID)
+	}
+
+	var orders []models.OrderDetail
+	if err := db.Where("id IN ?", orderDetailIDs).Find(&orders).Error; err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	ordersByID := make(map[uint]models.OrderDetail)
+	for _, order := range orders {
+		ordersByID[order.ID] = order
+	}
+
+	sellerOrdersResponse := []models.SellerOrderResponse{}
+	for i := range subOrders {
+		var sellerOrderResponse models.SellerOrderResponse
+		copier.Copy(&sellerOrderResponse.SubOrderResponse, &subOrders[i])
+
+		order := ordersByID[subOrders[i].OrderDetailID]
+		sellerOrderResponse.UserID = order.UserID
+		sellerOrderResponse.ShippingAddress = order.ShippingAddress
+
+		sellerOrdersResponse = append(sellerOrdersResponse, sellerOrderResponse)
+	}
+
+	response := utils.ResponseAPI("Get seller orders success!", http.StatusOK, "success", sellerOrdersResponse)
+	c.JSON(http.StatusOK, response)
+}
+
+// Invoked by payment service
+func RefundOrder(c *gin.Context) {
+	// Payment service sends the total refunded so far, so a repeated notification changes nothing
+	// Refund of a seller's items: take it off their sub-order payout, once per refund
+	// Fully refunded: move order and its sub-orders to refunded
+	// Partially refunded: set refund status of the order, its status follows the fulfilment of the remaining items
+	db := c.MustGet("db").(*gorm.DB)
+	var refundInput models.OrderRefundInput
+
+	if err := c.ShouldBindJSON(&refundInput); err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusBadRequest, "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	var order models.OrderDetail
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, refundInput.OrderDetailID).Error; err != nil {
+			return err
+		}
+
+		// Notifications can come out of order, each refund is applied to its sub-order on its own
+		if refundInput.RefundID != 0 && refundInput.SellerID != 0 {
+			if err := models.ApplySubOrderRefund(tx, order.ID, refundInput.SellerID, refundInput.RefundID, refundInput.Amount); err != nil {
+				return err
+			}
+		}
+
+		// Already applied
+		fullyApplied := !refundInput.FullyRefunded || order.RefundStatus == models.StatusRefunded
+		if refundInput.RefundedAmount <= order.RefundedAmount && fullyApplied {
+			return nil
+		}
+
+		note := fmt.Sprintf("Refunded %d of %d", refundInput.RefundedAmount, order.Total)
+		return order.Refund(tx, refundInput.RefundedAmount, refundInput.FullyRefunded, note)
+	})
+
+	if err == gorm.ErrRecordNotFound {
+		response := utils.ResponseAPI("Order detail not found!", http.StatusNotFound, "error", nil)
+		c.JSON(http.StatusNotFound, response)
+		return
+	}
+
+	if err == models.ErrSubOrderNotFound {
+		response := utils.ResponseAPI(err.Error(), http.StatusNotFound, "error", nil)
+		c.JSON(http.StatusNotFound, response)
+		return
+	}
+
+	if err == models.ErrInvalidTransition {
+		response := utils.ResponseAPI(fmt.Sprintf("Order with status %s can't be refunded!", order.Status), http.StatusConflict, "error", nil)
+		c.JSON(http.StatusConflict, response)
+		return
+	}
+
+	if err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	response := utils.ResponseAPI("Order refund recorded successfully!", http.StatusOK, "success", gin.H{"status": order.Status, "refund_status": order.RefundStatus, "refunded_amount": order.RefundedAmount})
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,101 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/tengkuroman/microshop/order-service/models"
+)
+
+var (
+	errPaymentNotCommitted = errors.New("Payment record not committed!")
+	errPaymentNotFound     = errors.New("Payment not found!")
+)
+
+// Error response from payment service, e.g. 402 when payment declined
+type paymentError struct {
+	Code    int
+	Message string
+}
+
+func (e *paymentError) Error() string {
+	return e.Message
+}
+
+// Charge order total through its payment provider, returns the payment ID.
+// Payment service replays the first result for the same idempotency key, and answers an order already paid
+// with a different key with its existing payment, returned here as well to be verified.
+func processPayment(order models.OrderDetail, idempotencyKey string) (uint, error) {
+	request := models.PaymentRequest{
+		OrderID:           order.ID,
+		Total:             order.Total,
+		PaymentProviderID: order.PaymentProviderID,
+	}
+
+	client := resty.New()
+	res, err := client.R().SetHeader("Idempotency-Key", idempotencyKey).SetBody(request).SetResult(&models.PaymentResponse{}).SetError(&models.PaymentResponse{}).Post("http://" + paymentBaseURL + "/payment/process")
+	if err != nil {
+		return 0, err
+	}
+
+	if res.StatusCode() != http.StatusOK {
+		message := res.Status()
+		if paymentResponse, ok := res.Error().(*models.PaymentResponse); ok {
+			if res.StatusCode() == http.StatusConflict && paymentResponse.Data.ID != 0 {
+				return paymentResponse.Data.ID, nil
+			}
+
+			if paymentResponse.Message != "" {
+				message = paymentResponse.Message
+			} else if paymentResponse.Meta.Message != "" {
+				message = paymentResponse.Meta.Message
+			}
+		}
+
+		return 0, &paymentError{Code: res.StatusCode(), Message: message}
+	}
+
+	return res.Result().(*models.PaymentResponse).Data.ID, nil
+}
+
+// Check payment service has a committed payment record of the order total
+func verifyPayment(paymentID uint, order models.OrderDetail) error {
+	client := resty.New()
+	res, err := client.R().SetResult(&models.PaymentResponse{}).Get("http://" + paymentBaseURL + "/payment/" + strconv.FormatUint(uint64(paymentID), 10))
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode() != http.StatusOK {
+		return errPaymentNotCommitted
+	}
+
+	payment := res.Result().(*models.PaymentResponse).Data
+	if payment.Status != models.PaymentCommitted || payment.OrderID != order.ID || payment.Amount != order.Total {
+		return errPaymentNotCommitted
+	}
+
+	return nil
+}
+
+// Payment of the order that isn't failed, errPaymentNotFound when the order was never charged
+func findOrderPayment(order models.OrderDetail) (models.PaymentResponse, error) {
+	client := resty.New()
+	res, err := client.R().SetResult(&models.PaymentResponse{}).Get("http://" + paymentBaseURL + "/order/" + strconv.FormatUint(uint64(order.ID), 10) + "/payment")
+	if err != nil {
+		return models.PaymentResponse{}, err
+	}
+
+	if res.StatusCode() == http.StatusNotFound {
+		return models.PaymentResponse{}, errPaymentNotFound
+	}
+
+	if res.StatusCode() != http.StatusOK {
+		return models.PaymentResponse{}, fmt.Errorf("Get payment of order %d failed: %s", order.ID, res.Status())
+	}
+
+	return *res.Result().(*models.PaymentResponse), nil
+}
@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/tengkuroman/microshop/order-service/models"
+	"github.com/tengkuroman/microshop/order-service/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Connection to product service (stock) config
+var (
+	stockHost    = os.Getenv("STOCK_HOST")
+	stockPort    = os.Getenv("STOCK_PORT")
+	stockBaseURL = fmt.Sprintf("%s:%s", stockHost, stockPort)
+)
+
+// Error response from product service, e.g. 409 when stock is insufficient
+type stockError struct {
+	Code    int
+	Message string
+}
+
+func (e *stockError) Error() string {
+	return e.Message
+}
+
+func invokeStock(path string, body interface{}) error {
+	client := resty.New()
+	res, err := client.R().SetBody(body).SetError(&models.StockResponse{}).Post("http://" + stockBaseURL + path)
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode() != http.StatusOK {
+		message := res.Status()
+		if stockResponse, ok := res.Error().(*models.StockResponse); ok && stockResponse.Meta.Message != "" {
+			message = stockResponse.Meta.Message
+		}
+
+		return &stockError{Code: res.StatusCode(), Message: message}
+	}
+
+	return nil
+}
+
+// Respond a stock error, 409 when product service has not enough stock
+func stockErrorResponse(c *gin.Context, err error) {
+	var stockErr *stockError
+	if errors.As(err, &stockErr) && stockErr.Code == http.StatusConflict {
+		response := utils.ResponseAPI(stockErr.Message, http.StatusConflict, "error", nil)
+		c.JSON(http.StatusConflict, response)
+		return
+	}
+
+	response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
+	c.JSON(http.StatusInternalServerError, response)
+}
+
+// Hold stock of order items, reserving again renews the reservation
+func reserveStock(order models.OrderDetail, items []models.OrderItem) error {
+	request := models.StockReserveRequest{OrderID: order.ID}
+	for i := range items {
+		request.Items = append(request.Items, models.StockItemRequest{
+			ProductID: items[i].ProductID,
+			Quantity:  items[i].Quantity,
+		})
+	}
+
+	return invokeStock("/stock/reserve", request)
+}
+
+func releaseStock(order models.OrderDetail) error {
+	return invokeStock("/stock/release", models.StockOrderRequest{OrderID: order.ID})
+}
+
+func commitStock(order models.OrderDetail) error {
+	return invokeStock("/stock/commit", models.StockOrderRequest{OrderID: order.ID})
+}
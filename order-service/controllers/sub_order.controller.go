@@ -0,0 +1,175 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/tengkuroman/microshop/common/auth"
+	"github.com/tengkuroman/microshop/order-service/models"
+	"github.com/tengkuroman/microshop/order-service/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Actors the logged in user can act as for the sub-order: buyer (order owner), seller (sub-order owner), admin
+func subOrderActors(c *gin.Context, order models.OrderDetail, subOrder models.SubOrder) []string {
+	var actors []string
+	userID := auth.UserID(c)
+
+	if order.UserID == userID {
+		actors = append(actors, models.ActorBuyer)
+	}
+
+	if subOrder.SellerID == userID {
+		actors = append(actors, models.ActorSeller)
+	}
+
+	if auth.HasRole(c, auth.RoleAdmin) {
+		actors = append(actors, models.ActorAdmin)
+	}
+
+	return actors
+}
+
+// @Summary 	Change sub-order status.
+// @Description Move the sub-order of a seller to the next status. Seller can process and ship (with courier and tracking number), buyer can confirm delivery, admin can do both. The order follows its least fulfilled sub-order, delivery makes the seller payout due.
+// @Tags 		Order Service
+// @Param 		body body models.SubOrderStatusInput false "Optional note, courier and tracking number when shipped."
+// @Produce 	json
+// @Success 	200 {object} map[string]interface{}
+// @Router 		/auth/order/v1/order/sub/status/{sub_order_id}/{status} [patch]
+// @Param 		sub_order_id path int true "Param required."
+// @Param 		status path string true "Available status: processing, shipped, delivered"
+// @Security 	BearerToken
+func UpdateSubOrderStatus(c *gin.Context) {
+	// Check if a sub-order exist based on param :sub_order_id
+	// 		If sub-order exist then check what the user is to the sub-order (buyer, seller, admin)
+	//			Allowed to change current status to requested status?
+	//				OK: Lock the order, change sub-order status, record shipping, record order history,
+	//					move the order as far as its least fulfilled sub-order
+	//				Not OK: Return message "Order status change not allowed!"
+	//		If sub-order not exist then return "sub-order not found"
+	db := c.MustGet("db").(*gorm.DB)
+
+	var subOrder models.SubOrder
+	if err := db.Where("id = ?", c.Param("sub_order_id")).First(&subOrder).Error; err != nil {
+		response := utils.ResponseAPI("Sub-order not found!", http.StatusBadRequest, "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	var statusInput models.SubOrderStatusInput
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&statusInput); err != nil {
+			response := utils.ResponseAPI(err.Error(), http.StatusBadRequest, "error", nil)
+			c.JSON(http.StatusBadRequest, response)
+			return
+		}
+	}
+
+	var order models.OrderDetail
+	if err := db.First(&order, subOrder.OrderDetailID).Error; err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	actors := subOrderActors(c, order, subOrder)
+	if len(actors) == 0 {
+		response := utils.ResponseAPI("You can only update your order!", http.StatusForbidden, "forbidden", nil)
+		c.JSON(http.StatusForbidden, response)
+		return
+	}
+
+	newStatus := c.Param("status")
+
+	actor, err := models.AllowedSubOrderActor(subOrder.Status, newStatus, actors)
+	if err != nil {
+		response := utils.ResponseAPI(fmt.Sprintf("Sub-order status can't be changed from %s to %s!", subOrder.Status, newStatus), http.StatusBadRequest, "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	// Order is locked first, the same as its status changes cascading to the sub-orders
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, subOrder.OrderDetailID).Error; err != nil {
+			return err
+		}
+
+		if newStatus == models.StatusShipped {
+			err := tx.Model(&subOrder).Updates(models.SubOrder{Courier: statusInput.Courier, TrackingNumber: statusInput.TrackingNumber}).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		if err := subOrder.Transition(tx, newStatus, actor, auth.UserID(c), statusInput.Note); err != nil {
+			return err
+		}
+
+		return models.RollUpOrderStatus(tx, &order)
+	})
+
+	if err == models.ErrInvalidTransition {
+		response := utils.ResponseAPI("Order status changed by another request, please try again!", http.StatusConflict, "error", nil)
+		c.JSON(http.StatusConflict, response)
+		return
+	}
+
+	if err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	response := utils.ResponseAPI("Sub-order status changed successfully!", http.StatusOK, "success", gin.H{"status": subOrder.Status, "order_status": order.Status})
+	c.JSON(http.StatusOK, response)
+}
+
+// @Summary 	Record sub-order payout (role: admin)
+// @Description Record that the subtotal of a delivered sub-order was paid out to its seller.
+// @Tags 		Order Service
+// @Produce 	json
+// @Success 	200 {object} map[string]interface{}
+// @Router 		/auth/order/v1/order/sub/payout/{sub_order_id} [patch]
+// @Param 		sub_order_id path int true "Param required."
+// @Security 	BearerToken
+func PayOutSubOrder(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+
+	subOrderID, err := strconv.ParseUint(c.Param("sub_order_id"), 10, 32)
+	if err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusBadRequest, "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		return models.PayOutSubOrder(tx, uint(subOrderID))
+	})
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		response := utils.ResponseAPI("Sub-order not found!", http.StatusNotFound, "error", nil)
+		c.JSON(http.StatusNotFound, response)
+		return
+	}
+
+	if err == models.ErrPayoutNotDue {
+		response := utils.ResponseAPI(err.Error(), http.StatusConflict, "error", nil)
+		c.JSON(http.StatusConflict, response)
+		return
+	}
+
+	if err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	response := utils.ResponseAPI("Sub-order payout recorded!", http.StatusOK, "success", nil)
+	c.JSON(http.StatusOK, response)
+}
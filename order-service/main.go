@@ -6,6 +6,8 @@ import (
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/tengkuroman/microshop/common/auth"
+	"github.com/tengkuroman/microshop/common/idempotency"
 	"github.com/tengkuroman/microshop/order-service/config"
 	"github.com/tengkuroman/microshop/order-service/controllers"
 	"golang.org/x/sync/errgroup"
@@ -36,11 +38,28 @@ func routeAuth(key string, value interface{}) http.Handler {
 		c.Set(key, value)
 	})
 
+	// Every route needs a logged in user
+	r.Use(auth.RequireAuth())
+
 	// Routes (user)
+	orderOwner := auth.RequireOwner(controllers.OrderOwner)
 	r.GET("/orders", controllers.GetOrdersDetail)
-	r.DELETE("/order/delete/:order_detail_id", controllers.DeleteOrder)
-	r.PATCH("/order/payment/:order_detail_id/:payment_provider_id", controllers.SelectPaymentProvider)
-	r.PATCH("/order/payment/checkout/:order_detail_id", controllers.PayOrder)
+	r.DELETE("/order/delete/:order_detail_id", orderOwner, controllers.DeleteOrder)
+	r.PATCH("/order/payment/:order_detail_id/:payment_provider_id", orderOwner, controllers.SelectPaymentProvider)
+	r.PATCH("/order/payment/checkout/:order_detail_id", orderOwner, idempotency.Idempotent(), controllers.PayOrder)
+
+	// Routes (buyer, seller, admin of the order, checked per status change)
+	r.PATCH("/order/status/:order_detail_id/:status", controllers.UpdateOrderStatus)
+	r.GET("/order/history/:order_detail_id", controllers.GetOrderHistory)
+
+	// Routes (buyer, seller, admin of the sub-order, checked per status change)
+	r.PATCH("/order/sub/status/:sub_order_id/:status", controllers.UpdateSubOrderStatus)
+
+	// Routes (seller)
+	r.GET("/orders/seller", auth.RequireRole(auth.RoleSeller), controllers.GetSellerOrders)
+
+	// Routes (admin)
+	r.PATCH("/order/sub/payout/:sub_order_id", auth.RequireRole(auth.RoleAdmin), controllers.PayOutSubOrder)
 
 	return r
 }
@@ -58,6 +77,8 @@ func routeService(key string, value interface{}) http.Handler {
 
 	// Routes (service)
 	r.POST("/order", controllers.CreateOrder)
+	r.GET("/order/:order_detail_id", controllers.GetOrderDetail)
+	r.POST("/order/refund", controllers.RefundOrder)
 
 	return r
 }
@@ -68,6 +89,9 @@ func main() {
 	databaseSQL, _ := db.DB()
 	defer databaseSQL.Close()
 
+	// Cancel orders not paid in time
+	go controllers.CancelUnpaidOrders(db)
+
 	serverNonAuth := &http.Server{
 		Addr:    ":8080",
 		Handler: routeNonAuth(),
@@ -0,0 +1,22 @@
+package models
+
+// Shipping address snapshotted to the order, so changing the address book doesn't change placed orders
+type ShippingAddress struct {
+	Label      string `json:"label"`
+	Recipient  string `json:"recipient"`
+	Street     string `json:"street"`
+	City       string `json:"city"`
+	PostalCode string `json:"postal_code"`
+	Country    string `json:"country"`
+	Phone      string `json:"phone"`
+}
+
+// Model for service invocation to user service
+type AddressResponse struct {
+	Meta struct {
+		Message string `json:"message"`
+		Code    int    `json:"code"`
+		Status  string `json:"status"`
+	} `json:"meta"`
+	Data ShippingAddress `json:"data"`
+}
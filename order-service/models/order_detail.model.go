@@ -5,17 +5,40 @@ import "gorm.io/gorm"
 type OrderDetail struct {
 	gorm.Model
 	Total             int
-	PaymentStatus     string
+	Status            string `gorm:"index"`
 	UserID            uint
 	PaymentProviderID uint
+	PaymentID         uint            // committed payment record in payment service
+	RefundedAmount    int             // refunded so far by payment service
+	RefundStatus      string          // partially_refunded or refunded, empty when nothing is refunded
+	CheckoutID        *uint           `gorm:"uniqueIndex"` // shopping service checkout that created the order
+	ShippingAddress   ShippingAddress `gorm:"embedded;embeddedPrefix:shipping_"`
 	OrderItem         []OrderItem
+	SubOrder          []SubOrder // one per seller
+	OrderHistory      []OrderHistory
 }
 
 type OrderDetailResponse struct {
 	ID                uint                `json:"id"`
 	Total             int                 `json:"total"`
-	PaymentStatus     string              `json:"payment_status"`
+	Status            string              `json:"status"`
 	UserID            uint                `json:"user_id"`
 	PaymentProviderID uint                `json:"payment_provider_id"`
-	OrderItemResponse []OrderItemResponse `json:"order_item"`
+	PaymentID         uint                `json:"payment_id"`
+	RefundedAmount    int                 `json:"refunded_amount"`
+	RefundStatus      string              `json:"refund_status"`
+	ShippingAddress   ShippingAddress     `json:"shipping_address"`
+	OrderItem         []OrderItemResponse `json:"order_item"`
+	SubOrder          []SubOrderResponse  `json:"sub_order"`
+}
+
+// Remove an order that was never placed (e.g. its stock couldn't be reserved) with its rows, so its checkout can create it again
+func PurgeOrder(tx *gorm.DB, orderDetailID uint) error {
+	for _, model := range []interface{}{&OrderHistory{}, &OrderItem{}, &SubOrder{}} {
+		if err := tx.Unscoped().Where("order_detail_id = ?", orderDetailID).Delete(model).Error; err != nil {
+			return err
+		}
+	}
+
+	return tx.Unscoped().Delete(&OrderDetail{}, orderDetailID).Error
 }
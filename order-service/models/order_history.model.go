@@ -0,0 +1,176 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Order status
+const (
+	StatusPendingPayment    = "pending_payment"
+	StatusPaid              = "paid"
+	StatusProcessing        = "processing"
+	StatusShipped           = "shipped"
+	StatusDelivered         = "delivered"
+	StatusCancelled         = "cancelled"
+	StatusRefunded          = "refunded"
+	StatusPartiallyRefunded = "partially_refunded"
+)
+
+// Who changes the order status
+const (
+	ActorBuyer  = "buyer"
+	ActorSeller = "seller"
+	ActorAdmin  = "admin"
+	ActorSystem = "system" // services, e.g. paid after payment processed
+)
+
+var ErrInvalidTransition = errors.New("Order status change not allowed!")
+
+// Allowed transitions: current status -> next status -> actors allowed to change it.
+// Processing, shipped and delivered are rolled up from the sub-orders, sellers fulfil their sub-order only.
+// A partial refund is kept in the refund status, the order goes on being fulfilled.
+var orderTransitions = map[string]map[string][]string{
+	StatusPendingPayment: {
+		StatusPaid:      {ActorSystem},
+		StatusCancelled: {ActorBuyer, ActorAdmin, ActorSystem},
+	},
+	StatusPaid: {
+		StatusProcessing: {ActorSystem},
+		StatusRefunded:   {ActorSystem},
+	},
+	StatusProcessing: {
+		StatusShipped:  {ActorSystem},
+		StatusRefunded: {ActorSystem},
+	},
+	StatusShipped: {
+		StatusDelivered: {ActorSystem},
+		StatusRefunded:  {ActorSystem},
+	},
+	StatusDelivered: {
+		StatusRefunded: {ActorSystem},
+	},
+}
+
+// Order status changes done per sub-order since orders are split per seller. Still accepted on the order,
+// where they move the sub-orders of the user, until clients use the sub-order status.
+var DeprecatedOrderTransitions = map[string]bool{
+	StatusProcessing: true,
+	StatusShipped:    true,
+	StatusDelivered:  true,
+}
+
+// Every status change of an order and its sub-orders
+type OrderHistory struct {
+	gorm.Model
+	OrderDetailID uint `gorm:"index"`
+	SubOrderID    uint `gorm:"index"` // 0 for status changes of the order itself
+	FromStatus    string
+	ToStatus      string
+	ActorID       uint
+	ActorRole     string
+	Note          string
+}
+
+type OrderHistoryResponse struct {
+	SubOrderID uint      `json:"sub_order_id"`
+	FromStatus string    `json:"from_status"`
+	ToStatus   string    `json:"to_status"`
+	ActorID    uint      `json:"actor_id"`
+	ActorRole  string    `json:"actor_role"`
+	Note       string    `json:"note"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type OrderStatusInput struct {
+	Note string `json:"note"`
+}
+
+// Return first of the actors allowed to move order from status to next status
+func AllowedActor(from string, to string, actors []string) (string, error) {
+	return allowedActor(orderTransitions, from, to, actors)
+}
+
+func allowedActor(transitions map[string]map[string][]string, from string, to string, actors []string) (string, error) {
+	allowed, ok := transitions[from][to]
+	if !ok {
+		return "", ErrInvalidTransition
+	}
+
+	for _, actor := range actors {
+		for _, allowedActor := range allowed {
+			if actor == allowedActor {
+				return actor, nil
+			}
+		}
+	}
+
+	return "", ErrInvalidTransition
+}
+
+// Change order status and record it to order history.
+// Fails with ErrInvalidTransition when status was changed by another request meanwhile.
+func (o *OrderDetail) Transition(tx *gorm.DB, to string, actor string, actorID uint, note string) error {
+	from := o.Status
+	if _, err := AllowedActor(from, to, []string{actor}); err != nil {
+		return err
+	}
+
+	result := tx.Model(&OrderDetail{}).Where("id = ? AND status = ?", o.ID, from).Update("status", to)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrInvalidTransition
+	}
+
+	o.Status = to
+
+	return tx.Create(&OrderHistory{
+		OrderDetailID: o.ID,
+		FromStatus:    from,
+		ToStatus:      to,
+		ActorID:       actorID,
+		ActorRole:     actor,
+		Note:          note,
+	}).Error
+}
+
+// Record a refund of the order (locked by the caller). A full refund refunds the order and every sub-order,
+// a partial refund only changes the refund status so the remaining items are still fulfilled.
+func (o *OrderDetail) Refund(tx *gorm.DB, refundedAmount int, fully bool, note string) error {
+	refundStatus := StatusRefunded
+
+	if fully {
+		if err := o.Transition(tx, StatusRefunded, ActorSystem, 0, note); err != nil {
+			return err
+		}
+
+		if err := TransitionSubOrders(tx, o.ID, StatusRefunded, note); err != nil {
+			return err
+		}
+	} else {
+		if _, ok := fulfilmentRank[o.Status]; !ok {
+			return ErrInvalidTransition
+		}
+
+		refundStatus = StatusPartiallyRefunded
+		if err := tx.Create(&OrderHistory{
+			OrderDetailID: o.ID,
+			FromStatus:    o.Status,
+			ToStatus:      StatusPartiallyRefunded,
+			ActorRole:     ActorSystem,
+			Note:          note,
+		}).Error; err != nil {
+			return err
+		}
+	}
+
+	o.RefundedAmount = refundedAmount
+	o.RefundStatus = refundStatus
+
+	return tx.Model(o).Updates(map[string]interface{}{"refunded_amount": refundedAmount, "refund_status": refundStatus}).Error
+}
@@ -0,0 +1,64 @@
+package models
+
+import "testing"
+
+func TestAllowedActor(t *testing.T) {
+	tests := []struct {
+		name    string
+		from    string
+		to      string
+		actors  []string
+		want    string
+		wantErr bool
+	}{
+		{"system marks paid", StatusPendingPayment, StatusPaid, []string{ActorSystem}, ActorSystem, false},
+		{"buyer can't mark paid", StatusPendingPayment, StatusPaid, []string{ActorBuyer}, "", true},
+		{"buyer cancels unpaid order", StatusPendingPayment, StatusCancelled, []string{ActorBuyer}, ActorBuyer, false},
+		{"admin cancels unpaid order", StatusPendingPayment, StatusCancelled, []string{ActorAdmin}, ActorAdmin, false},
+		{"first allowed actor is returned", StatusPendingPayment, StatusCancelled, []string{ActorSeller, ActorBuyer, ActorAdmin}, ActorBuyer, false},
+		{"paid order can't be cancelled", StatusPaid, StatusCancelled, []string{ActorBuyer, ActorAdmin, ActorSystem}, "", true},
+		{"fulfilment is rolled up by system", StatusPaid, StatusProcessing, []string{ActorSystem}, ActorSystem, false},
+		{"seller can't fulfil the order", StatusPaid, StatusProcessing, []string{ActorSeller}, "", true},
+		{"status can't be skipped", StatusPaid, StatusShipped, []string{ActorSystem}, "", true},
+		{"delivered order is refunded", StatusDelivered, StatusRefunded, []string{ActorSystem}, ActorSystem, false},
+		{"partial refund is not an order status", StatusPaid, StatusPartiallyRefunded, []string{ActorSystem}, "", true},
+		{"cancelled order is final", StatusCancelled, StatusPaid, []string{ActorSystem}, "", true},
+		{"refunded order is final", StatusRefunded, StatusDelivered, []string{ActorSystem}, "", true},
+		{"unknown status", "lost", StatusPaid, []string{ActorSystem}, "", true},
+		{"no actors", StatusPendingPayment, StatusCancelled, nil, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := AllowedActor(tt.from, tt.to, tt.actors)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("AllowedActor(%s, %s, %v) error = %v, want error %v", tt.from, tt.to, tt.actors, err, tt.wantErr)
+			}
+
+			if err != nil && err != ErrInvalidTransition {
+				t.Fatalf("AllowedActor(%s, %s, %v) error = %v, want %v", tt.from, tt.to, tt.actors, err, ErrInvalidTransition)
+			}
+
+			if got != tt.want {
+				t.Errorf("AllowedActor(%s, %s, %v) = %q, want %q", tt.from, tt.to, tt.actors, got, tt.want)
+			}
+		})
+	}
+}
+
+// Deprecated order status changes are the ones moving sub-orders, not allowed on the order by anyone but system
+func TestDeprecatedOrderTransitions(t *testing.T) {
+	for status := range DeprecatedOrderTransitions {
+		if _, ok := fulfilmentRank[status]; !ok {
+			t.Errorf("deprecated order status %s is not a fulfilment status", status)
+		}
+
+		for from := range orderTransitions {
+			for _, actor := range []string{ActorBuyer, ActorSeller, ActorAdmin} {
+				if _, err := AllowedActor(from, status, []string{actor}); err == nil {
+					t.Errorf("%s can move the order from %s to %s, fulfilment is rolled up from sub-orders", actor, from, status)
+				}
+			}
+		}
+	}
+}
@@ -2,15 +2,23 @@ package models
 
 import "gorm.io/gorm"
 
+// Price, product name and seller are snapshotted from product service when the order is created
 type OrderItem struct {
 	gorm.Model
 	Quantity      int
 	ProductID     uint
+	ProductName   string
+	Price         int
+	SellerID      uint
 	OrderDetailID uint
+	SubOrderID    uint `gorm:"index"` // sub-order of the seller
 }
 
 type OrderItemResponse struct {
-	ID        uint `json:"id"`
-	Quantity  uint `json:"quantity"`
-	ProductID uint `json:"product_id"`
+	ID          uint   `json:"id"`
+	Quantity    uint   `json:"quantity"`
+	ProductID   uint   `json:"product_id"`
+	ProductName string `json:"product_name"`
+	Price       int    `json:"price"`
+	SellerID    uint   `json:"seller_id"`
 }
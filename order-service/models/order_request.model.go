@@ -7,11 +7,22 @@ type CartItemInput struct {
 }
 
 type ShoppingSessionInput struct {
-	Total  int  `binding:"required" json:"total"`
 	UserID uint `json:"user_id" binding:"required"`
 }
 
 type OrderInput struct {
-	Session ShoppingSessionInput `binding:"required" json:"session"`
-	Items   []CartItemInput      `binding:"required" json:"items"`
+	CheckoutID uint                 `json:"checkout_id"`
+	AddressID  uint                 `json:"address_id"` // 0 for the default address of the user
+	Session    ShoppingSessionInput `binding:"required" json:"session"`
+	Items      []CartItemInput      `binding:"required" json:"items"`
+}
+
+// Model for service invocation from payment service
+type OrderRefundInput struct {
+	OrderDetailID  uint `json:"order_detail_id" binding:"required"`
+	RefundedAmount int  `json:"refunded_amount" binding:"required,gt=0"` // total refunded so far
+	FullyRefunded  bool `json:"fully_refunded"`
+	RefundID       uint `json:"refund_id"`
+	SellerID       uint `json:"seller_id"` // refunded items of the seller are taken off their payout
+	Amount         int  `json:"amount"`    // amount of this refund
 }
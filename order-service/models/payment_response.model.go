@@ -0,0 +1,30 @@
+package models
+
+// Model for service invocation to payment service
+type PaymentRequest struct {
+	OrderID           uint `json:"order_id"`
+	Total             int  `json:"total"`
+	PaymentProviderID uint `json:"payment_provider_id"`
+}
+
+type PaymentResponse struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	Meta    struct {
+		Message string `json:"message"`
+	} `json:"meta"` // error responses of payment service middlewares
+	Data struct {
+		ID                uint   `json:"id"`
+		OrderID           uint   `json:"order_id"`
+		Amount            int    `json:"amount"`
+		Currency          string `json:"currency"`
+		Status            string `json:"status"`
+		ProviderReference string `json:"provider_reference"`
+	} `json:"data"`
+}
+
+// Payment status
+const (
+	PaymentPending   = "pending"
+	PaymentCommitted = "committed"
+)
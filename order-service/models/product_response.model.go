@@ -0,0 +1,11 @@
+package models
+
+// Model for service invocation to product service
+type ProductResponse struct {
+	Data struct {
+		ID     uint   `json:"id"`
+		Name   string `json:"name"`
+		Price  int    `json:"price"`
+		UserID uint   `json:"seller_id"`
+	} `json:"data"`
+}
@@ -0,0 +1,24 @@
+package models
+
+// Model for service invocation to product service (stock)
+type StockItemRequest struct {
+	ProductID uint `json:"product_id"`
+	Quantity  int  `json:"quantity"`
+}
+
+type StockReserveRequest struct {
+	OrderID uint               `json:"order_id"`
+	Items   []StockItemRequest `json:"items"`
+}
+
+type StockOrderRequest struct {
+	OrderID uint `json:"order_id"`
+}
+
+type StockResponse struct {
+	Meta struct {
+		Message string `json:"message"`
+		Code    int    `json:"code"`
+		Status  string `json:"status"`
+	} `json:"meta"`
+}
@@ -0,0 +1,298 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Payout status of a sub-order
+const (
+	PayoutPending   = "pending"   // sub-order not delivered yet
+	PayoutDue       = "due"       // delivered, to be paid out to the seller
+	PayoutPaid      = "paid"      // paid out to the seller
+	PayoutCancelled = "cancelled" // sub-order cancelled or refunded before it was paid out
+)
+
+var (
+	ErrPayoutNotDue     = errors.New("Payout is not due!")
+	ErrSubOrderNotFound = errors.New("Sub-order of the seller not found!")
+)
+
+// Allowed transitions of a sub-order: current status -> next status -> actors allowed to change it.
+// Paid, cancelled and refunded follow the order.
+var subOrderTransitions = map[string]map[string][]string{
+	StatusPendingPayment: {
+		StatusPaid:      {ActorSystem},
+		StatusCancelled: {ActorSystem},
+	},
+	StatusPaid: {
+		StatusProcessing: {ActorSeller, ActorAdmin},
+		StatusRefunded:   {ActorSystem},
+	},
+	StatusProcessing: {
+		StatusShipped:  {ActorSeller, ActorAdmin},
+		StatusRefunded: {ActorSystem},
+	},
+	StatusShipped: {
+		StatusDelivered: {ActorBuyer, ActorAdmin},
+		StatusRefunded:  {ActorSystem},
+	},
+	StatusDelivered: {
+		StatusRefunded: {ActorSystem},
+	},
+}
+
+// Fulfilment progress, the order is as far as its least fulfilled sub-order
+var fulfilmentRank = map[string]int{
+	StatusPaid:       1,
+	StatusProcessing: 2,
+	StatusShipped:    3,
+	StatusDelivered:  4,
+}
+
+// Portion of an order sold by one seller, shipped and paid out on its own.
+// Partial refunds of the seller's items are taken off its payout, a full refund refunds every sub-order.
+type SubOrder struct {
+	gorm.Model
+	OrderDetailID  uint `gorm:"uniqueIndex:idx_sub_orders_order_seller,where:deleted_at IS NULL"`
+	SellerID       uint `gorm:"uniqueIndex:idx_sub_orders_order_seller,where:deleted_at IS NULL;index"`
+	Subtotal       int
+	Status         string `gorm:"index"`
+	Courier        string
+	TrackingNumber string
+	ShippedAt      *time.Time
+	DeliveredAt    *time.Time
+	RefundedAmount int    // partial refunds of the seller's items
+	PayoutAmount   int    // subtotal minus refunds made before the payout
+	PayoutStatus   string `gorm:"index"`
+	PaidOutAt      *time.Time
+	OrderItem      []OrderItem
+}
+
+// Courier and tracking number are recorded when the sub-order is shipped
+type SubOrderStatusInput struct {
+	Note           string `json:"note"`
+	Courier        string `json:"courier" binding:"max=100"`
+	TrackingNumber string `json:"tracking_number" binding:"max=100"`
+}
+
+type SubOrderResponse struct {
+	ID             uint                `json:"id"`
+	OrderDetailID  uint                `json:"order_detail_id"`
+	SellerID       uint                `json:"seller_id"`
+	Subtotal       int                 `json:"subtotal"`
+	Status         string              `json:"status"`
+	Courier        string              `json:"courier"`
+	TrackingNumber string              `json:"tracking_number"`
+	ShippedAt      *time.Time          `json:"shipped_at"`
+	DeliveredAt    *time.Time          `json:"delivered_at"`
+	RefundedAmount int                 `json:"refunded_amount"`
+	PayoutAmount   int                 `json:"payout_amount"`
+	PayoutStatus   string              `json:"payout_status"`
+	PaidOutAt      *time.Time          `json:"paid_out_at"`
+	OrderItem      []OrderItemResponse `json:"order_item"`
+}
+
+// Sub-order of a seller with the buyer and where to ship it
+type SellerOrderResponse struct {
+	SubOrderResponse
+	UserID          uint            `json:"user_id"`
+	ShippingAddress ShippingAddress `json:"shipping_address"`
+}
+
+// Split order items per seller, the items are linked to their sub-order when both are created
+func SplitSubOrders(items []OrderItem) []SubOrder {
+	var subOrders []SubOrder
+	index := make(map[uint]int)
+
+	for _, item := range items {
+		i, ok := index[item.SellerID]
+		if !ok {
+			i = len(subOrders)
+			index[item.SellerID] = i
+			subOrders = append(subOrders, SubOrder{
+				SellerID:     item.SellerID,
+				Status:       StatusPendingPayment,
+				PayoutStatus: PayoutPending,
+			})
+		}
+
+		subOrders[i].Subtotal += item.Price * item.Quantity
+		subOrders[i].PayoutAmount = subOrders[i].Subtotal
+	}
+
+	return subOrders
+}
+
+// Return first of the actors allowed to move sub-order from status to next status
+func AllowedSubOrderActor(from string, to string, actors []string) (string, error) {
+	return allowedActor(subOrderTransitions, from, to, actors)
+}
+
+// Change sub-order status and record it to order history, delivery makes the payout due.
+// Fails with ErrInvalidTransition when status was changed by another request meanwhile.
+func (s *SubOrder) Transition(tx *gorm.DB, to string, actor string, actorID uint, note string) error {
+	from := s.Status
+	if _, err := AllowedSubOrderActor(from, to, []string{actor}); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{"status": to}
+
+	switch to {
+	case StatusShipped:
+		updates["shipped_at"] = &now
+	case StatusDelivered:
+		updates["delivered_at"] = &now
+		updates["payout_status"] = PayoutDue
+	case StatusCancelled, StatusRefunded:
+		if s.PayoutStatus != PayoutPaid {
+			updates["payout_status"] = PayoutCancelled
+		}
+	}
+
+	result := tx.Model(&SubOrder{}).Where("id = ? AND status = ?", s.ID, from).Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrInvalidTransition
+	}
+
+	if err := tx.First(s, s.ID).Error; err != nil {
+		return err
+	}
+
+	return tx.Create(&OrderHistory{
+		OrderDetailID: s.OrderDetailID,
+		SubOrderID:    s.ID,
+		FromStatus:    from,
+		ToStatus:      to,
+		ActorID:       actorID,
+		ActorRole:     actor,
+		Note:          note,
+	}).Error
+}
+
+// Move every sub-order of the order that can follow it to the status, e.g. paid or cancelled with the order
+func TransitionSubOrders(tx *gorm.DB, orderDetailID uint, to string, note string) error {
+	var subOrders []SubOrder
+	if err := tx.Where("order_detail_id = ?", orderDetailID).Order("id").Find(&subOrders).Error; err != nil {
+		return err
+	}
+
+	for i := range subOrders {
+		if _, err := AllowedSubOrderActor(subOrders[i].Status, to, []string{ActorSystem}); err != nil {
+			continue
+		}
+
+		if err := subOrders[i].Transition(tx, to, ActorSystem, 0, note); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Move the order (locked by the caller) as far as its least fulfilled sub-order
+func RollUpOrderStatus(tx *gorm.DB, order *OrderDetail) error {
+	var statuses []string
+	if err := tx.Model(&SubOrder{}).Where("order_detail_id = ?", order.ID).Pluck("status", &statuses).Error; err != nil {
+		return err
+	}
+
+	target := rollUpStatus(order.Status, statuses)
+	if target == "" {
+		return nil
+	}
+
+	return order.Transition(tx, target, ActorSystem, 0, fmt.Sprintf("Every sub-order reached %s", target))
+}
+
+// Status the order moves to from the statuses of its sub-orders, empty when it stays.
+// Sub-orders not being fulfilled (e.g. refunded) are left out, the order never moves back.
+func rollUpStatus(orderStatus string, subOrderStatuses []string) string {
+	target := ""
+	for _, status := range subOrderStatuses {
+		rank, ok := fulfilmentRank[status]
+		if !ok {
+			continue
+		}
+
+		if target == "" || rank < fulfilmentRank[target] {
+			target = status
+		}
+	}
+
+	if target == "" || fulfilmentRank[target] <= fulfilmentRank[orderStatus] {
+		return ""
+	}
+
+	if _, err := AllowedActor(orderStatus, target, []string{ActorSystem}); err != nil {
+		return ""
+	}
+
+	return target
+}
+
+// Refund of a seller's items applied to their sub-order, a refund is applied once however often it is notified
+type SubOrderRefund struct {
+	gorm.Model
+	RefundID   uint `gorm:"uniqueIndex"` // refund in payment service
+	SubOrderID uint `gorm:"index"`
+	Amount     int
+}
+
+// Take a partial refund off the seller's sub-order of the order (locked by the caller), and off its payout unless paid out already
+func ApplySubOrderRefund(tx *gorm.DB, orderDetailID uint, sellerID uint, refundID uint, amount int) error {
+	var subOrder SubOrder
+	err := tx.Where("order_detail_id = ? AND seller_id = ?", orderDetailID, sellerID).First(&subOrder).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrSubOrderNotFound
+	}
+
+	if err != nil {
+		return err
+	}
+
+	result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&SubOrderRefund{RefundID: refundID, SubOrderID: subOrder.ID, Amount: amount})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return result.Error
+	}
+
+	updates := map[string]interface{}{"refunded_amount": gorm.Expr("COALESCE(refunded_amount, 0) + ?", amount)}
+	if subOrder.PayoutStatus != PayoutPaid {
+		updates["payout_amount"] = gorm.Expr("GREATEST(payout_amount - ?, 0)", amount)
+	}
+
+	return tx.Model(&subOrder).Updates(updates).Error
+}
+
+// Record the payout of a delivered sub-order to its seller
+func PayOutSubOrder(tx *gorm.DB, subOrderID uint) error {
+	paidOutAt := time.Now()
+	result := tx.Model(&SubOrder{}).Where("id = ? AND payout_status = ?", subOrderID, PayoutDue).Updates(map[string]interface{}{
+		"payout_status": PayoutPaid,
+		"paid_out_at":   &paidOutAt,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		var subOrder SubOrder
+		if err := tx.First(&subOrder, subOrderID).Error; err != nil {
+			return err
+		}
+
+		return ErrPayoutNotDue
+	}
+
+	return nil
+}
@@ -0,0 +1,74 @@
+package models
+
+import "testing"
+
+func TestAllowedSubOrderActor(t *testing.T) {
+	tests := []struct {
+		name    string
+		from    string
+		to      string
+		actors  []string
+		want    string
+		wantErr bool
+	}{
+		{"seller processes", StatusPaid, StatusProcessing, []string{ActorSeller}, ActorSeller, false},
+		{"admin processes", StatusPaid, StatusProcessing, []string{ActorAdmin}, ActorAdmin, false},
+		{"buyer can't process", StatusPaid, StatusProcessing, []string{ActorBuyer}, "", true},
+		{"seller ships", StatusProcessing, StatusShipped, []string{ActorSeller}, ActorSeller, false},
+		{"buyer can't ship", StatusProcessing, StatusShipped, []string{ActorBuyer}, "", true},
+		{"buyer confirms delivery", StatusShipped, StatusDelivered, []string{ActorBuyer}, ActorBuyer, false},
+		{"seller can't confirm delivery", StatusShipped, StatusDelivered, []string{ActorSeller}, "", true},
+		{"seller buying from themselves confirms as buyer", StatusShipped, StatusDelivered, []string{ActorBuyer, ActorSeller}, ActorBuyer, false},
+		{"status can't be skipped", StatusPaid, StatusShipped, []string{ActorSeller, ActorAdmin}, "", true},
+		{"status can't go back", StatusShipped, StatusProcessing, []string{ActorSeller, ActorAdmin}, "", true},
+		{"unpaid sub-order can't be processed", StatusPendingPayment, StatusProcessing, []string{ActorSeller, ActorAdmin}, "", true},
+		{"paid follows the order", StatusPendingPayment, StatusPaid, []string{ActorSystem}, ActorSystem, false},
+		{"refund follows the order", StatusDelivered, StatusRefunded, []string{ActorSystem}, ActorSystem, false},
+		{"seller can't refund", StatusDelivered, StatusRefunded, []string{ActorSeller}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := AllowedSubOrderActor(tt.from, tt.to, tt.actors)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("AllowedSubOrderActor(%s, %s, %v) error = %v, want error %v", tt.from, tt.to, tt.actors, err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("AllowedSubOrderActor(%s, %s, %v) = %q, want %q", tt.from, tt.to, tt.actors, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRollUpStatus(t *testing.T) {
+	tests := []struct {
+		name             string
+		orderStatus      string
+		subOrderStatuses []string
+		want             string
+	}{
+		{"single sub-order processed", StatusPaid, []string{StatusProcessing}, StatusProcessing},
+		{"order waits for every sub-order", StatusPaid, []string{StatusProcessing, StatusPaid}, ""},
+		{"order follows least fulfilled sub-order", StatusPaid, []string{StatusShipped, StatusProcessing}, StatusProcessing},
+		{"every sub-order shipped", StatusProcessing, []string{StatusShipped, StatusShipped}, StatusShipped},
+		{"every sub-order delivered", StatusShipped, []string{StatusDelivered, StatusDelivered}, StatusDelivered},
+		{"refunded sub-orders are left out", StatusShipped, []string{StatusDelivered, StatusRefunded}, StatusDelivered},
+		{"no sub-order being fulfilled", StatusPaid, []string{StatusRefunded}, ""},
+		{"no sub-orders", StatusPaid, nil, ""},
+		{"order never moves back", StatusShipped, []string{StatusProcessing, StatusShipped}, ""},
+		{"order already there", StatusProcessing, []string{StatusProcessing}, ""},
+		{"status can't be skipped", StatusPaid, []string{StatusShipped}, ""},
+		{"unpaid order waits for payment", StatusPendingPayment, []string{StatusPendingPayment, StatusPendingPayment}, ""},
+		{"refunded order isn't rolled up", StatusRefunded, []string{StatusDelivered}, ""},
+		{"cancelled order isn't rolled up", StatusCancelled, []string{StatusProcessing}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rollUpStatus(tt.orderStatus, tt.subOrderStatuses); got != tt.want {
+				t.Errorf("rollUpStatus(%s, %v) = %q, want %q", tt.orderStatus, tt.subOrderStatuses, got, tt.want)
+			}
+		})
+	}
+}
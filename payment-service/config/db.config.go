@@ -2,8 +2,12 @@ package config
 
 import (
 	"fmt"
+	"log"
 	"os"
+	"strings"
 
+	"github.com/tengkuroman/microshop/common/idempotency"
+	"github.com/tengkuroman/microshop/payment-service/drivers"
 	"github.com/tengkuroman/microshop/payment-service/models"
 
 	"gorm.io/driver/postgres"
@@ -23,7 +27,30 @@ func ConnectDatabase() *gorm.DB {
 		panic(err.Error())
 	}
 
-	db.AutoMigrate(&models.PaymentProvider{})
+	// Refunds made by sellers before refunds were linked to a seller
+	backfillRefundSeller := db.Migrator().HasTable(&models.Refund{}) && !db.Migrator().HasColumn(&models.Refund{}, "SellerID")
+
+	db.AutoMigrate(&models.PaymentProvider{}, &models.Payment{}, &models.Refund{}, &idempotency.Key{})
+
+	// Providers are no longer processed by the fake driver unless chosen
+	db.Exec("ALTER TABLE payment_providers ALTER COLUMN driver DROP DEFAULT")
+
+	// Payments of a provider without registered driver can't be processed, e.g. providers created before drivers
+	// existed or using the fake driver outside development. Set their driver before starting the service.
+	var providers []models.PaymentProvider
+	if err := db.Find(&providers).Error; err != nil {
+		panic(err.Error())
+	}
+
+	for _, provider := range providers {
+		if _, err := drivers.Get(provider.Driver); err != nil {
+			log.Fatalf("Payment provider %s (ID %d) uses driver %q which is not registered! Available drivers: %s\n", provider.Name, provider.ID, provider.Driver, strings.Join(drivers.Names(), ", "))
+		}
+	}
+
+	if backfillRefundSeller {
+		db.Exec("UPDATE refunds SET seller_id = requested_by WHERE requested_role = ?", "seller")
+	}
 
 	return db
 }
@@ -1,9 +1,14 @@
 package controllers
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/jinzhu/copier"
+	"github.com/tengkuroman/microshop/payment-service/drivers"
 	"github.com/tengkuroman/microshop/payment-service/utils"
 
 	"github.com/tengkuroman/microshop/payment-service/models"
@@ -49,7 +54,7 @@ func GetPaymentProviders(c *gin.Context) {
 }
 
 // @Summary 	Post payment provider (role: admin)
-// @Description Post payment provider. Only admin can post it. Switch your role if you are not admin.
+// @Description Post payment provider. Only admin can post it. Driver processing its payments is required.
 // @Tags 		Payment Service
 // @Param 		body body models.PaymentProviderInput true "Body required."
 // @Produce 	json
@@ -57,14 +62,6 @@ func GetPaymentProviders(c *gin.Context) {
 // @Router 		/auth/payment/v1/payment [post]
 // @Security 	BearerToken
 func PostPaymentProvider(c *gin.Context) {
-	userRole := c.Request.Header.Get("X-User-Role")
-
-	if userRole != "admin" {
-		response := utils.ResponseAPI("Only admins can create payment provider!", http.StatusUnauthorized, "unauthorized", nil)
-		c.JSON(http.StatusUnauthorized, response)
-		return
-	}
-
 	db := c.MustGet("db").(*gorm.DB)
 	var paymentProviderInput models.PaymentProviderInput
 
@@ -74,8 +71,15 @@ func PostPaymentProvider(c *gin.Context) {
 		return
 	}
 
+	if _, err := drivers.Get(paymentProviderInput.Driver); err != nil {
+		response := utils.ResponseAPI(fmt.Sprintf("Payment driver not found! Available drivers: %s", strings.Join(drivers.Names(), ", ")), http.StatusBadRequest, "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
 	provider := models.PaymentProvider{
-		Name: paymentProviderInput.Name,
+		Name:   paymentProviderInput.Name,
+		Driver: paymentProviderInput.Driver,
 	}
 
 	if err := db.Create(&provider).Error; err != nil {
@@ -89,7 +93,7 @@ func PostPaymentProvider(c *gin.Context) {
 }
 
 // @Summary 	Update payment provider (role: admin)
-// @Description Update payment provider. Only admin update it. Switch your role if you are not admin.
+// @Description Update payment provider. Only admin update it.
 // @Tags 		Payment Service
 // @Param 		body body models.PaymentProviderInput true "Body required."
 // @Produce 	json
@@ -98,14 +102,6 @@ func PostPaymentProvider(c *gin.Context) {
 // @Param 		payment_provider_id path int true "Param required."
 // @Security 	BearerToken
 func UpdatePaymentProvider(c *gin.Context) {
-	userRole := c.Request.Header.Get("X-User-Role")
-
-	if userRole != "admin" {
-		response := utils.ResponseAPI("Only admins can update payment provider!", http.StatusUnauthorized, "unauthorized", nil)
-		c.JSON(http.StatusUnauthorized, response)
-		return
-	}
-
 	db := c.MustGet("db").(*gorm.DB)
 
 	var paymentProviderInput models.PaymentProviderInput
@@ -116,6 +112,12 @@ func UpdatePaymentProvider(c *gin.Context) {
 		return
 	}
 
+	if _, err := drivers.Get(paymentProviderInput.Driver); err != nil {
+		response := utils.ResponseAPI(fmt.Sprintf("Payment driver not found! Available drivers: %s", strings.Join(drivers.Names(), ", ")), http.StatusBadRequest, "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
 	var provider models.PaymentProvider
 
 	if err := db.Where("id = ?", c.Param("payment_provider_id")).First(&provider).Error; err != nil {
@@ -135,7 +137,7 @@ func UpdatePaymentProvider(c *gin.Context) {
 }
 
 // @Summary 	Delete payment provider (role: admin)
-// @Description Delete payment provider. Only admin can delete it. Switch your role if you are not admin.
+// @Description Delete payment provider. Only admin can delete it.
 // @Tags 		Payment Service
 // @Produce 	json
 // @Success 	200 {object} map[string]interface{}
@@ -143,14 +145,6 @@ func UpdatePaymentProvider(c *gin.Context) {
 // @Param 		payment_provider_id path int true "Param required."
 // @Security 	BearerToken
 func DeletePaymentProvider(c *gin.Context) {
-	userRole := c.Request.Header.Get("X-User-Role")
-
-	if userRole != "admin" {
-		response := utils.ResponseAPI("Only admins can delete payment provider!", http.StatusUnauthorized, "unauthorized", nil)
-		c.JSON(http.StatusUnauthorized, response)
-		return
-	}
-
 	db := c.MustGet("db").(*gorm.DB)
 	var provider models.PaymentProvider
 
@@ -170,8 +164,19 @@ func DeletePaymentProvider(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
+// Pending payment not updated for this long was abandoned (e.g. service crashed before charging) and is charged again
+const pendingPaymentTimeout = 5 * time.Minute
+
 // Invoked by order service
 func ProcessPayment(c *gin.Context) {
+	// Check payment provider and its driver
+	// Check the order has no pending or committed payment
+	//		Committed: return it with conflict, the order is paid already
+	//		Pending and abandoned: take it over and charge it again, otherwise conflict (in progress)
+	// Record the payment as pending
+	// Charge through provider driver, the payment ID is the idempotency key on provider side
+	//		OK: commit the payment with provider reference
+	//		Not OK: mark the payment failed
 	db := c.MustGet("db").(*gorm.DB)
 
 	var paymentRequest models.PaymentRequest
@@ -194,8 +199,183 @@ func ProcessPayment(c *gin.Context) {
 		return
 	}
 
+	driver, err := drivers.Get(provider.Driver)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	// Different idempotency key can't pay the same order twice
+	var payment models.Payment
+	if err := db.Where("order_id = ? AND status <> ?", paymentRequest.OrderID, models.PaymentFailed).First(&payment).Error; err == nil {
+		if payment.Status != models.PaymentPending {
+			// Order service marks the order paid with this payment
+			var paymentResponse models.PaymentResponse
+			copier.Copy(&paymentResponse, &payment)
+
+			c.JSON(http.StatusConflict, gin.H{
+				"status":  "error",
+				"message": "Order already paid!",
+				"data":    paymentResponse,
+			})
+			return
+		}
+
+		// Only one request takes over an abandoned payment
+		result := db.Model(&models.Payment{}).
+			Where("id = ? AND status = ? AND updated_at = ? AND updated_at < ?", payment.ID, models.PaymentPending, payment.UpdatedAt, time.Now().Add(-pendingPaymentTimeout)).
+			Update("updated_at", time.Now())
+		if result.Error != nil || result.RowsAffected == 0 {
+			c.JSON(http.StatusConflict, gin.H{
+				"status":  "error",
+				"message": "Payment of this order is in progress!",
+			})
+			return
+		}
+
+		// Charged through the provider it was created with
+		if payment.PaymentProviderID != provider.ID {
+			if err := db.Unscoped().First(&provider, payment.PaymentProviderID).Error; err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"status":  "error",
+					"message": err.Error(),
+				})
+				return
+			}
+
+			if driver, err = drivers.Get(provider.Driver); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"status":  "error",
+					"message": err.Error(),
+				})
+				return
+			}
+		}
+	} else {
+		if paymentRequest.Currency == "" {
+			paymentRequest.Currency = models.DefaultCurrency
+		}
+
+		payment = models.Payment{
+			OrderID:           paymentRequest.OrderID,
+			Amount:            paymentRequest.Total,
+			Currency:          paymentRequest.Currency,
+			PaymentProviderID: provider.ID,
+			Status:            models.PaymentPending,
+		}
+
+		// Unique index rejects concurrent payment of the same order
+		if err := db.Create(&payment).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  "error",
+				"message": err.Error(),
+			})
+			return
+		}
+	}
+
+	result, err := driver.Charge(drivers.ChargeRequest{
+		PaymentID: payment.ID,
+		OrderID:   payment.OrderID,
+		Amount:    payment.Amount,
+		Currency:  payment.Currency,
+	})
+
+	if err != nil {
+		if err := db.Model(&payment).Updates(models.Payment{Status: models.PaymentFailed, FailureMessage: err.Error()}).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  "error",
+				"message": err.Error(),
+			})
+			return
+		}
+
+		var paymentResponse models.PaymentResponse
+		copier.Copy(&paymentResponse, &payment)
+
+		code := http.StatusBadGateway
+		if errors.Is(err, drivers.ErrDeclined) {
+			code = http.StatusPaymentRequired
+		}
+
+		c.JSON(code, gin.H{
+			"status":  "error",
+			"message": err.Error(),
+			"data":    paymentResponse,
+		})
+		return
+	}
+
+	committedAt := time.Now()
+	if err := db.Model(&payment).Updates(models.Payment{
+		Status:            models.PaymentCommitted,
+		ProviderReference: result.Reference,
+		CommittedAt:       &committedAt,
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  "error",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	var paymentResponse models.PaymentResponse
+	copier.Copy(&paymentResponse, &payment)
+
 	c.JSON(http.StatusOK, gin.H{
 		"status":  "success",
 		"message": "Payment processed successfully!",
+		"data":    paymentResponse,
+	})
+}
+
+// Invoked by order service
+func GetPayment(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+
+	var payment models.Payment
+
+	if err := db.Where("id = ?", c.Param("payment_id")).First(&payment).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "Payment not found!",
+		})
+		return
+	}
+
+	var paymentResponse models.PaymentResponse
+	copier.Copy(&paymentResponse, &payment)
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Get payment success!",
+		"data":    paymentResponse,
+	})
+}
+
+// Invoked by order service, the payment of an order that isn't failed
+func GetOrderPayment(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+
+	var payment models.Payment
+
+	if err := db.Where("order_id = ? AND status <> ?", c.Param("order_id"), models.PaymentFailed).First(&payment).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  "error",
+			"message": "Payment not found!",
+		})
+		return
+	}
+
+	var paymentResponse models.PaymentResponse
+	copier.Copy(&paymentResponse, &payment)
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Get payment success!",
+		"data":    paymentResponse,
 	})
 }
@@ -0,0 +1,376 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/jinzhu/copier"
+	"github.com/tengkuroman/microshop/common/auth"
+	"github.com/tengkuroman/microshop/payment-service/drivers"
+	"github.com/tengkuroman/microshop/payment-service/models"
+	"github.com/tengkuroman/microshop/payment-service/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Connection to order service config
+var (
+	orderHost    = os.Getenv("ORDER_HOST")
+	orderPort    = os.Getenv("ORDER_PORT")
+	orderBaseURL = fmt.Sprintf("%s:%s", orderHost, orderPort)
+)
+
+var (
+	errRefundNotAllowed   = errors.New("Refund amount exceeds refundable amount!")
+	errRefundSellerNeeded = errors.New("Choose seller_id for a partial refund of an order with several sellers!")
+	errRefundSellerNoItem = errors.New("Seller has no items in the order!")
+)
+
+// Sum of each seller's items in the order
+func orderSellerTotals(orderID uint) (map[uint]int, error) {
+	client := resty.New()
+	res, err := client.R().SetResult(&models.OrderResponse{}).Get("http://" + orderBaseURL + "/order/" + strconv.FormatUint(uint64(orderID), 10))
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode() != http.StatusOK {
+		return nil, fmt.Errorf("Get order failed: %s", res.Status())
+	}
+
+	totals := make(map[uint]int)
+	for _, item := range res.Result().(*models.OrderResponse).Data.OrderItem {
+		totals[item.SellerID] += item.Price * item.Quantity
+	}
+
+	return totals, nil
+}
+
+// Tell order service how much of the order is refunded, only committed refunds count
+// (the refunded amount of the payment also holds refunds still pending at the provider)
+func notifyOrderRefund(db *gorm.DB, refund models.Refund) error {
+	var payment models.Payment
+	if err := db.First(&payment, refund.PaymentID).Error; err != nil {
+		return err
+	}
+
+	var committedAmount int64
+	if err := db.Model(&models.Refund{}).Select("COALESCE(SUM(amount), 0)").
+		Where("payment_id = ? AND status = ?", payment.ID, models.RefundCommitted).
+		Scan(&committedAmount).Error; err != nil {
+		return err
+	}
+
+	request := models.OrderRefundRequest{
+		OrderDetailID:  payment.OrderID,
+		RefundedAmount: int(committedAmount),
+		FullyRefunded:  payment.Status == models.PaymentRefunded,
+		RefundID:       refund.ID,
+		SellerID:       refund.SellerID,
+		Amount:         refund.Amount,
+	}
+
+	client := resty.New()
+	res, err := client.R().SetBody(request).Post("http://" + orderBaseURL + "/order/refund")
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode() != http.StatusOK {
+		return fmt.Errorf("Notify order refund failed: %s", res.Status())
+	}
+
+	notifiedAt := time.Now()
+	return db.Model(&refund).Update("order_notified_at", &notifiedAt).Error
+}
+
+// @Summary 	Refund a payment (role: admin, seller)
+// @Description Refund a payment fully (amount 0 or omitted) or partially. Admin can refund any payment, seller only up to their items in the order. A refund of a seller's items is taken off their payout, admin chooses the seller (seller_id) for a partial refund of an order with several sellers.
+// @Tags 		Payment Service
+// @Param 		body body models.RefundInput true "Body required."
+// @Produce 	json
+// @Success 	200 {object} map[string]interface{}
+// @Router 		/auth/payment/v1/payment/refund/{payment_id} [post]
+// @Param 		payment_id path int true "Param required."
+// @Security 	BearerToken
+func RefundPayment(c *gin.Context) {
+	// Check payment exist and committed (or partially refunded)
+	// Link the refund to a seller: the seller refunding, or the seller chosen by admin (the only seller of the order when not chosen)
+	// Check refundable amount: up to the remaining amount, for a seller up to their items minus their previous refunds
+	// Record refund as pending and hold the amount on the payment
+	// Refund through provider driver
+	//		OK: commit refund, update payment status, notify order service
+	//		Not OK: mark refund failed, give back the held amount
+	userID := auth.UserID(c)
+
+	// Admin refunds as admin even when also a seller of the order
+	userRole := auth.RoleSeller
+	if auth.HasRole(c, auth.RoleAdmin) {
+		userRole = auth.RoleAdmin
+	}
+
+	db := c.MustGet("db").(*gorm.DB)
+	var refundInput models.RefundInput
+
+	if err := c.ShouldBindJSON(&refundInput); err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusBadRequest, "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	var payment models.Payment
+
+	if err := db.Where("id = ?", c.Param("payment_id")).First(&payment).Error; err != nil {
+		response := utils.ResponseAPI("Payment not found!", http.StatusBadRequest, "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	sellerTotals, err := orderSellerTotals(payment.OrderID)
+	if err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	sellerID := refundInput.SellerID
+	if userRole == auth.RoleSeller {
+		sellerID = userID
+		if sellerTotals[sellerID] == 0 {
+			response := utils.ResponseAPI("You can only refund order of your products!", http.StatusForbidden, "forbidden", nil)
+			c.JSON(http.StatusForbidden, response)
+			return
+		}
+	}
+
+	if sellerID == 0 && len(sellerTotals) == 1 {
+		for onlySellerID := range sellerTotals {
+			sellerID = onlySellerID
+		}
+	}
+
+	if sellerID != 0 && sellerTotals[sellerID] == 0 {
+		response := utils.ResponseAPI(errRefundSellerNoItem.Error(), http.StatusBadRequest, "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	var refund models.Refund
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&payment, payment.ID).Error; err != nil {
+			return err
+		}
+
+		if payment.Status != models.PaymentCommitted && payment.Status != models.PaymentPartiallyRefunded {
+			return errRefundNotAllowed
+		}
+
+		refundable := payment.Amount - payment.RefundedAmount
+
+		if sellerID != 0 {
+			var sellerRefunded int64
+			if err := tx.Model(&models.Refund{}).Select("COALESCE(SUM(amount), 0)").
+				Where("payment_id = ? AND seller_id = ? AND status <> ?", payment.ID, sellerID, models.RefundFailed).
+				Scan(&sellerRefunded).Error; err != nil {
+				return err
+			}
+
+			if sellerRemaining := sellerTotals[sellerID] - int(sellerRefunded); sellerRemaining < refundable {
+				refundable = sellerRemaining
+			}
+		}
+
+		if refundInput.Amount == 0 {
+			refundInput.Amount = refundable
+		}
+
+		if refundInput.Amount <= 0 || refundInput.Amount > refundable {
+			return errRefundNotAllowed
+		}
+
+		// A partial refund of several sellers' items can't be taken off a payout
+		if sellerID == 0 && refundInput.Amount < payment.Amount-payment.RefundedAmount {
+			return errRefundSellerNeeded
+		}
+
+		refund = models.Refund{
+			PaymentID:     payment.ID,
+			SellerID:      sellerID,
+			Amount:        refundInput.Amount,
+			Reason:        refundInput.Reason,
+			Status:        models.RefundPending,
+			RequestedBy:   userID,
+			RequestedRole: userRole,
+		}
+
+		if err := tx.Create(&refund).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&payment).Update("refunded_amount", gorm.Expr("refunded_amount + ?", refund.Amount)).Error
+	})
+
+	if err == errRefundNotAllowed || err == errRefundSellerNeeded {
+		response := utils.ResponseAPI(err.Error(), http.StatusBadRequest, "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	if err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	// Provider may be deleted after the payment, its driver is still needed for the refund
+	var provider models.PaymentProvider
+	var driver drivers.Driver
+	err = db.Unscoped().First(&provider, payment.PaymentProviderID).Error
+	if err == nil {
+		driver, err = drivers.Get(provider.Driver)
+	}
+
+	var result drivers.RefundResult
+	if err == nil {
+		result, err = driver.Refund(drivers.RefundRequest{
+			RefundID:         refund.ID,
+			PaymentReference: payment.ProviderReference,
+			Amount:           refund.Amount,
+			Currency:         payment.Currency,
+		})
+	}
+
+	if err != nil {
+		failure := err.Error()
+		failErr := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&refund).Updates(models.Refund{Status: models.RefundFailed, FailureMessage: failure}).Error; err != nil {
+				return err
+			}
+
+			return tx.Model(&models.Payment{}).Where("id = ?", payment.ID).Update("refunded_amount", gorm.Expr("refunded_amount - ?", refund.Amount)).Error
+		})
+
+		if failErr != nil {
+			log.Printf("Mark refund %d failed: %v\n", refund.ID, failErr)
+		}
+
+		code := http.StatusBadGateway
+		if errors.Is(err, drivers.ErrDeclined) {
+			code = http.StatusPaymentRequired
+		}
+
+		response := utils.ResponseAPI("Refund failed: "+failure, code, "error", nil)
+		c.JSON(code, response)
+		return
+	}
+
+	committedAt := time.Now()
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&refund).Updates(models.Refund{
+			Status:            models.RefundCommitted,
+			ProviderReference: result.Reference,
+			CommittedAt:       &committedAt,
+		}).Error; err != nil {
+			return err
+		}
+
+		// Payment fully refunded only when every refund is committed
+		return tx.Model(&models.Payment{}).Where("id = ?", payment.ID).Update("status", gorm.Expr(
+			"CASE WHEN refunded_amount >= amount AND NOT EXISTS (SELECT 1 FROM refunds WHERE payment_id = ? AND status = ? AND deleted_at IS NULL) THEN ? ELSE ? END",
+			payment.ID, models.RefundPending, models.PaymentRefunded, models.PaymentPartiallyRefunded,
+		)).Error
+	})
+
+	if err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	// Refund is done on provider side, order service is notified again by NotifyPendingRefunds if it fails now
+	if err := notifyOrderRefund(db, refund); err != nil {
+		log.Printf("Notify refund %d to order service failed: %v\n", refund.ID, err)
+	}
+
+	var refundResponse models.RefundResponse
+	copier.Copy(&refundResponse, &refund)
+
+	response := utils.ResponseAPI("Payment refunded successfully!", http.StatusOK, "success", refundResponse)
+	c.JSON(http.StatusOK, response)
+}
+
+// Periodically notify order service about committed refunds it hasn't been told about (missed by a previous run
+// or failed when refunded), starting on startup and running for the lifetime of the service
+func NotifyPendingRefunds(db *gorm.DB) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		notifyPendingRefunds(db)
+		<-ticker.C
+	}
+}
+
+func notifyPendingRefunds(db *gorm.DB) {
+	var refunds []models.Refund
+
+	if err := db.Where("status = ? AND order_notified_at IS NULL", models.RefundCommitted).Order("id").Find(&refunds).Error; err != nil {
+		log.Println("Notify pending refunds failed:", err)
+		return
+	}
+
+	for i := range refunds {
+		if err := notifyOrderRefund(db, refunds[i]); err != nil {
+			log.Printf("Notify refund %d to order service failed: %v\n", refunds[i].ID, err)
+		}
+	}
+}
+
+// @Summary 	Get refunds of a payment (role: admin, seller)
+// @Description Get refunds of a payment. Seller can only see refunds of orders containing their products.
+// @Tags 		Payment Service
+// @Produce 	json
+// @Success 	200 {object} map[string]interface{}
+// @Router 		/auth/payment/v1/payment/refund/{payment_id} [get]
+// @Param 		payment_id path int true "Param required."
+// @Security 	BearerToken
+func GetRefunds(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	var payment models.Payment
+
+	if err := db.Preload("Refund").Where("id = ?", c.Param("payment_id")).First(&payment).Error; err != nil {
+		response := utils.ResponseAPI("Payment not found!", http.StatusBadRequest, "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	if !auth.HasRole(c, auth.RoleAdmin) {
+		sellerTotals, err := orderSellerTotals(payment.OrderID)
+		if err != nil {
+			response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
+			c.JSON(http.StatusInternalServerError, response)
+			return
+		}
+
+		if sellerTotals[auth.UserID(c)] == 0 {
+			response := utils.ResponseAPI("You can only see refunds of your products!", http.StatusForbidden, "forbidden", nil)
+			c.JSON(http.StatusForbidden, response)
+			return
+		}
+	}
+
+	var refundsResponse []models.RefundResponse
+	copier.Copy(&refundsResponse, &payment.Refund)
+
+	response := utils.ResponseAPI("Get refunds success!", http.StatusOK, "success", refundsResponse)
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,68 @@
+package drivers
+
+import (
+	"errors"
+	"sort"
+)
+
+var (
+	ErrDriverNotFound = errors.New("Payment driver not found!")
+	ErrDeclined       = errors.New("Payment declined by provider!")
+)
+
+type ChargeRequest struct {
+	PaymentID uint
+	OrderID   uint
+	Amount    int
+	Currency  string
+}
+
+type ChargeResult struct {
+	Reference string // transaction ID on provider side
+}
+
+type RefundRequest struct {
+	RefundID         uint
+	PaymentReference string // reference of the charge being refunded
+	Amount           int
+	Currency         string
+}
+
+type RefundResult struct {
+	Reference string
+}
+
+// Driver talks to the payment provider (bank, e-wallet, payment gateway).
+// Charge and Refund return ErrDeclined when the provider rejects the request. A payment abandoned before it was
+// committed is charged again with the same PaymentID, drivers pass it as the idempotency key of the provider.
+type Driver interface {
+	Charge(request ChargeRequest) (ChargeResult, error)
+	Refund(request RefundRequest) (RefundResult, error)
+}
+
+var registry = map[string]Driver{}
+
+// Register makes a driver available to payment providers by name
+func Register(name string, driver Driver) {
+	registry[name] = driver
+}
+
+func Get(name string) (Driver, error) {
+	driver, ok := registry[name]
+	if !ok {
+		return nil, ErrDriverNotFound
+	}
+
+	return driver, nil
+}
+
+func Names() []string {
+	var names []string
+	for name := range registry {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
@@ -0,0 +1,48 @@
+package drivers
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// Local driver for development and tests, no money is moved. Only registered when PAYMENT_FAKE_DRIVER_ENABLED is true.
+// Payments with amount above DeclineAbove are declined (0 means never).
+type FakeDriver struct {
+	DeclineAbove int
+
+	mu      sync.Mutex
+	counter int
+}
+
+func (d *FakeDriver) Charge(request ChargeRequest) (ChargeResult, error) {
+	if d.DeclineAbove > 0 && request.Amount > d.DeclineAbove {
+		return ChargeResult{}, ErrDeclined
+	}
+
+	d.mu.Lock()
+	d.counter++
+	counter := d.counter
+	d.mu.Unlock()
+
+	return ChargeResult{Reference: fmt.Sprintf("fake-%d-%d", request.PaymentID, counter)}, nil
+}
+
+func (d *FakeDriver) Refund(request RefundRequest) (RefundResult, error) {
+	d.mu.Lock()
+	d.counter++
+	counter := d.counter
+	d.mu.Unlock()
+
+	return RefundResult{Reference: fmt.Sprintf("fake-refund-%d-%d", request.RefundID, counter)}, nil
+}
+
+func init() {
+	if enabled, _ := strconv.ParseBool(os.Getenv("PAYMENT_FAKE_DRIVER_ENABLED")); !enabled {
+		return
+	}
+
+	declineAbove, _ := strconv.Atoi(os.Getenv("FAKE_PAYMENT_DECLINE_ABOVE"))
+	Register("fake", &FakeDriver{DeclineAbove: declineAbove})
+}
@@ -6,6 +6,8 @@ import (
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/tengkuroman/microshop/common/auth"
+	"github.com/tengkuroman/microshop/common/idempotency"
 	"github.com/tengkuroman/microshop/payment-service/config"
 	"github.com/tengkuroman/microshop/payment-service/controllers"
 	"golang.org/x/sync/errgroup"
@@ -44,10 +46,19 @@ func routeAuth(key string, value interface{}) http.Handler {
 		c.Set(key, value)
 	})
 
+	// Every route needs a logged in user
+	r.Use(auth.RequireAuth())
+
 	// Routes (admin)
-	r.POST("/payment", controllers.PostPaymentProvider)
-	r.PATCH("/payment/:payment_provider_id", controllers.UpdatePaymentProvider)
-	r.DELETE("/payment/:payment_provider_id", controllers.DeletePaymentProvider)
+	admin := auth.RequireRole(auth.RoleAdmin)
+	r.POST("/payment", admin, controllers.PostPaymentProvider)
+	r.PATCH("/payment/:payment_provider_id", admin, controllers.UpdatePaymentProvider)
+	r.DELETE("/payment/:payment_provider_id", admin, controllers.DeletePaymentProvider)
+
+	// Routes (admin, seller)
+	adminOrSeller := auth.RequireRole(auth.RoleAdmin, auth.RoleSeller)
+	r.POST("/payment/refund/:payment_id", adminOrSeller, controllers.RefundPayment)
+	r.GET("/payment/refund/:payment_id", adminOrSeller, controllers.GetRefunds)
 
 	return r
 }
@@ -64,7 +75,9 @@ func routeService(key string, value interface{}) http.Handler {
 	})
 
 	// Routes (service)
-	r.POST("/payment/process", controllers.ProcessPayment)
+	r.POST("/payment/process", idempotency.Idempotent(), controllers.ProcessPayment)
+	r.GET("/payment/:payment_id", controllers.GetPayment)
+	r.GET("/order/:order_id/payment", controllers.GetOrderPayment)
 
 	return r
 }
@@ -75,6 +88,9 @@ func main() {
 	databaseSQL, _ := db.DB()
 	defer databaseSQL.Close()
 
+	// Notify order service about refunds it missed, retried periodically
+	go controllers.NotifyPendingRefunds(db)
+
 	serverNonAuth := &http.Server{
 		Addr:    ":8080",
 		Handler: routeNonAuth("db", db),
@@ -4,19 +4,24 @@ import "gorm.io/gorm"
 
 type PaymentProvider struct {
 	gorm.Model
-	Name string
+	Name   string
+	Driver string // name of the driver processing its payments, chosen by admin
 }
 
 type PaymentProviderInput struct {
-	Name string `binding:"required"`
+	Name   string `binding:"required"`
+	Driver string `json:"driver" binding:"required"` // one of the registered drivers, e.g. fake for development
 }
 
 type PaymentRequest struct {
-	Total             int `json:"total"`
-	PaymentProviderID int `json:"payment_provider_id"`
+	OrderID           uint   `json:"order_id" binding:"required"`
+	Total             int    `json:"total" binding:"required,gt=0"`
+	Currency          string `json:"currency"`
+	PaymentProviderID int    `json:"payment_provider_id" binding:"required"`
 }
 
 type PaymentProviderResponse struct {
-	ID   uint   `json:"id"`
-	Name string `json:"name"`
+	ID     uint   `json:"id"`
+	Name   string `json:"name"`
+	Driver string `json:"driver"`
 }
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Payment status
+const (
+	PaymentPending           = "pending"
+	PaymentCommitted         = "committed"
+	PaymentFailed            = "failed"
+	PaymentPartiallyRefunded = "partially_refunded"
+	PaymentRefunded          = "refunded"
+)
+
+const DefaultCurrency = "IDR"
+
+// An order has at most one payment that's not failed
+type Payment struct {
+	gorm.Model
+	OrderID           uint `gorm:"uniqueIndex:idx_payments_order_id_active,where:status <> 'failed' AND deleted_at IS NULL"`
+	Amount            int
+	RefundedAmount    int // committed and in progress refunds
+	Currency          string
+	PaymentProviderID uint
+	Status            string
+	ProviderReference string
+	FailureMessage    string
+	CommittedAt       *time.Time
+	Refund            []Refund
+}
+
+type PaymentResponse struct {
+	ID                uint       `json:"id"`
+	OrderID           uint       `json:"order_id"`
+	Amount            int        `json:"amount"`
+	RefundedAmount    int        `json:"refunded_amount"`
+	Currency          string     `json:"currency"`
+	PaymentProviderID uint       `json:"payment_provider_id"`
+	Status            string     `json:"status"`
+	ProviderReference string     `json:"provider_reference"`
+	FailureMessage    string     `json:"failure_message"`
+	CreatedAt         time.Time  `json:"created_at"`
+	CommittedAt       *time.Time `json:"committed_at"`
+}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Refund status
+const (
+	RefundPending   = "pending"
+	RefundCommitted = "committed"
+	RefundFailed    = "failed"
+)
+
+type Refund struct {
+	gorm.Model
+	PaymentID         uint `gorm:"index"`
+	SellerID          uint `gorm:"index"` // seller whose items are refunded, 0 for a refund of the whole order
+	Amount            int
+	Reason            string
+	Status            string
+	ProviderReference string
+	FailureMessage    string
+	RequestedBy       uint
+	RequestedRole     string
+	CommittedAt       *time.Time
+	OrderNotifiedAt   *time.Time // order service told about the refund
+}
+
+type RefundInput struct {
+	Amount   int    `json:"amount" binding:"min=0"` // 0 refunds the remaining amount
+	Reason   string `json:"reason" binding:"required"`
+	SellerID uint   `json:"seller_id"` // admin only, refund items of the seller; sellers always refund their own items
+}
+
+type RefundResponse struct {
+	ID                uint       `json:"id"`
+	PaymentID         uint       `json:"payment_id"`
+	SellerID          uint       `json:"seller_id"`
+	Amount            int        `json:"amount"`
+	Reason            string     `json:"reason"`
+	Status            string     `json:"status"`
+	ProviderReference string     `json:"provider_reference"`
+	FailureMessage    string     `json:"failure_message"`
+	RequestedBy       uint       `json:"requested_by"`
+	RequestedRole     string     `json:"requested_role"`
+	CreatedAt         time.Time  `json:"created_at"`
+	CommittedAt       *time.Time `json:"committed_at"`
+}
+
+// Model for service invocation to order service
+type OrderResponse struct {
+	Data struct {
+		ID        uint `json:"id"`
+		OrderItem []struct {
+			Quantity int  `json:"quantity"`
+			Price    int  `json:"price"`
+			SellerID uint `json:"seller_id"`
+		} `json:"order_item"`
+	} `json:"data"`
+}
+
+type OrderRefundRequest struct {
+	OrderDetailID  uint `json:"order_detail_id"`
+	RefundedAmount int  `json:"refunded_amount"` // total of committed refunds so far
+	FullyRefunded  bool `json:"fully_refunded"`
+	RefundID       uint `json:"refund_id"`
+	SellerID       uint `json:"seller_id"` // refunded items of the seller are taken off their payout
+	Amount         int  `json:"amount"`    // amount of this refund
+}
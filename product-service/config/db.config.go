@@ -2,7 +2,9 @@ package config
 
 import (
 	"fmt"
+	"log"
 	"os"
+	"strconv"
 
 	"github.com/tengkuroman/microshop/product-service/models"
 
@@ -23,10 +25,26 @@ func ConnectDatabase() *gorm.DB {
 		panic(err.Error())
 	}
 
+	// Products created before stock was tracked were sold without limit, they start with LEGACY_PRODUCT_STOCK
+	backfillStock := db.Migrator().HasTable(&models.Product{}) && !db.Migrator().HasColumn(&models.Product{}, "Stock")
+
 	db.AutoMigrate(
 		&models.Category{},
 		&models.Product{},
+		&models.StockReservation{},
 	)
 
+	if backfillStock {
+		legacyStock, err := strconv.Atoi(os.Getenv("LEGACY_PRODUCT_STOCK"))
+		if err != nil || legacyStock < 0 {
+			legacyStock = 100
+		}
+
+		db.Exec("UPDATE products SET stock = ?", legacyStock)
+		log.Printf("Stock of existing products set to %d, sellers should update it\n", legacyStock)
+	}
+
+	models.MigrateProductSearch(db)
+
 	return db
 }
@@ -59,7 +59,7 @@ func GetCategoryByID(c *gin.Context) {
 }
 
 // @Summary 	Post category (role: admin)
-// @Description Post product category. Only admin can post category. Switch your role if you are not admin.
+// @Description Post product category. Only admin can post category.
 // @Tags 		Product Service
 // @Param 		body body models.CategoryInput true "Body required."
 // @Produce 	json
@@ -67,14 +67,6 @@ func GetCategoryByID(c *gin.Context) {
 // @Router 		/auth/product/v1/category [post]
 // @Security 	BearerToken
 func PostCategory(c *gin.Context) {
-	userRole := c.Request.Header.Get("X-User-Role")
-
-	if userRole != "admin" {
-		response := utils.ResponseAPI("Only admins can post category!", http.StatusUnauthorized, "unauthorized", nil)
-		c.JSON(http.StatusUnauthorized, response)
-		return
-	}
-
 	db := c.MustGet("db").(*gorm.DB)
 	var input models.CategoryInput
 
@@ -100,7 +92,7 @@ func PostCategory(c *gin.Context) {
 }
 
 // @Summary 	Update product category (role: admin)
-// @Description Update product category by category_id. Only admin can update category. Switch your role if you are not admin.
+// @Description Update product category by category_id. Only admin can update category.
 // @Tags 		Product Service
 // @Param 		body body models.CategoryInput true "Body required."
 // @Produce 	json
@@ -109,14 +101,6 @@ func PostCategory(c *gin.Context) {
 // @Param 		category_id path int true "Param required."
 // @Security 	BearerToken
 func UpdateCategory(c *gin.Context) {
-	userRole := c.Request.Header.Get("X-User-Role")
-
-	if userRole != "admin" {
-		response := utils.ResponseAPI("Only admins can update category!", http.StatusUnauthorized, "unauthorized", nil)
-		c.JSON(http.StatusUnauthorized, response)
-		return
-	}
-
 	db := c.MustGet("db").(*gorm.DB)
 	var categoryInput models.CategoryInput
 
@@ -148,7 +132,7 @@ func UpdateCategory(c *gin.Context) {
 }
 
 // @Summary 	Delete product category (role: admin)
-// @Description Delete product category. Only admin can delete category. Switch your role if you are not admin.
+// @Description Delete product category. Only admin can delete category.
 // @Tags 		Product Service
 // @Produce 	json
 // @Success 	200 {object} map[string]interface{}
@@ -156,14 +140,6 @@ func UpdateCategory(c *gin.Context) {
 // @Param 		category_id path int true "Param required."
 // @Security 	BearerToken
 func DeleteCategory(c *gin.Context) {
-	userRole := c.Request.Header.Get("X-User-Role")
-
-	if userRole != "admin" {
-		response := utils.ResponseAPI("Only admins can delete category!", http.StatusUnauthorized, "unauthorized", nil)
-		c.JSON(http.StatusUnauthorized, response)
-		return
-	}
-
 	db := c.MustGet("db").(*gorm.DB)
 	var category models.Category
 
@@ -4,8 +4,10 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/jinzhu/copier"
+	"github.com/tengkuroman/microshop/common/auth"
 	"github.com/tengkuroman/microshop/product-service/models"
 	"github.com/tengkuroman/microshop/product-service/utils"
 
@@ -27,25 +29,123 @@ func HealthCheck(c *gin.Context) {
 }
 
 // @Summary 	Get all products.
-// @Description Get all products available in marketplace.
+// @Description Get products available in marketplace, paginated. Filter by category, seller, price range and stock, sort by price, newest or name.
 // @Tags 		Product Service
 // @Produce 	json
 // @Success 	200 {object} map[string]interface{}
 // @Router 		/product/v1/products [get]
+// @Param 		page query int false "Page number, default 1."
+// @Param 		limit query int false "Products per page, default 20, max 100."
+// @Param 		category_id query int false "Filter by category."
+// @Param 		seller_id query int false "Filter by seller."
+// @Param 		min_price query int false "Minimum price."
+// @Param 		max_price query int false "Maximum price."
+// @Param 		in_stock query bool false "Only products available to order."
+// @Param 		sort query string false "Available sort: price, -price, newest, name, -name"
 func GetAllProducts(c *gin.Context) {
+	listProducts(c, nil, "Get all products success!")
+}
+
+// Bind the query params, apply the filter forced by the route and respond with a page of products
+func listProducts(c *gin.Context, force func(query *models.ProductQuery), message string) {
 	db := c.MustGet("db").(*gorm.DB)
-	var products []models.Product
+	var query models.ProductQuery
 
-	if err := db.Find(&products).Error; err != nil {
+	if err := c.ShouldBindQuery(&query); err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusBadRequest, "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	query.SetDefaults()
+	if force != nil {
+		force(&query)
+	}
+
+	products, total, err := models.FindProducts(db, query)
+	if err != nil {
 		response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
 		c.JSON(http.StatusInternalServerError, response)
 		return
 	}
 
-	var productsResponse []models.ProductResponse
+	productsResponse := []models.ProductResponse{}
 	copier.Copy(&productsResponse, &products)
 
-	response := utils.ResponseAPI("Get all products success!", http.StatusOK, "success", productsResponse)
+	if err := setAvailableStock(db, productsResponse); err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	response := utils.PaginatedResponseAPI(message, http.StatusOK, "success", productsResponse, query.Page, query.Limit, total)
+	c.JSON(http.StatusOK, response)
+}
+
+// @Summary 	Search products.
+// @Description Search products by name and description, most relevant first. Words are matched by prefix and names by similarity (typo tolerant). Highlight is HTML escaped with matched terms wrapped in <mark></mark>. Accepts the same filters as get all products.
+// @Tags 		Product Service
+// @Produce 	json
+// @Success 	200 {object} map[string]interface{}
+// @Router 		/product/v1/products/search [get]
+// @Param 		q query string true "Search text."
+// @Param 		page query int false "Page number, default 1."
+// @Param 		limit query int false "Products per page, default 20, max 100."
+// @Param 		category_id query int false "Filter by category."
+// @Param 		seller_id query int false "Filter by seller."
+// @Param 		min_price query int false "Minimum price."
+// @Param 		max_price query int false "Maximum price."
+// @Param 		in_stock query bool false "Only products available to order."
+func SearchProducts(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	var query models.ProductQuery
+
+	if err := c.ShouldBindQuery(&query); err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusBadRequest, "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	text := c.Query("q")
+	if models.PrefixTSQuery(text) == "" {
+		response := utils.ResponseAPI("Search text is required!", http.StatusBadRequest, "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	query.SetDefaults()
+
+	results, total, err := models.SearchProducts(db, query, text)
+	if err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	productsResponse := make([]models.ProductResponse, len(results))
+	for i := range results {
+		copier.Copy(&productsResponse[i], &results[i].Product)
+	}
+
+	if err := setAvailableStock(db, productsResponse); err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	searchResponse := make([]models.ProductSearchResponse, len(results))
+	for i := range results {
+		searchResponse[i] = models.ProductSearchResponse{
+			ProductResponse: productsResponse[i],
+			Rank:            results[i].Rank,
+			Highlight: models.ProductSearchHighlight{
+				Name:        results[i].NameHighlight,
+				Description: results[i].DescriptionHighlight,
+			},
+		}
+	}
+
+	response := utils.PaginatedResponseAPI("Search products success!", http.StatusOK, "success", searchResponse, query.Page, query.Limit, total)
 	c.JSON(http.StatusOK, response)
 }
 
@@ -66,63 +166,130 @@ func GetProductByID(c *gin.Context) {
 		return
 	}
 
-	var productResponse models.ProductResponse
-	copier.Copy(&productResponse, &product)
+	productsResponse := make([]models.ProductResponse, 1)
+	copier.Copy(&productsResponse[0], &product)
+
+	if err := setAvailableStock(db, productsResponse); err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
 
-	response := utils.ResponseAPI("Get product success!", http.StatusOK, "success", productResponse)
+	response := utils.ResponseAPI("Get product success!", http.StatusOK, "success", productsResponse[0])
 	c.JSON(http.StatusOK, response)
 }
 
-// @Summary 	Get products from specific seller.
-// @Description Get specific products by seller_id.
+// @Summary 	Get products by IDs.
+// @Description Get up to 100 products by product_id in one call, e.g. to show a cart. IDs of products not found (deleted) are listed in missing_ids.
 // @Tags 		Product Service
 // @Produce 	json
 // @Success 	200 {object} map[string]interface{}
-// @Router 		/product/v1/products/seller/{user_id} [get]
-// @Param 		user_id path int true "Param required."
-func GetProductsBySellerID(c *gin.Context) {
+// @Router 		/product/v1/products/lookup [get]
+// @Param 		ids query string true "Comma separated product IDs."
+func LookupProducts(c *gin.Context) {
 	db := c.MustGet("db").(*gorm.DB)
+
+	var productIDs []uint
+	seen := make(map[uint]bool)
+	for _, id := range strings.Split(c.Query("ids"), ",") {
+		productID, err := strconv.ParseUint(strings.TrimSpace(id), 10, 32)
+		if err != nil {
+			response := utils.ResponseAPI("Product IDs invalid!", http.StatusBadRequest, "error", nil)
+			c.JSON(http.StatusBadRequest, response)
+			return
+		}
+
+		if !seen[uint(productID)] {
+			seen[uint(productID)] = true
+			productIDs = append(productIDs, uint(productID))
+		}
+	}
+
+	if len(productIDs) > models.MaxProductLimit {
+		response := utils.ResponseAPI(fmt.Sprintf("Up to %d products can be looked up at once!", models.MaxProductLimit), http.StatusBadRequest, "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
 	var products []models.Product
+	if err := db.Where("id IN ?", productIDs).Order("id").Find(&products).Error; err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
 
-	if err := db.Where("user_id = ?", c.Param("user_id")).Find(&products).Error; err != nil {
+	lookupResponse := models.ProductLookupResponse{Products: []models.ProductResponse{}, MissingIDs: []uint{}}
+	copier.Copy(&lookupResponse.Products, &products)
+
+	if err := setAvailableStock(db, lookupResponse.Products); err != nil {
 		response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
 		c.JSON(http.StatusInternalServerError, response)
 		return
 	}
 
-	var productsResponse []models.ProductResponse
-	copier.Copy(&productsResponse, &products)
+	found := make(map[uint]bool)
+	for _, product := range products {
+		found[product.ID] = true
+	}
+
+	for _, productID := range productIDs {
+		if !found[productID] {
+			lookupResponse.MissingIDs = append(lookupResponse.MissingIDs, productID)
+		}
+	}
 
-	response := utils.ResponseAPI("Get products by seller ID success!", http.StatusOK, "success", productsResponse)
+	response := utils.ResponseAPI("Lookup products success!", http.StatusOK, "success", lookupResponse)
 	c.JSON(http.StatusOK, response)
 }
 
+// @Summary 	Get products from specific seller.
+// @Description Get specific products by seller_id, paginated. Accepts the same query params as get all products.
+// @Tags 		Product Service
+// @Produce 	json
+// @Success 	200 {object} map[string]interface{}
+// @Router 		/product/v1/products/seller/{user_id} [get]
+// @Param 		user_id path int true "Param required."
+// @Param 		page query int false "Page number, default 1."
+// @Param 		limit query int false "Products per page, default 20, max 100."
+// @Param 		sort query string false "Available sort: price, -price, newest, name, -name"
+func GetProductsBySellerID(c *gin.Context) {
+	sellerID, err := strconv.ParseUint(c.Param("user_id"), 10, 32)
+	if err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusBadRequest, "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	listProducts(c, func(query *models.ProductQuery) {
+		query.SellerID = uint(sellerID)
+	}, "Get products by seller ID success!")
+}
+
 // @Summary 	Get products from specific category.
-// @Description Get specific products by category_id.
+// @Description Get specific products by category_id, paginated. Accepts the same query params as get all products.
 // @Tags 		Product Service
 // @Produce 	json
 // @Success 	200 {object} map[string]interface{}
 // @Router 		/product/v1/products/category/{category_id} [get]
 // @Param 		category_id path int true "Param required."
+// @Param 		page query int false "Page number, default 1."
+// @Param 		limit query int false "Products per page, default 20, max 100."
+// @Param 		sort query string false "Available sort: price, -price, newest, name, -name"
 func GetProductsByCategoryID(c *gin.Context) {
-	db := c.MustGet("db").(*gorm.DB)
-	var products []models.Product
-
-	if err := db.Where("category_id = ?", c.Param("category_id")).Find(&products).Error; err != nil {
-		response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
-		c.JSON(http.StatusInternalServerError, response)
+	categoryID, err := strconv.ParseUint(c.Param("category_id"), 10, 32)
+	if err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusBadRequest, "error", nil)
+		c.JSON(http.StatusBadRequest, response)
 		return
 	}
 
-	var productsResponse []models.ProductResponse
-	copier.Copy(&productsResponse, &products)
-
-	response := utils.ResponseAPI("Get products by category ID success!", http.StatusOK, "success", productsResponse)
-	c.JSON(http.StatusOK, response)
+	listProducts(c, func(query *models.ProductQuery) {
+		query.CategoryID = uint(categoryID)
+	}, "Get products by category ID success!")
 }
 
 // @Summary 	Post product (role: seller)
-// @Description Post product to marketplace. Switch your role if you are not seller.
+// @Description Post product to marketplace. Apply as seller if you are not seller.
 // @Tags 		Product Service
 // @Param 		body body models.ProductInput true "Body required."
 // @Produce 	json
@@ -139,21 +306,13 @@ func PostProduct(c *gin.Context) {
 		return
 	}
 
-	xUserID := c.Request.Header.Get("X-User-ID")
-
-	userID, err := strconv.ParseUint(fmt.Sprintf("%v", xUserID), 10, 32)
-	if err != nil {
-		response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
-		c.JSON(http.StatusInternalServerError, response)
-		return
-	}
-
 	product := models.Product{
 		Name:        input.Name,
 		Description: input.Description,
 		ImageURL:    input.ImageURL,
 		Price:       input.Price,
-		UserID:      uint(userID),
+		Stock:       input.Stock,
+		UserID:      auth.UserID(c),
 		CategoryID:  input.CategoryID,
 	}
 
@@ -168,7 +327,7 @@ func PostProduct(c *gin.Context) {
 }
 
 // @Summary 	Update product (role: seller)
-// @Description Update posted product by product_id. Seller can only update their own products. Switch your role if you are not seller.
+// @Description Update posted product by product_id. Seller can only update their own products. Apply as seller if you are not seller.
 // @Tags 		Product Service
 // @Param 		body body models.ProductInput true "Body required."
 // @Produce 	json
@@ -187,15 +346,6 @@ func UpdateProduct(c *gin.Context) {
 		return
 	}
 
-	productUserID := strconv.FormatUint(uint64(product.UserID), 10)
-	userID := c.Request.Header.Get("X-User-ID")
-
-	if productUserID != userID {
-		response := utils.ResponseAPI("You can only update your own product!", http.StatusUnauthorized, "unauthorized", nil)
-		c.JSON(http.StatusUnauthorized, response)
-		return
-	}
-
 	var productInput models.ProductInput
 
 	if err := c.ShouldBindJSON(&productInput); err != nil {
@@ -214,16 +364,18 @@ func UpdateProduct(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
-// @Summary 	Delete product (role: seller)
-// @Description Delete posted product by product_id. Seller can only delete their own products. Switch your role if you are not seller.
+// @Summary 	Update product stock (role: seller)
+// @Description Set quantity on hand of posted product by product_id. Seller can only update their own products.
 // @Tags 		Product Service
+// @Param 		body body models.ProductStockInput true "Body required."
 // @Produce 	json
 // @Success 	200 {object} map[string]interface{}
-// @Router 		/auth/product/v1/product/{product_id} [delete]
+// @Router 		/auth/product/v1/product/{product_id}/stock [patch]
 // @Param 		product_id path int true "Param required."
 // @Security 	BearerToken
-func DeleteProduct(c *gin.Context) {
+func UpdateProductStock(c *gin.Context) {
 	db := c.MustGet("db").(*gorm.DB)
+
 	var product models.Product
 
 	if err := db.Where("id = ?", c.Param("product_id")).First(&product).Error; err != nil {
@@ -232,12 +384,39 @@ func DeleteProduct(c *gin.Context) {
 		return
 	}
 
-	productUserID := strconv.FormatUint(uint64(product.UserID), 10)
-	userID := c.Request.Header.Get("X-User-ID")
+	var stockInput models.ProductStockInput
+
+	if err := c.ShouldBindJSON(&stockInput); err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusBadRequest, "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	if err := db.Model(&product).Update("stock", *stockInput.Stock).Error; err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	response := utils.ResponseAPI("Product stock changed successfully!", http.StatusOK, "success", nil)
+	c.JSON(http.StatusOK, response)
+}
+
+// @Summary 	Delete product (role: seller)
+// @Description Delete posted product by product_id. Seller can only delete their own products. Apply as seller if you are not seller.
+// @Tags 		Product Service
+// @Produce 	json
+// @Success 	200 {object} map[string]interface{}
+// @Router 		/auth/product/v1/product/{product_id} [delete]
+// @Param 		product_id path int true "Param required."
+// @Security 	BearerToken
+func DeleteProduct(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	var product models.Product
 
-	if productUserID != userID {
-		response := utils.ResponseAPI("You can only delete your own product!", http.StatusUnauthorized, "unauthorized", nil)
-		c.JSON(http.StatusUnauthorized, response)
+	if err := db.Where("id = ?", c.Param("product_id")).First(&product).Error; err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusBadRequest, "error", nil)
+		c.JSON(http.StatusBadRequest, response)
 		return
 	}
 
@@ -250,3 +429,41 @@ func DeleteProduct(c *gin.Context) {
 	response := utils.ResponseAPI("Product deleted successfully!", http.StatusOK, "success", nil)
 	c.JSON(http.StatusOK, response)
 }
+
+// Seller of the product in :product_id, for RequireOwner
+func ProductOwner(c *gin.Context) (uint, error) {
+	db := c.MustGet("db").(*gorm.DB)
+	var product models.Product
+
+	if err := db.Where("id = ?", c.Param("product_id")).First(&product).Error; err != nil {
+		return 0, err
+	}
+
+	return product.UserID, nil
+}
+
+// Replace quantity on hand with quantity available to order (not held by reservations)
+func setAvailableStock(db *gorm.DB, products []models.ProductResponse) error {
+	if len(products) == 0 {
+		return nil
+	}
+
+	productIDs := make([]uint, len(products))
+	for i := range products {
+		productIDs[i] = products[i].ID
+	}
+
+	reserved, err := models.ReservedStock(db, productIDs, 0)
+	if err != nil {
+		return err
+	}
+
+	for i := range products {
+		products[i].Stock -= reserved[products[i].ID]
+		if products[i].Stock < 0 {
+			products[i].Stock = 0
+		}
+	}
+
+	return nil
+}
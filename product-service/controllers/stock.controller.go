@@ -0,0 +1,119 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/tengkuroman/microshop/product-service/models"
+	"github.com/tengkuroman/microshop/product-service/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var reservationMinuteLifespan = os.Getenv("STOCK_RESERVATION_MINUTE_LIFESPAN")
+
+// How long unpaid order holds its stock, 30 minutes by default
+func reservationLifespan() time.Duration {
+	minutes, err := strconv.Atoi(reservationMinuteLifespan)
+	if err != nil || minutes <= 0 {
+		minutes = 30
+	}
+
+	return time.Duration(minutes) * time.Minute
+}
+
+func stockErrorResponse(c *gin.Context, err error) {
+	var insufficientErr *models.InsufficientStockError
+
+	switch {
+	case errors.As(err, &insufficientErr):
+		response := utils.ResponseAPI(err.Error(), http.StatusConflict, "error", nil)
+		c.JSON(http.StatusConflict, response)
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		response := utils.ResponseAPI("Product not found!", http.StatusBadRequest, "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+	default:
+		response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
+		c.JSON(http.StatusInternalServerError, response)
+	}
+}
+
+// Invoked by order service
+func ReserveStock(c *gin.Context) {
+	// Release previous reservations of the order
+	// For every item, check stock not held by other orders then reserve it until expired
+	// Reject the whole order if one of the products is out of stock
+	db := c.MustGet("db").(*gorm.DB)
+	var input models.StockReserveInput
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusBadRequest, "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	if err := models.ReserveStock(db, input.OrderID, input.Items, reservationLifespan()); err != nil {
+		stockErrorResponse(c, err)
+		return
+	}
+
+	response := utils.ResponseAPI("Stock reserved successfully!", http.StatusOK, "success", nil)
+	c.JSON(http.StatusOK, response)
+}
+
+// Invoked by order service
+func ReleaseStock(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	var input models.StockOrderInput
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusBadRequest, "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	if err := models.ReleaseStock(db, input.OrderID); err != nil {
+		stockErrorResponse(c, err)
+		return
+	}
+
+	response := utils.ResponseAPI("Stock released successfully!", http.StatusOK, "success", nil)
+	c.JSON(http.StatusOK, response)
+}
+
+// Invoked by order service
+func CommitStock(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	var input models.StockOrderInput
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusBadRequest, "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	if err := models.CommitStock(db, input.OrderID); err != nil {
+		stockErrorResponse(c, err)
+		return
+	}
+
+	response := utils.ResponseAPI("Stock committed successfully!", http.StatusOK, "success", nil)
+	c.JSON(http.StatusOK, response)
+}
+
+// Periodically mark reservations of unpaid orders as expired, runs for the lifetime of the service
+func ExpireStockReservations(db *gorm.DB) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := models.ExpireStockReservations(db); err != nil {
+			log.Println("Expire stock reservations failed:", err)
+		}
+	}
+}
@@ -7,6 +7,7 @@ require (
 	github.com/gin-gonic/gin v1.7.7
 	github.com/go-playground/validator/v10 v10.4.1
 	github.com/jinzhu/copier v0.3.5
+	github.com/tengkuroman/microshop/common v0.0.0
 	gorm.io/gorm v1.23.4
 )
 
@@ -14,6 +15,7 @@ require (
 	github.com/gin-contrib/sse v0.1.0 // indirect
 	github.com/go-playground/locales v0.13.0 // indirect
 	github.com/go-playground/universal-translator v0.17.0 // indirect
+	github.com/golang-jwt/jwt v3.2.2+incompatible // indirect
 	github.com/golang/protobuf v1.3.3 // indirect
 	github.com/json-iterator/go v1.1.9 // indirect
 	github.com/leodido/go-urn v1.2.0 // indirect
@@ -41,3 +43,5 @@ require (
 	golang.org/x/text v0.3.7 // indirect
 	gorm.io/driver/postgres v1.3.5
 )
+
+replace github.com/tengkuroman/microshop/common => ../common
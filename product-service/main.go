@@ -6,6 +6,7 @@ import (
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/tengkuroman/microshop/common/auth"
 	"github.com/tengkuroman/microshop/product-service/config"
 	"github.com/tengkuroman/microshop/product-service/controllers"
 	"golang.org/x/sync/errgroup"
@@ -29,6 +30,8 @@ func routeNonAuth(key string, value interface{}) http.Handler {
 
 	// All user
 	r.GET("/products", controllers.GetAllProducts)
+	r.GET("/products/search", controllers.SearchProducts)
+	r.GET("/products/lookup", controllers.LookupProducts)
 	r.GET("/product/:product_id", controllers.GetProductByID)
 	r.GET("/products/seller/:user_id", controllers.GetProductsBySellerID)
 	r.GET("/products/category/:category_id", controllers.GetProductsByCategoryID)
@@ -50,15 +53,41 @@ func routeAuth(key string, value interface{}) http.Handler {
 		c.Set(key, value)
 	})
 
+	// Every route needs a logged in user
+	r.Use(auth.RequireAuth())
+
 	// Seller
-	r.POST("/product", controllers.PostProduct)
-	r.PATCH("/product/:product_id", controllers.UpdateProduct)
-	r.DELETE("/product/:product_id", controllers.DeleteProduct)
+	seller := auth.RequireRole(auth.RoleSeller)
+	productOwner := auth.RequireOwner(controllers.ProductOwner)
+	r.POST("/product", seller, controllers.PostProduct)
+	r.PATCH("/product/:product_id", seller, productOwner, controllers.UpdateProduct)
+	r.PATCH("/product/:product_id/stock", seller, productOwner, controllers.UpdateProductStock)
+	r.DELETE("/product/:product_id", seller, productOwner, controllers.DeleteProduct)
 
 	// Admin
-	r.POST("/category", controllers.PostCategory)
-	r.PATCH("/category/:category_id", controllers.UpdateCategory)
-	r.DELETE("/category/:category_id", controllers.DeleteCategory)
+	admin := auth.RequireRole(auth.RoleAdmin)
+	r.POST("/category", admin, controllers.PostCategory)
+	r.PATCH("/category/:category_id", admin, controllers.UpdateCategory)
+	r.DELETE("/category/:category_id", admin, controllers.DeleteCategory)
+
+	return r
+}
+
+func routeService(key string, value interface{}) http.Handler {
+	r := gin.Default()
+
+	// Set allow CORS
+	r.Use(cors.Default())
+
+	// Set context
+	r.Use(func(c *gin.Context) {
+		c.Set(key, value)
+	})
+
+	// Routes (service)
+	r.POST("/stock/reserve", controllers.ReserveStock)
+	r.POST("/stock/release", controllers.ReleaseStock)
+	r.POST("/stock/commit", controllers.CommitStock)
 
 	return r
 }
@@ -69,6 +98,9 @@ func main() {
 	databaseSQL, _ := db.DB()
 	defer databaseSQL.Close()
 
+	// Expire stock reservations of unpaid orders
+	go controllers.ExpireStockReservations(db)
+
 	serverNonAuth := &http.Server{
 		Addr:    ":8080",
 		Handler: routeNonAuth("db", db),
@@ -79,6 +111,11 @@ func main() {
 		Handler: routeAuth("db", db),
 	}
 
+	serverService := &http.Server{
+		Addr:    ":8082",
+		Handler: routeService("db", db),
+	}
+
 	g.Go(func() error {
 		err := serverNonAuth.ListenAndServe()
 		if err != nil && err != http.ErrServerClosed {
@@ -95,6 +132,14 @@ func main() {
 		return err
 	})
 
+	g.Go(func() error {
+		err := serverService.ListenAndServe()
+		if err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+		return err
+	})
+
 	if err := g.Wait(); err != nil {
 		log.Fatal(err)
 	}
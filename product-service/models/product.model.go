@@ -5,8 +5,9 @@ import "gorm.io/gorm"
 type Product struct {
 	gorm.Model
 	Name, Description, ImageURL string
-	Price                       int
-	UserID, CategoryID          uint
+	Price                       int  `gorm:"index"`
+	Stock                       int  // quantity on hand, reservations not deducted
+	UserID, CategoryID          uint `gorm:"index"`
 }
 
 type ProductInput struct {
@@ -14,14 +15,27 @@ type ProductInput struct {
 	Description string `binding:"required"`
 	ImageURL    string `json:"image_url" binding:"required"`
 	Price       int    `binding:"required"`
+	Stock       int    `json:"stock" binding:"min=0"`
 	CategoryID  uint   `json:"category_id" binding:"required"`
 }
+
+type ProductStockInput struct {
+	Stock *int `json:"stock" binding:"required,min=0"`
+}
+
 type ProductResponse struct {
 	ID          uint   `json:"id"`
 	Name        string `json:"name"`
 	Description string `json:"description"`
 	ImageURL    string `json:"image_url"`
 	Price       int    `json:"price"`
+	Stock       int    `json:"stock"` // available to order
 	UserID      uint   `json:"seller_id"`
 	CategoryID  uint   `json:"category_id"`
 }
+
+// Products found by bulk lookup, IDs not found (deleted) are listed apart
+type ProductLookupResponse struct {
+	Products   []ProductResponse `json:"products"`
+	MissingIDs []uint            `json:"missing_ids"`
+}
@@ -0,0 +1,90 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultProductLimit = 20
+	MaxProductLimit     = 100
+)
+
+// Sort options of product listing, "-" prefix means descending
+var productSorts = map[string]string{
+	"price":  "price ASC, id ASC",
+	"-price": "price DESC, id ASC",
+	"newest": "created_at DESC, id DESC",
+	"name":   "name ASC, id ASC",
+	"-name":  "name DESC, id ASC",
+}
+
+// Query params of product listing, every filter is optional
+type ProductQuery struct {
+	Page       int    `form:"page" binding:"omitempty,min=1"`
+	Limit      int    `form:"limit" binding:"omitempty,min=1,max=100"`
+	CategoryID uint   `form:"category_id"`
+	SellerID   uint   `form:"seller_id"`
+	MinPrice   *int   `form:"min_price" binding:"omitempty,min=0"`
+	MaxPrice   *int   `form:"max_price" binding:"omitempty,min=0"`
+	InStock    bool   `form:"in_stock"`
+	Sort       string `form:"sort" binding:"omitempty,oneof=price -price newest name -name"`
+}
+
+// Fill page and limit when not given
+func (q *ProductQuery) SetDefaults() {
+	if q.Page == 0 {
+		q.Page = 1
+	}
+
+	if q.Limit == 0 {
+		q.Limit = DefaultProductLimit
+	}
+}
+
+func (q ProductQuery) filter(db *gorm.DB) *gorm.DB {
+	if q.CategoryID != 0 {
+		db = db.Where("category_id = ?", q.CategoryID)
+	}
+
+	if q.SellerID != 0 {
+		db = db.Where("user_id = ?", q.SellerID)
+	}
+
+	if q.MinPrice != nil {
+		db = db.Where("price >= ?", *q.MinPrice)
+	}
+
+	if q.MaxPrice != nil {
+		db = db.Where("price <= ?", *q.MaxPrice)
+	}
+
+	// Same rule as ReservedStock: only active and unexpired reservations hold stock
+	if q.InStock {
+		db = db.Where("stock > COALESCE((?), 0)", db.Session(&gorm.Session{NewDB: true}).Model(&StockReservation{}).
+			Select("SUM(quantity)").
+			Where("stock_reservations.product_id = products.id AND status = ? AND expires_at > ?", ReservationActive, time.Now()))
+	}
+
+	return db
+}
+
+// Find a page of products matching the query and count all of them
+func FindProducts(db *gorm.DB, q ProductQuery) ([]Product, int64, error) {
+	var products []Product
+	var total int64
+
+	if err := q.filter(db.Model(&Product{})).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	order, ok := productSorts[q.Sort]
+	if !ok {
+		order = "id ASC"
+	}
+
+	err := q.filter(db).Order(order).Limit(q.Limit).Offset((q.Page - 1) * q.Limit).Find(&products).Error
+
+	return products, total, err
+}
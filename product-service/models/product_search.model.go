@@ -0,0 +1,210 @@
+package models
+
+import (
+	"html"
+	"log"
+	"regexp"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Search vector of products, generated by postgres from name (weight A) and description (weight B).
+// Managed by raw SQL because gorm can't create generated columns.
+var productFullTextMigrations = []string{
+	`ALTER TABLE products ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+		setweight(to_tsvector('simple', coalesce(name, '')), 'A') ||
+		setweight(to_tsvector('simple', coalesce(description, '')), 'B')
+	) STORED`,
+	"CREATE INDEX IF NOT EXISTS idx_products_search_vector ON products USING GIN (search_vector)",
+}
+
+// Similar names (typo tolerance), needs the pg_trgm extension
+var productTrigramMigrations = []string{
+	"CREATE EXTENSION IF NOT EXISTS pg_trgm",
+	"CREATE INDEX IF NOT EXISTS idx_products_name_trgm ON products USING GIN (name gin_trgm_ops)",
+}
+
+// Search features the database allows, set by MigrateProductSearch.
+// Without full text search products are searched by name and description with ILIKE.
+var (
+	fullTextSearch bool
+	trigramSearch  bool
+)
+
+// Highlighted terms are marked by postgres with private use characters, so they can be told apart
+// from the product text, which is HTML escaped before the marks become <mark></mark>
+const (
+	highlightStart = "\uE000"
+	highlightStop  = "\uE001"
+)
+
+var productHeadlineOptions = "StartSel=" + highlightStart + ", StopSel=" + highlightStop + ", HighlightAll=true"
+var productDescriptionHeadlineOptions = "StartSel=" + highlightStart + ", StopSel=" + highlightStop + ", MaxFragments=2, MaxWords=20, MinWords=5"
+
+var highlightReplacer = strings.NewReplacer(highlightStart, "<mark>", highlightStop, "</mark>")
+
+var searchTermPattern = regexp.MustCompile(`[\pL\pN]+`)
+
+var likeEscaper = strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_")
+
+// Create what product search needs. Search falls back to ILIKE when the database doesn't allow it
+// (e.g. CREATE EXTENSION not permitted), so a failure is logged and doesn't stop the service.
+func MigrateProductSearch(db *gorm.DB) {
+	fullTextSearch = migrateSearch(db, productFullTextMigrations)
+	trigramSearch = fullTextSearch && migrateSearch(db, productTrigramMigrations)
+
+	if !fullTextSearch {
+		log.Println("Full text search not available, products are searched with ILIKE")
+	} else if !trigramSearch {
+		log.Println("pg_trgm not available, product search is without typo tolerance")
+	}
+}
+
+func migrateSearch(db *gorm.DB, migrations []string) bool {
+	for _, migration := range migrations {
+		if err := db.Exec(migration).Error; err != nil {
+			log.Println("Product search migration failed:", err)
+			return false
+		}
+	}
+
+	return true
+}
+
+// HTML escape a headline of postgres and turn its marks into <mark></mark>, product text is never trusted as HTML
+func highlightHTML(headline string) string {
+	return highlightReplacer.Replace(html.EscapeString(headline))
+}
+
+// HTML escape text and wrap each case insensitive occurrence of the search text in <mark></mark>
+func markText(text string, search string) string {
+	pattern, err := regexp.Compile("(?i)" + regexp.QuoteMeta(search))
+	if err != nil || search == "" {
+		return html.EscapeString(text)
+	}
+
+	var marked strings.Builder
+	last := 0
+	for _, match := range pattern.FindAllStringIndex(text, -1) {
+		marked.WriteString(html.EscapeString(text[last:match[0]]))
+		marked.WriteString("<mark>" + html.EscapeString(text[match[0]:match[1]]) + "</mark>")
+		last = match[1]
+	}
+	marked.WriteString(html.EscapeString(text[last:]))
+
+	return marked.String()
+}
+
+type ProductSearchResult struct {
+	Product
+	Rank                 float64
+	NameHighlight        string
+	DescriptionHighlight string
+}
+
+type ProductSearchHighlight struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type ProductSearchResponse struct {
+	ProductResponse
+	Rank      float64                `json:"rank"`
+	Highlight ProductSearchHighlight `json:"highlight"`
+}
+
+// Turn user input into prefix tsquery, e.g. "red sho" -> "red:* & sho:*".
+// Only letters and digits are kept so the input can't break tsquery syntax.
+func PrefixTSQuery(text string) string {
+	terms := searchTermPattern.FindAllString(strings.ToLower(text), -1)
+	for i := range terms {
+		terms[i] += ":*"
+	}
+
+	return strings.Join(terms, " & ")
+}
+
+// Find a page of products matching text, ranked by relevance.
+// Products match on name or description words (prefix), or on a name similar to the text (typo tolerance).
+// Highlights are HTML escaped with matches in <mark></mark>.
+func SearchProducts(db *gorm.DB, q ProductQuery, text string) ([]ProductSearchResult, int64, error) {
+	if !fullTextSearch {
+		return searchProductsLike(db, q, text)
+	}
+
+	var results []ProductSearchResult
+	var total int64
+
+	tsQuery := PrefixTSQuery(text)
+	similarName, similarity := "name ILIKE ?", "0"
+	similarArg := "%" + likeEscaper.Replace(strings.TrimSpace(text)) + "%"
+	if trigramSearch {
+		similarName, similarity, similarArg = "? <% name", "word_similarity(?, name)", text
+	}
+
+	match := func(db *gorm.DB) *gorm.DB {
+		return q.filter(db.Model(&Product{})).
+			Where("(search_vector @@ to_tsquery('simple', ?) OR "+similarName+")", tsQuery, similarArg)
+	}
+
+	if err := match(db).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	rankArgs := []interface{}{tsQuery}
+	if trigramSearch {
+		rankArgs = append(rankArgs, text)
+	}
+
+	err := match(db).
+		Select(`products.*,
+			ts_rank(search_vector, to_tsquery('simple', ?)) + `+similarity+` AS rank,
+			ts_headline('simple', name, to_tsquery('simple', ?), ?) AS name_highlight,
+			ts_headline('simple', description, to_tsquery('simple', ?), ?) AS description_highlight`,
+			append(rankArgs, tsQuery, productHeadlineOptions, tsQuery, productDescriptionHeadlineOptions)...).
+		Order("rank DESC, id ASC").
+		Limit(q.Limit).
+		Offset((q.Page - 1) * q.Limit).
+		Scan(&results).Error
+
+	for i := range results {
+		results[i].NameHighlight = highlightHTML(results[i].NameHighlight)
+		results[i].DescriptionHighlight = highlightHTML(results[i].DescriptionHighlight)
+	}
+
+	return results, total, err
+}
+
+// Plain search when full text search is not available: name or description containing the text, newest first
+func searchProductsLike(db *gorm.DB, q ProductQuery, text string) ([]ProductSearchResult, int64, error) {
+	var products []Product
+	var total int64
+
+	text = strings.TrimSpace(text)
+	pattern := "%" + likeEscaper.Replace(text) + "%"
+	match := func(db *gorm.DB) *gorm.DB {
+		return q.filter(db.Model(&Product{})).Where("(name ILIKE ? OR description ILIKE ?)", pattern, pattern)
+	}
+
+	if err := match(db).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	err := match(db).
+		Order("id DESC").
+		Limit(q.Limit).
+		Offset((q.Page - 1) * q.Limit).
+		Find(&products).Error
+
+	results := make([]ProductSearchResult, len(products))
+	for i := range products {
+		results[i] = ProductSearchResult{
+			Product:              products[i],
+			NameHighlight:        markText(products[i].Name, text),
+			DescriptionHighlight: markText(products[i].Description, text),
+		}
+	}
+
+	return results, total, err
+}
@@ -0,0 +1,211 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Stock reservation status
+const (
+	ReservationActive    = "active"
+	ReservationCommitted = "committed"
+	ReservationReleased  = "released"
+	ReservationExpired   = "expired"
+)
+
+type InsufficientStockError struct {
+	ProductID uint
+	Available int
+}
+
+func (e *InsufficientStockError) Error() string {
+	return fmt.Sprintf("Insufficient stock for product %d, %d left!", e.ProductID, e.Available)
+}
+
+// Stock held for an order until it's paid (committed) or cancelled (released).
+// Active reservation past ExpiresAt doesn't hold stock anymore.
+type StockReservation struct {
+	gorm.Model
+	OrderID   uint `gorm:"index"`
+	ProductID uint `gorm:"index"`
+	Quantity  int
+	Status    string `gorm:"index"`
+	ExpiresAt time.Time
+}
+
+type StockItemInput struct {
+	ProductID uint `json:"product_id" binding:"required"`
+	Quantity  int  `json:"quantity" binding:"required,gt=0"`
+}
+
+type StockReserveInput struct {
+	OrderID uint             `json:"order_id" binding:"required"`
+	Items   []StockItemInput `json:"items" binding:"required,dive"`
+}
+
+type StockOrderInput struct {
+	OrderID uint `json:"order_id" binding:"required"`
+}
+
+// Quantity held by active reservations per product, excluding reservations of excludeOrderID
+func ReservedStock(db *gorm.DB, productIDs []uint, excludeOrderID uint) (map[uint]int, error) {
+	var rows []struct {
+		ProductID uint
+		Quantity  int
+	}
+
+	err := db.Model(&StockReservation{}).
+		Select("product_id, SUM(quantity) AS quantity").
+		Where("product_id IN ? AND status = ? AND expires_at > ? AND order_id <> ?", productIDs, ReservationActive, time.Now(), excludeOrderID).
+		Group("product_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	reserved := make(map[uint]int)
+	for _, row := range rows {
+		reserved[row.ProductID] = row.Quantity
+	}
+
+	return reserved, nil
+}
+
+// Lock the product row and return its stock that's not held by other orders
+func availableForUpdate(tx *gorm.DB, productID uint, orderID uint) (int, error) {
+	var product Product
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&product, productID).Error; err != nil {
+		return 0, err
+	}
+
+	reserved, err := ReservedStock(tx, []uint{productID}, orderID)
+	if err != nil {
+		return 0, err
+	}
+
+	return product.Stock - reserved[productID], nil
+}
+
+// Reserve stock for an order. Reserving again (e.g. before payment) replaces the previous
+// reservations of the order and renews their expiry. Stock already committed for the order stays taken.
+func ReserveStock(db *gorm.DB, orderID uint, items []StockItemInput, lifespan time.Duration) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var committed int64
+		if err := tx.Model(&StockReservation{}).Where("order_id = ? AND status = ?", orderID, ReservationCommitted).Count(&committed).Error; err != nil {
+			return err
+		}
+
+		// Payment retried after stock was taken out of products
+		if committed > 0 {
+			return nil
+		}
+
+		if err := tx.Model(&StockReservation{}).
+			Where("order_id = ? AND status IN ?", orderID, []string{ReservationActive, ReservationExpired}).
+			Update("status", ReservationReleased).Error; err != nil {
+			return err
+		}
+
+		// Same product can appear more than once
+		quantities := make(map[uint]int)
+		var productIDs []uint
+		for _, item := range items {
+			if _, ok := quantities[item.ProductID]; !ok {
+				productIDs = append(productIDs, item.ProductID)
+			}
+			quantities[item.ProductID] += item.Quantity
+		}
+
+		expiresAt := time.Now().Add(lifespan)
+		for _, productID := range productIDs {
+			available, err := availableForUpdate(tx, productID, orderID)
+			if err != nil {
+				return err
+			}
+
+			if available < quantities[productID] {
+				return &InsufficientStockError{ProductID: productID, Available: available}
+			}
+
+			reservation := StockReservation{
+				OrderID:   orderID,
+				ProductID: productID,
+				Quantity:  quantities[productID],
+				Status:    ReservationActive,
+				ExpiresAt: expiresAt,
+			}
+
+			if err := tx.Create(&reservation).Error; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// Give back stock held for an unpaid order. Stock already taken out for it (payment declined or
+// never completed after commit) is put back to the products.
+func ReleaseStock(db *gorm.DB, orderID uint) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var committed []StockReservation
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("order_id = ? AND status = ?", orderID, ReservationCommitted).Find(&committed).Error; err != nil {
+			return err
+		}
+
+		for i := range committed {
+			if err := tx.Model(&Product{}).Where("id = ?", committed[i].ProductID).
+				Update("stock", gorm.Expr("stock + ?", committed[i].Quantity)).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Model(&StockReservation{}).
+			Where("order_id = ? AND status IN ?", orderID, []string{ReservationActive, ReservationExpired, ReservationCommitted}).
+			Update("status", ReservationReleased).Error
+	})
+}
+
+// Take reserved stock out of products before an order is charged, committing again changes nothing.
+// Reservations are locked, a concurrent commit of the same order waits and finds them committed.
+func CommitStock(db *gorm.DB, orderID uint) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var reservations []StockReservation
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("order_id = ? AND status IN ?", orderID, []string{ReservationActive, ReservationExpired}).Find(&reservations).Error; err != nil {
+			return err
+		}
+
+		for i := range reservations {
+			available, err := availableForUpdate(tx, reservations[i].ProductID, orderID)
+			if err != nil {
+				return err
+			}
+
+			// Expired reservation may have lost its stock to other orders
+			if available < reservations[i].Quantity {
+				return &InsufficientStockError{ProductID: reservations[i].ProductID, Available: available}
+			}
+
+			if err := tx.Model(&Product{}).Where("id = ?", reservations[i].ProductID).
+				Update("stock", gorm.Expr("stock - ?", reservations[i].Quantity)).Error; err != nil {
+				return err
+			}
+
+			if err := tx.Model(&reservations[i]).Update("status", ReservationCommitted).Error; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// Mark active reservations past their expiry
+func ExpireStockReservations(db *gorm.DB) error {
+	return db.Model(&StockReservation{}).
+		Where("status = ? AND expires_at <= ?", ReservationActive, time.Now()).
+		Update("status", ReservationExpired).Error
+}
@@ -8,9 +8,17 @@ type Response struct {
 }
 
 type Meta struct {
-	Message string `json:"message"`
-	Code    int    `json:"code"`
-	Status  string `json:"status"`
+	Message    string      `json:"message"`
+	Code       int         `json:"code"`
+	Status     string      `json:"status"`
+	Pagination *Pagination `json:"pagination,omitempty"`
+}
+
+type Pagination struct {
+	Page       int   `json:"page"`
+	Limit      int   `json:"limit"`
+	Total      int64 `json:"total"`
+	TotalPages int   `json:"total_pages"`
 }
 
 func ResponseAPI(message string, code int, status string, data interface{}) Response {
@@ -28,6 +36,19 @@ func ResponseAPI(message string, code int, status string, data interface{}) Resp
 	return response
 }
 
+// ResponseAPI with pagination of listed data in meta
+func PaginatedResponseAPI(message string, code int, status string, data interface{}, page int, limit int, total int64) Response {
+	response := ResponseAPI(message, code, status, data)
+	response.Meta.Pagination = &Pagination{
+		Page:       page,
+		Limit:      limit,
+		Total:      total,
+		TotalPages: int((total + int64(limit) - 1) / int64(limit)),
+	}
+
+	return response
+}
+
 func FormatValidationError(err error) []string {
 	var errors []string
 
@@ -23,10 +23,39 @@ func ConnectDatabase() *gorm.DB {
 		panic(err.Error())
 	}
 
+	// Lines of the same product added twice are merged before they are made unique
+	if db.Migrator().HasTable(&models.CartItem{}) && !db.Migrator().HasIndex(&models.CartItem{}, "idx_cart_items_session_product") {
+		db.Exec(`UPDATE cart_items SET quantity = merged.quantity FROM (
+			SELECT MIN(id) AS id, SUM(quantity) AS quantity FROM cart_items WHERE deleted_at IS NULL GROUP BY shopping_session_id, product_id HAVING COUNT(*) > 1
+		) AS merged WHERE cart_items.id = merged.id`)
+		db.Exec(`UPDATE cart_items SET deleted_at = NOW() WHERE deleted_at IS NULL AND id NOT IN (
+			SELECT MIN(id) FROM cart_items WHERE deleted_at IS NULL GROUP BY shopping_session_id, product_id
+		)`)
+	}
+
+	// Users and guest tokens had a cart per concurrent first add, only the latest cart was used. Older ones are deleted before carts are made unique.
+	if db.Migrator().HasTable(&models.ShoppingSession{}) && !db.Migrator().HasIndex(&models.ShoppingSession{}, "idx_shopping_sessions_user") {
+		db.Exec(`UPDATE shopping_sessions SET deleted_at = NOW() WHERE deleted_at IS NULL AND user_id <> 0 AND id NOT IN (
+			SELECT MAX(id) FROM shopping_sessions WHERE deleted_at IS NULL AND user_id <> 0 GROUP BY user_id
+		)`)
+		db.Exec(`UPDATE shopping_sessions SET deleted_at = NOW() WHERE deleted_at IS NULL AND user_id = 0 AND id NOT IN (
+			SELECT MAX(id) FROM shopping_sessions WHERE deleted_at IS NULL AND user_id = 0 GROUP BY guest_token_hash
+		)`)
+	}
+
+	// Lines added before added price was recorded count as added at their last price
+	backfillAddedPrice := db.Migrator().HasTable(&models.CartItem{}) && !db.Migrator().HasColumn(&models.CartItem{}, "AddedPrice")
+
 	db.AutoMigrate(
 		&models.ShoppingSession{},
 		&models.CartItem{},
+		&models.Checkout{},
+		&models.SavedItem{},
 	)
 
+	if backfillAddedPrice {
+		db.Exec("UPDATE cart_items SET added_price = unit_price")
+	}
+
 	return db
 }
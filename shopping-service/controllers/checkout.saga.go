@@ -0,0 +1,210 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/tengkuroman/microshop/shopping-service/models"
+
+	"gorm.io/gorm"
+)
+
+// Checkout saga:
+//	1. Reserve: lock the shopping session and record a pending checkout
+//	2. Create order: invoke order service with the checkout ID (order service is idempotent on it)
+//	3. Commit: order created, delete cart items and shopping session
+//	   Roll back: order rejected (4xx), unlock the shopping session and keep the cart
+// If order service can't be reached or fails (5xx) the checkout stays pending and is resumed later,
+// order service returns the order already created for the checkout ID instead of creating another.
+
+var errCartEmpty = errors.New("No items in the cart!")
+
+// Lock the session and get its pending checkout, create one shipping to the address if there is none.
+// A pending checkout resumed with an address (not 0) ships to it, unless its order was already created.
+func reserveCart(db *gorm.DB, session *models.ShoppingSession, addressID uint) (models.Checkout, error) {
+	var checkout models.Checkout
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&models.CartItem{}).Where("shopping_session_id = ?", session.ID).Count(&count).Error; err != nil {
+			return err
+		}
+
+		if count == 0 {
+			return errCartEmpty
+		}
+
+		// Only one request can move the session from active to reserved
+		result := tx.Model(&models.ShoppingSession{}).
+			Where("id = ? AND status <> ?", session.ID, models.SessionReserved).
+			Update("status", models.SessionReserved)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			// Already reserved, resume its pending checkout
+			if err := tx.Where("shopping_session_id = ? AND status = ?", session.ID, models.CheckoutPending).Last(&checkout).Error; err != nil {
+				return err
+			}
+
+			if addressID == 0 || addressID == checkout.AddressID {
+				return nil
+			}
+
+			return tx.Model(&checkout).Update("address_id", addressID).Error
+		}
+
+		checkout = models.Checkout{
+			ShoppingSessionID: session.ID,
+			UserID:            session.UserID,
+			Status:            models.CheckoutPending,
+			AddressID:         addressID,
+		}
+
+		return tx.Create(&checkout).Error
+	})
+
+	return checkout, err
+}
+
+// Create the order of a pending checkout then commit or roll back based on order service result.
+// Returned error means the result is unknown and the checkout is still pending.
+func runCheckout(db *gorm.DB, checkout models.Checkout) (models.Checkout, error) {
+	var session models.ShoppingSession
+	if err := db.First(&session, checkout.ShoppingSessionID).Error; err != nil {
+		return checkout, err
+	}
+
+	var cartItems []models.CartItem
+	if err := db.Where("shopping_session_id = ?", session.ID).Find(&cartItems).Error; err != nil {
+		return checkout, err
+	}
+
+	var order models.Order
+	order.CheckoutID = checkout.ID
+	order.AddressID = checkout.AddressID
+	order.Session.UserID = session.UserID
+
+	for i := range cartItems {
+		order.Items = append(order.Items, models.CartItemOrder{
+			ProductID: cartItems[i].ProductID,
+			Quantity:  cartItems[i].Quantity,
+		})
+	}
+
+	client := resty.New()
+	res, err := client.R().SetBody(order).SetResult(&models.OrderResponse{}).SetError(&models.OrderResponse{}).Post("http://" + orderBaseURL + "/order")
+	if err != nil {
+		return checkout, err
+	}
+
+	if res.StatusCode() != http.StatusOK {
+		message := res.Status()
+		if orderResponse, ok := res.Error().(*models.OrderResponse); ok && orderResponse.Meta.Message != "" {
+			message = orderResponse.Meta.Message
+		}
+
+		// Order may have been created before the failure (e.g. response lost), find out when resumed
+		if res.StatusCode() >= http.StatusInternalServerError {
+			return checkout, errors.New(message)
+		}
+
+		// Rejected, no order was created
+		return rollbackCheckout(db, checkout, message)
+	}
+
+	orderDetailID := res.Result().(*models.OrderResponse).Data.OrderDetailID
+
+	return commitCheckout(db, checkout, orderDetailID)
+}
+
+// Order created, clear the cart
+func commitCheckout(db *gorm.DB, checkout models.Checkout, orderDetailID uint) (models.Checkout, error) {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&checkout).Where("status = ?", models.CheckoutPending).Updates(models.Checkout{
+			Status:        models.CheckoutCommitted,
+			OrderDetailID: orderDetailID,
+			Message:       "Order created successfully!",
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+
+		// Committed by another request
+		if result.RowsAffected == 0 {
+			return nil
+		}
+
+		if err := tx.Where("shopping_session_id = ?", checkout.ShoppingSessionID).Delete(&models.CartItem{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Delete(&models.ShoppingSession{}, checkout.ShoppingSessionID).Error
+	})
+
+	if err != nil {
+		return checkout, err
+	}
+
+	return checkout, db.First(&checkout, checkout.ID).Error
+}
+
+// Order rejected, release the cart so user can change it and check out again
+func rollbackCheckout(db *gorm.DB, checkout models.Checkout, message string) (models.Checkout, error) {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&checkout).Where("status = ?", models.CheckoutPending).Updates(models.Checkout{
+			Status:  models.CheckoutRolledBack,
+			Message: message,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return nil
+		}
+
+		return tx.Model(&models.ShoppingSession{}).Where("id = ?", checkout.ShoppingSessionID).Update("status", models.SessionActive).Error
+	})
+
+	if err != nil {
+		return checkout, err
+	}
+
+	return checkout, db.First(&checkout, checkout.ID).Error
+}
+
+// Periodically resume checkouts interrupted by crash or order service failure, runs for the lifetime of the service
+func ResumeCheckouts(db *gorm.DB) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		resumeCheckouts(db)
+		<-ticker.C
+	}
+}
+
+func resumeCheckouts(db *gorm.DB) {
+	var checkouts []models.Checkout
+
+	// Checkouts still being run by a request are left alone
+	if err := db.Where("status = ? AND updated_at < ?", models.CheckoutPending, time.Now().Add(-time.Minute)).Find(&checkouts).Error; err != nil {
+		log.Println("Resume checkouts failed:", err)
+		return
+	}
+
+	for i := range checkouts {
+		checkout, err := runCheckout(db, checkouts[i])
+		if err != nil {
+			log.Printf("Checkout %d still pending: %v\n", checkouts[i].ID, err)
+			continue
+		}
+
+		log.Printf("Checkout %d resumed: %s\n", checkout.ID, checkout.Status)
+	}
+}
@@ -0,0 +1,125 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/tengkuroman/microshop/common/auth"
+	"github.com/tengkuroman/microshop/shopping-service/models"
+	"github.com/tengkuroman/microshop/shopping-service/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Periodically delete guest carts not changed within GUEST_CART_DAY_LIFESPAN, runs for the lifetime of the service
+func DeleteExpiredGuestCarts(db *gorm.DB) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		deleted, err := models.DeleteExpiredGuestCarts(db)
+		if err != nil {
+			log.Println("Delete expired guest carts failed:", err)
+		} else if deleted > 0 {
+			log.Printf("%d expired guest carts deleted\n", deleted)
+		}
+
+		<-ticker.C
+	}
+}
+
+// Rule of merging lines of products in both carts when the merge request doesn't choose one
+var guestCartMergeRule = os.Getenv("GUEST_CART_MERGE_RULE")
+
+func defaultMergeRule() string {
+	if models.ValidMergeRule(guestCartMergeRule) {
+		return guestCartMergeRule
+	}
+
+	return models.MergeSum
+}
+
+// @Summary 	Create guest cart.
+// @Description Create an empty cart for a visitor who is not logged in. Send its cart token in X-Cart-Token header to the guest cart routes, and merge it into the user cart after login. Guest cart expires when not changed for GUEST_CART_DAY_LIFESPAN days (30 by default).
+// @Tags 		Shopping Service
+// @Produce 	json
+// @Success 	200 {object} map[string]interface{}
+// @Router 		/shopping/v1/guest/carts [post]
+func CreateGuestCart(c *gin.Context) {
+	// Generate a cart token, only its hash is stored
+	// Create an empty shopping session identified by the hash
+	db := c.MustGet("db").(*gorm.DB)
+
+	token, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	if err := models.CreateGuestCart(db, utils.HashToken(token)); err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	response := utils.ResponseAPI("Guest cart created!", http.StatusOK, "success", models.GuestCartResponse{CartToken: token})
+	c.JSON(http.StatusOK, response)
+}
+
+// @Summary 	Merge guest cart.
+// @Description Fold a guest cart into the cart of the logged in user and delete the guest cart. Products in both carts are merged by the rule (sum, max, keep_user or keep_guest), the service default when not chosen. Sum and max are capped to the product stock. Returns the cart.
+// @Tags 		Shopping Service
+// @Param 		body body models.CartMergeInput true "Body required."
+// @Produce 	json
+// @Success 	200 {object} map[string]interface{}
+// @Router 		/auth/shopping/v1/cart/merge [post]
+// @Security 	BearerToken
+func MergeGuestCart(c *gin.Context) {
+	// Look up the products of the guest cart for their stock
+	// Lock guest shopping session by cart token
+	// Lock active shopping session by user_id, create it if not exist
+	//		Move guest lines of products not in the user cart, merge the others by the rule (sum and max capped to the stock)
+	//		Delete guest shopping session, recompute total from the lines
+	db := c.MustGet("db").(*gorm.DB)
+	var mergeInput models.CartMergeInput
+
+	if err := c.ShouldBindJSON(&mergeInput); err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusBadRequest, "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	if mergeInput.Rule == "" {
+		mergeInput.Rule = defaultMergeRule()
+	}
+
+	guestTokenHash := utils.HashToken(mergeInput.CartToken)
+
+	guestCart, err := models.GetCart(db, models.GuestCart(guestTokenHash), nil)
+	if err != nil {
+		cartError(c, err)
+		return
+	}
+
+	products, err := lookupProducts(guestCart.ProductIDs())
+	if err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		return models.MergeGuestCart(tx, auth.UserID(c), guestTokenHash, mergeInput.Rule, products)
+	})
+
+	if err != nil {
+		cartError(c, err)
+		return
+	}
+
+	cartChanged(c, "Guest cart merged!")
+}
@@ -0,0 +1,123 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/tengkuroman/microshop/common/auth"
+	"github.com/tengkuroman/microshop/shopping-service/models"
+	"github.com/tengkuroman/microshop/shopping-service/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// @Summary 	Save a product for later.
+// @Description Move the line of a product from cart to the saved for later list. Returns the cart.
+// @Tags 		Shopping Service
+// @Param 		product_id path int true "Param required."
+// @Produce 	json
+// @Success 	200 {object} map[string]interface{}
+// @Router 		/auth/shopping/v1/cart/items/{product_id}/save [post]
+// @Security 	BearerToken
+func SaveCartItemForLater(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+
+	productID, ok := cartProductID(c)
+	if !ok {
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		return models.SaveCartItemForLater(tx, auth.UserID(c), productID)
+	})
+
+	if err != nil {
+		cartError(c, err)
+		return
+	}
+
+	cartChanged(c, "Product saved for later!")
+}
+
+// @Summary 	Get products saved for later.
+// @Description Get products moved out of cart to buy later, latest first. The list is kept after checkout.
+// @Tags 		Shopping Service
+// @Produce 	json
+// @Success 	200 {object} map[string]interface{}
+// @Router 		/auth/shopping/v1/cart/saved [get]
+// @Security 	BearerToken
+func GetSavedItems(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+
+	items, err := models.GetSavedItems(db, auth.UserID(c))
+	if err != nil {
+		cartError(c, err)
+		return
+	}
+
+	response := utils.ResponseAPI("Get saved items success!", http.StatusOK, "success", items)
+	c.JSON(http.StatusOK, response)
+}
+
+// @Summary 	Move a saved product to cart.
+// @Description Move a product from the saved for later list back to cart with its saved quantity and the current price. Returns the cart.
+// @Tags 		Shopping Service
+// @Param 		product_id path int true "Param required."
+// @Produce 	json
+// @Success 	200 {object} map[string]interface{}
+// @Router 		/auth/shopping/v1/cart/saved/{product_id}/restore [post]
+// @Security 	BearerToken
+func MoveSavedItemToCart(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+
+	productID, ok := cartProductID(c)
+	if !ok {
+		return
+	}
+
+	product, err := fetchCartProduct(productID)
+	if err != nil {
+		cartError(c, err)
+		return
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		return models.MoveSavedItemToCart(tx, auth.UserID(c), product)
+	})
+
+	if err != nil {
+		cartError(c, err)
+		return
+	}
+
+	cartChanged(c, "Saved product moved to the cart!")
+}
+
+// @Summary 	Delete a saved product.
+// @Description Delete a product from the saved for later list.
+// @Tags 		Shopping Service
+// @Param 		product_id path int true "Param required."
+// @Produce 	json
+// @Success 	200 {object} map[string]interface{}
+// @Router 		/auth/shopping/v1/cart/saved/{product_id} [delete]
+// @Security 	BearerToken
+func DeleteSavedItem(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+
+	productID, ok := cartProductID(c)
+	if !ok {
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		return models.DeleteSavedItem(tx, auth.UserID(c), productID)
+	})
+
+	if err != nil {
+		cartError(c, err)
+		return
+	}
+
+	response := utils.ResponseAPI("Saved product deleted!", http.StatusOK, "success", nil)
+	c.JSON(http.StatusOK, response)
+}
@@ -1,14 +1,19 @@
 package controllers
 
 import (
+	"errors"
 	"fmt"
-	"math"
+	"log"
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-resty/resty/v2"
 	"github.com/jinzhu/copier"
+	"github.com/tengkuroman/microshop/common/auth"
+	"github.com/tengkuroman/microshop/shopping-service/middlewares"
 	"github.com/tengkuroman/microshop/shopping-service/models"
 	"github.com/tengkuroman/microshop/shopping-service/utils"
 
@@ -43,238 +48,408 @@ func HealthCheck(c *gin.Context) {
 	})
 }
 
-// @Summary 	Add a product to cart.
-// @Description Add a product to cart.
-// @Tags 		Shopping Service
-// @Param 		body body models.CartItemInput true "Body to add product to the cart."
-// @Produce 	json
-// @Success 	200 {object} map[string]interface{}
-// @Router 		/auth/shopping/v1/cart [post]
-// @Security 	BearerToken
-func AddProductToCart(c *gin.Context) {
-	// Check active shopping session by user_id
-	//      if exist then add to current session, update total in session
-	//      if not exist then create session and add the product, update total in session
-	db := c.MustGet("db").(*gorm.DB)
-	var session models.ShoppingSession
-	var item models.CartItem
-	var itemInput models.CartItemInput
+var errProductNotFound = errors.New("Product not found!")
 
-	if err := c.ShouldBindJSON(&itemInput); err != nil {
-		response := utils.ResponseAPI(err.Error(), http.StatusBadRequest, "error", nil)
-		c.JSON(http.StatusBadRequest, response)
-		return
-	}
+// Products looked up by product service per call
+const productLookupLimit = 100
 
-	item.Quantity = itemInput.Quantity
-	item.ProductID = itemInput.ProductID
+// Get current data of the products from product service in batched calls, deleted products are left out
+func lookupProducts(productIDs []uint) (map[uint]models.CartProduct, error) {
+	products := make(map[uint]models.CartProduct)
+	client := resty.New()
 
-	xUserID := c.Request.Header.Get("X-User-ID")
-	if err := db.Where("user_id = ?", xUserID).Last(&session).Error; err != nil {
-		userID, err := strconv.ParseUint(fmt.Sprintf("%v", xUserID), 10, 32)
-		if err != nil {
-			response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
-			c.JSON(http.StatusInternalServerError, response)
-			return
+	for start := 0; start < len(productIDs); start += productLookupLimit {
+		end := start + productLookupLimit
+		if end > len(productIDs) {
+			end = len(productIDs)
 		}
 
-		session.UserID = uint(userID)
-		if err := db.Create(&session).Error; err != nil {
-			response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
-			c.JSON(http.StatusInternalServerError, response)
-			return
+		var ids []string
+		for _, productID := range productIDs[start:end] {
+			ids = append(ids, strconv.FormatUint(uint64(productID), 10))
 		}
 
-		item.ShoppingSessionID = session.ID
-		if err := db.Create(&item).Error; err != nil {
-			response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
-			c.JSON(http.StatusInternalServerError, response)
-			return
+		res, err := client.R().SetResult(&models.ProductLookupResponse{}).SetQueryParam("ids", strings.Join(ids, ",")).Get("http://" + productBaseURL + "/products/lookup")
+		if err != nil {
+			return nil, err
 		}
 
-		productID := strconv.FormatUint(uint64(item.ProductID), 10)
-		client := resty.New()
-		res, err := client.R().SetResult(&models.ProductResponse{}).Get("http://" + productBaseURL + "/product/" + productID)
+		if res.StatusCode() != http.StatusOK {
+			return nil, fmt.Errorf("product lookup failed: %s", res.Status())
+		}
 
-		if err != nil {
-			response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
-			c.JSON(http.StatusInternalServerError, response)
-			return
+		for _, product := range res.Result().(*models.ProductLookupResponse).Data.Products {
+			products[product.ID] = models.CartProduct{
+				ID:       product.ID,
+				Name:     product.Name,
+				ImageURL: product.ImageURL,
+				Price:    product.Price,
+				Stock:    product.Stock,
+				SellerID: product.UserID,
+			}
 		}
+	}
+
+	return products, nil
+}
+
+// Get a product from product service to price a cart line
+func fetchCartProduct(productID uint) (models.CartProduct, error) {
+	products, err := lookupProducts([]uint{productID})
+	if err != nil {
+		return models.CartProduct{}, err
+	}
+
+	product, ok := products[productID]
+	if !ok {
+		return models.CartProduct{}, errProductNotFound
+	}
+
+	return product, nil
+}
+
+// Owner of the cart requested: the logged in user, else the guest holding the cart token
+func cartOwner(c *gin.Context) models.CartOwner {
+	if userID := auth.UserID(c); userID != 0 {
+		return models.UserCart(userID)
+	}
+
+	return models.GuestCart(utils.HashToken(middlewares.CartToken(c)))
+}
+
+// Respond a cart error with its status
+func cartError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch err {
+	case errProductNotFound, models.ErrCartNotFound, models.ErrCartItemNotFound, models.ErrInsufficientStock:
+		status = http.StatusBadRequest
+	case models.ErrSavedItemNotFound, models.ErrGuestCartNotFound:
+		status = http.StatusNotFound
+	case models.ErrCartReserved:
+		status = http.StatusConflict
+	}
+
+	response := utils.ResponseAPI(err.Error(), status, "error", nil)
+	c.JSON(status, response)
+}
+
+// :product_id of the request, responds 400 when invalid
+func cartProductID(c *gin.Context) (uint, bool) {
+	productID, err := strconv.ParseUint(c.Param("product_id"), 10, 32)
+	if err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusBadRequest, "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return 0, false
+	}
 
-		product := res.Result().(*models.ProductResponse).Data
+	return uint(productID), true
+}
+
+// Respond the cart requested with current product data, nothing is stored (lines are repriced at checkout).
+// When product service can't be reached the cart is responded as stored.
+func cartChanged(c *gin.Context, message string) {
+	db := c.MustGet("db").(*gorm.DB)
+	owner := cartOwner(c)
+
+	cart, err := models.GetCart(db, owner, nil)
+	if err != nil {
+		cartError(c, err)
+		return
+	}
 
-		itemTotalPrice := product.Price * item.Quantity
-		if err := db.Model(&session).Update("total", itemTotalPrice).Error; err != nil {
-			response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
-			c.JSON(http.StatusInternalServerError, response)
+	products, err := lookupProducts(cart.ProductIDs())
+	if err != nil {
+		log.Printf("Lookup products of cart %d failed: %v\n", cart.ShoppingSessionID, err)
+	}
+
+	if products != nil {
+		cart, err = models.GetCart(db, owner, products)
+		if err != nil {
+			cartError(c, err)
 			return
 		}
+	}
 
-		response := utils.ResponseAPI("Product added to the cart!", http.StatusOK, "success", nil)
-		c.JSON(http.StatusOK, response)
+	response := utils.ResponseAPI(message, http.StatusOK, "success", cart)
+	c.JSON(http.StatusOK, response)
+}
+
+// Store the current product prices in the lines of the cart about to be checked out.
+// Order service prices the order itself, so checkout goes on with the stored prices when it fails.
+func repriceCart(db *gorm.DB, session models.ShoppingSession) {
+	if session.Status == models.SessionReserved {
 		return
 	}
 
-	item.ShoppingSessionID = session.ID
-	if err := db.Create(&item).Error; err != nil {
-		response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
-		c.JSON(http.StatusInternalServerError, response)
+	var productIDs []uint
+	if err := db.Model(&models.CartItem{}).Where("shopping_session_id = ?", session.ID).Pluck("product_id", &productIDs).Error; err != nil {
+		log.Printf("Reprice cart %d failed: %v\n", session.ID, err)
 		return
 	}
 
-	productID := strconv.FormatUint(uint64(item.ProductID), 10)
+	products, err := lookupProducts(productIDs)
+	if err == nil {
+		err = db.Transaction(func(tx *gorm.DB) error {
+			return models.RepriceCart(tx, models.UserCart(session.UserID), products)
+		})
+	}
 
-	client := resty.New()
-	res, err := client.R().SetResult(&models.ProductResponse{}).Get("http://" + productBaseURL + "/product/" + productID)
+	if err != nil && err != models.ErrCartReserved {
+		log.Printf("Reprice cart %d failed: %v\n", session.ID, err)
+	}
+}
 
-	if err != nil {
-		response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
-		c.JSON(http.StatusInternalServerError, response)
-		return
+// Price cart lines stored before lines were priced, retried until product service answers
+func PriceUnpricedCartItems(db *gorm.DB) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		err := priceUnpricedCartItems(db)
+		if err == nil {
+			return
+		}
+
+		log.Println("Price unpriced cart items failed:", err)
+		<-ticker.C
 	}
+}
 
-	product := res.Result().(*models.ProductResponse).Data
+func priceUnpricedCartItems(db *gorm.DB) error {
+	productIDs, err := models.UnpricedCartProductIDs(db)
+	if err != nil || len(productIDs) == 0 {
+		return err
+	}
 
-	totalPrice := session.Total + item.Quantity*product.Price
-	if err := db.Model(&session).Update("total", totalPrice).Error; err != nil {
-		response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
-		c.JSON(http.StatusInternalServerError, response)
-		return
+	products, err := lookupProducts(productIDs)
+	if err != nil {
+		return err
 	}
 
-	response := utils.ResponseAPI("Product added to the cart!", http.StatusOK, "success", nil)
-	c.JSON(http.StatusOK, response)
+	return db.Transaction(func(tx *gorm.DB) error {
+		return models.PriceUnpricedCartItems(tx, products)
+	})
 }
 
-// @Summary 	Get all products from cart.
-// @Description Get all products from cart. Data retrieved based on logged in user.
+// @Summary 	Add a product to cart.
+// @Description Add a product to cart. Adding a product already in the cart adds to its quantity. Returns the cart.
 // @Tags 		Shopping Service
+// @Param 		body body models.CartItemInput true "Body to add product to the cart."
 // @Produce 	json
 // @Success 	200 {object} map[string]interface{}
-// @Router 		/auth/shopping/v1/cart [get]
+// @Router 		/auth/shopping/v1/cart [post]
+// @Router 		/shopping/v1/guest/cart [post]
+// @Param 		X-Cart-Token header string false "Cart token of a guest cart, required instead of logging in on guest routes."
 // @Security 	BearerToken
-func GetCartItems(c *gin.Context) {
-	// Check active shopping session by user_id
-	//      If exist then get items by shopping session
-	//		If not exist then return "no items added to the cart"
+func AddProductToCart(c *gin.Context) {
+	// Get the product, check available stock
+	// Lock active shopping session by user_id or guest cart token, create it if not exist
+	//      if product is in the cart then add to its quantity, else add a line
+	//      recompute total from the lines
 	db := c.MustGet("db").(*gorm.DB)
-	var session models.ShoppingSession
-	userID := c.Request.Header.Get("X-User-ID")
+	var itemInput models.CartItemInput
 
-	if err := db.Where("user_id = ?", userID).Last(&session).Error; err != nil {
-		response := utils.ResponseAPI("No items added to the cart!", http.StatusBadRequest, "error", nil)
+	if err := c.ShouldBindJSON(&itemInput); err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusBadRequest, "error", nil)
 		c.JSON(http.StatusBadRequest, response)
 		return
 	}
 
-	var items []models.CartItem
+	product, err := fetchCartProduct(itemInput.ProductID)
+	if err != nil {
+		cartError(c, err)
+		return
+	}
 
-	if err := db.Where("shopping_session_id = ?", session.ID).Find(&items).Error; err != nil {
-		response := utils.ResponseAPI(err.Error(), http.StatusBadRequest, "error", nil)
-		c.JSON(http.StatusBadRequest, response)
+	err = db.Transaction(func(tx *gorm.DB) error {
+		return models.AddCartItem(tx, cartOwner(c), product, itemInput.Quantity)
+	})
+
+	if err != nil {
+		cartError(c, err)
 		return
 	}
 
-	var itemsResponse []models.CartItemResponse
-	copier.Copy(&itemsResponse, &items)
+	cartChanged(c, "Product added to the cart!")
+}
 
-	response := utils.ResponseAPI("Get cart item success!", http.StatusOK, "success", itemsResponse)
-	c.JSON(http.StatusOK, response)
+// @Summary 	Get all products from cart.
+// @Description Get all products from cart with current prices, line subtotals and total. Data retrieved based on logged in user, or the cart token of a guest.
+// @Tags 		Shopping Service
+// @Produce 	json
+// @Success 	200 {object} map[string]interface{}
+// @Router 		/auth/shopping/v1/cart [get]
+// @Router 		/shopping/v1/guest/cart [get]
+// @Param 		X-Cart-Token header string false "Cart token of a guest cart, required instead of logging in on guest routes."
+// @Security 	BearerToken
+func GetCartItems(c *gin.Context) {
+	// Check active shopping session by user_id or guest cart token
+	//      If exist then look up its products in one call, show the lines with current product prices and the total of them
+	//		and flag lines whose price changed or product was deleted since they were added (nothing is stored)
+	//		If not exist then return "no items added to the cart"
+	cartChanged(c, "Get cart item success!")
 }
 
 // @Summary 	Update a product quantity in cart.
-// @Description Update a product quantity in cart.
+// @Description Update a product quantity in cart, quantity 0 removes the product. Returns the cart.
 // @Tags 		Shopping Service
-// @Param 		body body models.CartItemInput true "Body to update product quantity in the cart."
+// @Param 		body body models.CartItemUpdateInput true "Body to update product quantity in the cart."
 // @Produce 	json
 // @Success 	200 {object} map[string]interface{}
 // @Router 		/auth/shopping/v1/cart [patch]
+// @Router 		/shopping/v1/guest/cart [patch]
+// @Param 		X-Cart-Token header string false "Cart token of a guest cart, required instead of logging in on guest routes."
 // @Security 	BearerToken
 func UpdateCartItem(c *gin.Context) {
-	// Check active shopping session by user_id -> get the shopping session id
+	// Lock active shopping session by user_id or guest cart token
 	//     If exist then check if in shopping session there is a product_id == update item's product_id
-	//			If exist then merge the data with the update
+	//			If exist then set its quantity (remove it when 0), recompute total from the lines
 	//			If not exist then return "please use add product method"
 	db := c.MustGet("db").(*gorm.DB)
-	var session models.ShoppingSession
-	userID := c.Request.Header.Get("X-User-ID")
+	var updateItem models.CartItemUpdateInput
 
-	if err := db.Where("user_id = ?", userID).Last(&session).Error; err != nil {
-		response := utils.ResponseAPI("Please use add product method!", http.StatusBadRequest, "error", nil)
+	if err := c.ShouldBindJSON(&updateItem); err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusBadRequest, "error", nil)
 		c.JSON(http.StatusBadRequest, response)
 		return
 	}
 
-	var updateItem models.CartItemInput
+	quantity := *updateItem.Quantity
 
-	if err := c.ShouldBindJSON(&updateItem); err != nil {
-		response := utils.ResponseAPI(err.Error(), http.StatusBadRequest, "error", nil)
-		c.JSON(http.StatusBadRequest, response)
+	// Removing doesn't need the product, it may not exist anymore
+	product := models.CartProduct{ID: updateItem.ProductID}
+	if quantity > 0 {
+		var err error
+		product, err = fetchCartProduct(updateItem.ProductID)
+		if err != nil {
+			cartError(c, err)
+			return
+		}
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		return models.SetCartItemQuantity(tx, cartOwner(c), product, quantity)
+	})
+
+	if err != nil {
+		cartError(c, err)
 		return
 	}
 
-	var item models.CartItem
+	cartChanged(c, "Cart item updated successfully!")
+}
 
-	if err := db.Where(&models.CartItem{ShoppingSessionID: session.ID, ProductID: updateItem.ProductID}).First(&item).Error; err != nil {
-		response := utils.ResponseAPI("Please use add product method!", http.StatusBadRequest, "error", nil)
-		c.JSON(http.StatusBadRequest, response)
+// @Summary 	Remove a product from cart.
+// @Description Remove the line of a product from cart. Returns the cart.
+// @Tags 		Shopping Service
+// @Param 		product_id path int true "Param required."
+// @Produce 	json
+// @Success 	200 {object} map[string]interface{}
+// @Router 		/auth/shopping/v1/cart/items/{product_id} [delete]
+// @Router 		/shopping/v1/guest/cart/items/{product_id} [delete]
+// @Param 		X-Cart-Token header string false "Cart token of a guest cart, required instead of logging in on guest routes."
+// @Security 	BearerToken
+func RemoveCartItem(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+
+	productID, ok := cartProductID(c)
+	if !ok {
 		return
 	}
 
-	itemOldQuantity := item.Quantity
+	err := db.Transaction(func(tx *gorm.DB) error {
+		return models.RemoveCartItem(tx, cartOwner(c), productID)
+	})
 
-	if err := db.Model(&item).Update("quantity", updateItem.Quantity).Error; err != nil {
-		response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
-		c.JSON(http.StatusInternalServerError, response)
+	if err != nil {
+		cartError(c, err)
 		return
 	}
 
-	productID := strconv.FormatUint(uint64(item.ProductID), 10)
-	client := resty.New()
-	res, err := client.R().SetResult(&models.ProductResponse{}).Get("http://" + productBaseURL + "/product/" + productID)
+	cartChanged(c, "Product removed from the cart!")
+}
+
+// @Summary 	Replace cart contents.
+// @Description Replace every product in cart with the items given, an empty list empties the cart. Returns the cart.
+// @Tags 		Shopping Service
+// @Param 		body body models.CartReplaceInput true "Body required."
+// @Produce 	json
+// @Success 	200 {object} map[string]interface{}
+// @Router 		/auth/shopping/v1/cart [put]
+// @Router 		/shopping/v1/guest/cart [put]
+// @Param 		X-Cart-Token header string false "Cart token of a guest cart, required instead of logging in on guest routes."
+// @Security 	BearerToken
+func ReplaceCart(c *gin.Context) {
+	// Get every product, check available stock
+	// Lock active shopping session by user_id or guest cart token, create it if not exist
+	// Remove all lines, add the items, recompute total from the lines
+	db := c.MustGet("db").(*gorm.DB)
+	var replaceInput models.CartReplaceInput
 
+	if err := c.ShouldBindJSON(&replaceInput); err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusBadRequest, "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	var productIDs []uint
+	for _, item := range replaceInput.Items {
+		productIDs = append(productIDs, item.ProductID)
+	}
+
+	products, err := lookupProducts(productIDs)
 	if err != nil {
-		response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
-		c.JSON(http.StatusInternalServerError, response)
+		cartError(c, err)
 		return
 	}
 
-	product := res.Result().(*models.ProductResponse).Data
+	for _, productID := range productIDs {
+		if _, ok := products[productID]; !ok {
+			cartError(c, errProductNotFound)
+			return
+		}
+	}
 
-	// Set new total
-	totalPrice := session.Total + product.Price*int(math.Abs(float64(item.Quantity-itemOldQuantity)))
-	if err := db.Model(&session).Update("total", totalPrice).Error; err != nil {
-		response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
-		c.JSON(http.StatusInternalServerError, response)
+	err = db.Transaction(func(tx *gorm.DB) error {
+		return models.ReplaceCart(tx, cartOwner(c), products, replaceInput.Items)
+	})
+
+	if err != nil {
+		cartError(c, err)
 		return
 	}
 
-	response := utils.ResponseAPI("Cart item updated successfully!", http.StatusOK, "success", nil)
-	c.JSON(http.StatusOK, response)
+	cartChanged(c, "Cart replaced successfully!")
 }
 
 // @Summary 	Drop shopping cart.
-// @Description Delete shopping session and all items in cart for current logged in user.
+// @Description Delete shopping session and all items in cart for current logged in user, or of the guest cart.
 // @Tags 		Shopping Service
 // @Produce 	json
 // @Success 	200 {object} map[string]interface{}
 // @Router 		/auth/shopping/v1/cart [delete]
+// @Router 		/shopping/v1/guest/cart [delete]
+// @Param 		X-Cart-Token header string false "Cart token of a guest cart, required instead of logging in on guest routes."
 // @Security 	BearerToken
 func DropCart(c *gin.Context) {
-	// Check active shopping session by user_id
+	// Check active shopping session by user_id or guest cart token
 	//		If exist then delete session and delete all cart items related to the session
 	//		If not exist then return "no cart to be dropped"
 	db := c.MustGet("db").(*gorm.DB)
 	var session models.ShoppingSession
-	userID := c.Request.Header.Get("X-User-ID")
 
-	if err := db.Where("user_id = ?", userID).Last(&session).Error; err != nil {
+	if err := cartOwner(c).Sessions(db).Last(&session).Error; err != nil {
 		response := utils.ResponseAPI("No cart to be dropped!", http.StatusBadRequest, "error", nil)
 		c.JSON(http.StatusBadRequest, response)
 		return
 	}
 
+	if session.Status == models.SessionReserved {
+		response := utils.ResponseAPI("Cart is being checked out!", http.StatusConflict, "error", nil)
+		c.JSON(http.StatusConflict, response)
+		return
+	}
+
 	var item models.CartItem
 	if err := db.Where("shopping_session_id = ?", session.ID).Delete(&item).Error; err != nil {
 		response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
@@ -293,21 +468,25 @@ func DropCart(c *gin.Context) {
 }
 
 // @Summary 	Checkout shopping cart.
-// @Description Bring all the items in cart to order.
+// @Description Bring all the items in cart to order, shipped to the address chosen from the address book (the default one when not chosen). Users need an address in their address book, add one with POST /auth/user/v1/addresses. A pending checkout tried again ships to the address chosen this time, the one chosen before when not chosen. The cart is kept if the order is rejected. When order service fails the checkout stays pending and is finished in the background or when tried again.
 // @Tags 		Shopping Service
+// @Param 		address_id query int false "Shipping address ID from user service address book."
 // @Produce 	json
 // @Success 	200 {object} map[string]interface{}
 // @Router 		/auth/shopping/v1/cart/checkout [get]
 // @Security 	BearerToken
 func Checkout(c *gin.Context) {
 	// Check active shopping session by user_id
-	//		If exist then:
-	//			Create order detail and get key, get cart items and store to order item with order detail key
-	//			Delete session and delete all cart items related to the session
+	//		If exist then run checkout saga:
+	//			Reprice the lines with current product prices
+	//			Reserve the cart (lock session, record pending checkout or resume the existing one with the address chosen)
+	//			Create order detail and order items in order service, it snapshots the shipping address
+	//			Order created: delete session and all cart items related to the session
+	//			Order rejected: release the session, cart items remain
 	//		If not exist then return "no cart to be checked out"
 	db := c.MustGet("db").(*gorm.DB)
 	var session models.ShoppingSession
-	userID := c.Request.Header.Get("X-User-ID")
+	userID := auth.UserID(c)
 
 	if err := db.Where("user_id = ?", userID).Last(&session).Error; err != nil {
 		response := utils.ResponseAPI("No cart to be checked out!", http.StatusBadRequest, "error", nil)
@@ -315,56 +494,48 @@ func Checkout(c *gin.Context) {
 		return
 	}
 
-	var cartItems []models.CartItem
-	if err := db.Where("shopping_session_id = ?", session.ID).Find(&cartItems).Error; err != nil {
-		response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
-		c.JSON(http.StatusInternalServerError, response)
+	addressID, err := strconv.ParseUint(c.DefaultQuery("address_id", "0"), 10, 32)
+	if err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusBadRequest, "error", nil)
+		c.JSON(http.StatusBadRequest, response)
 		return
 	}
 
-	var sessionOrder models.ShoppingSessionOrder
-	sessionOrder.UserID = session.UserID
-	sessionOrder.Total = session.Total
-
-	var cartItemsOrder []models.CartItemOrder
-	for i := range cartItems {
-		var cartItemOrder models.CartItemOrder
-
-		cartItemOrder.ProductID = cartItems[i].ProductID
-		cartItemOrder.Quantity = cartItems[i].Quantity
+	repriceCart(db, session)
 
-		cartItemsOrder = append(cartItemsOrder, cartItemOrder)
-	}
-
-	data := map[string]interface{}{
-		"session": sessionOrder,
-		"items":   cartItemsOrder,
+	checkout, err := reserveCart(db, &session, uint(addressID))
+	if err == errCartEmpty {
+		response := utils.ResponseAPI(err.Error(), http.StatusBadRequest, "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
 	}
 
-	client := resty.New()
-	resp, err := client.R().SetBody(data).Post("http://" + orderBaseURL + "/order")
-
 	if err != nil {
 		response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
 		c.JSON(http.StatusInternalServerError, response)
 		return
 	}
 
-	fmt.Println(resp)
+	checkout, err = runCheckout(db, checkout)
+	if err != nil {
+		// Outcome unknown, checkout stays pending and cart stays locked until it's resumed
+		var checkoutResponse models.CheckoutResponse
+		copier.Copy(&checkoutResponse, &checkout)
 
-	var modelCartItem models.CartItem
-	if err := db.Where("shopping_session_id = ?", session.ID).Delete(&modelCartItem).Error; err != nil {
-		response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
-		c.JSON(http.StatusInternalServerError, response)
+		response := utils.ResponseAPI("Checkout is pending, please try again later!", http.StatusServiceUnavailable, "error", checkoutResponse)
+		c.JSON(http.StatusServiceUnavailable, response)
 		return
 	}
 
-	if err := db.Delete(&session).Error; err != nil {
-		response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
-		c.JSON(http.StatusInternalServerError, response)
+	var checkoutResponse models.CheckoutResponse
+	copier.Copy(&checkoutResponse, &checkout)
+
+	if checkout.Status != models.CheckoutCommitted {
+		response := utils.ResponseAPI("Checkout failed: "+checkout.Message, http.StatusBadRequest, "error", checkoutResponse)
+		c.JSON(http.StatusBadRequest, response)
 		return
 	}
 
-	response := utils.ResponseAPI("Order created successfully!", http.StatusOK, "success", nil)
+	response := utils.ResponseAPI("Order created successfully!", http.StatusOK, "success", checkoutResponse)
 	c.JSON(http.StatusOK, response)
 }
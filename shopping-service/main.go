@@ -6,22 +6,40 @@ import (
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/tengkuroman/microshop/common/auth"
 	"github.com/tengkuroman/microshop/shopping-service/config"
 	"github.com/tengkuroman/microshop/shopping-service/controllers"
+	"github.com/tengkuroman/microshop/shopping-service/middlewares"
 	"golang.org/x/sync/errgroup"
 )
 
 var g errgroup.Group
 
-func routeNonAuth() http.Handler {
+func routeNonAuth(key string, value interface{}) http.Handler {
 	r := gin.Default()
 
 	// Set allow CORS
 	r.Use(cors.Default())
 
+	// Set context
+	r.Use(func(c *gin.Context) {
+		c.Set(key, value)
+	})
+
 	// Routes (health check)
 	r.GET("/", controllers.HealthCheck)
 
+	// Guest route, the cart is identified by the cart token instead of a logged in user
+	r.POST("/guest/carts", controllers.CreateGuestCart)
+
+	guest := r.Group("/guest", middlewares.RequireCartToken())
+	guest.POST("/cart", controllers.AddProductToCart)
+	guest.GET("/cart", controllers.GetCartItems)
+	guest.PATCH("/cart", controllers.UpdateCartItem)
+	guest.DELETE("/cart", controllers.DropCart)
+	guest.PUT("/cart", controllers.ReplaceCart)
+	guest.DELETE("/cart/items/:product_id", controllers.RemoveCartItem)
+
 	return r
 }
 
@@ -36,12 +54,22 @@ func routeAuth(key string, value interface{}) http.Handler {
 		c.Set(key, value)
 	})
 
+	// Every route needs a logged in user
+	r.Use(auth.RequireAuth())
+
 	// Buyer route
 	r.POST("/cart", controllers.AddProductToCart)
 	r.GET("/cart", controllers.GetCartItems)
 	r.PATCH("/cart", controllers.UpdateCartItem)
 	r.DELETE("/cart", controllers.DropCart)
+	r.PUT("/cart", controllers.ReplaceCart)
+	r.DELETE("/cart/items/:product_id", controllers.RemoveCartItem)
+	r.POST("/cart/items/:product_id/save", controllers.SaveCartItemForLater)
+	r.GET("/cart/saved", controllers.GetSavedItems)
+	r.POST("/cart/saved/:product_id/restore", controllers.MoveSavedItemToCart)
+	r.DELETE("/cart/saved/:product_id", controllers.DeleteSavedItem)
 	r.GET("/cart/checkout", controllers.Checkout)
+	r.POST("/cart/merge", controllers.MergeGuestCart)
 
 	return r
 }
@@ -52,9 +80,18 @@ func main() {
 	databaseSQL, _ := db.DB()
 	defer databaseSQL.Close()
 
+	// Resume checkouts interrupted by previous run or order service failure
+	go controllers.ResumeCheckouts(db)
+
+	// Clean up guest carts nobody came back to
+	go controllers.DeleteExpiredGuestCarts(db)
+
+	// Price cart lines stored before lines were priced
+	go controllers.PriceUnpricedCartItems(db)
+
 	serverNonAuth := &http.Server{
 		Addr:    ":8080",
-		Handler: routeNonAuth(),
+		Handler: routeNonAuth("db", db),
 	}
 
 	serverAuth := &http.Server{
@@ -0,0 +1,30 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"github.com/tengkuroman/microshop/shopping-service/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Header carrying the cart token of a guest cart
+const CartTokenHeader = "X-Cart-Token"
+
+// RequireCartToken rejects guest requests without a cart token (401)
+func RequireCartToken() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if CartToken(c) == "" {
+			response := utils.ResponseAPI("Cart token required!", http.StatusUnauthorized, "unauthorized", nil)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, response)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// Cart token of the guest cart requested, empty when not sent
+func CartToken(c *gin.Context) string {
+	return c.GetHeader(CartTokenHeader)
+}
@@ -1,24 +1,394 @@
 package models
 
 import (
+	"errors"
+
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrCartNotFound      = errors.New("No items added to the cart!")
+	ErrCartReserved      = errors.New("Cart is being checked out!")
+	ErrCartItemNotFound  = errors.New("Product is not in the cart, please use add product method!")
+	ErrInsufficientStock = errors.New("Insufficient product stock!")
 )
 
+// One line per product in a session, adding the product again adds to its quantity
 type CartItem struct {
 	gorm.Model
 	Quantity          int
-	ProductID         uint
-	ShoppingSessionID uint
+	ProductID         uint `gorm:"uniqueIndex:idx_cart_items_session_product,where:deleted_at IS NULL"`
+	ShoppingSessionID uint `gorm:"uniqueIndex:idx_cart_items_session_product,where:deleted_at IS NULL"`
+	ProductName       string
+	UnitPrice         int // product price when the line was last changed or the cart was last checked out
+	AddedPrice        int // product price when the user last added or changed the line
 }
 
 type CartItemInput struct {
-	Quantity  int  `binding:"required" json:"quantity"`
+	Quantity  int  `binding:"required,min=1" json:"quantity"`
+	ProductID uint `binding:"required" json:"product_id"`
+}
+
+// Quantity 0 removes the product from the cart, a missing quantity is rejected instead of removing it
+type CartItemUpdateInput struct {
+	Quantity  *int `binding:"required,min=0" json:"quantity"`
 	ProductID uint `binding:"required" json:"product_id"`
 }
 
+// Items replacing the whole cart, an empty list empties it
+type CartReplaceInput struct {
+	Items []CartItemInput `binding:"dive" json:"items"`
+}
+
 type CartItemResponse struct {
-	ID                uint `json:"id"`
-	Quantity          int  `json:"quantity"`
-	ProductID         uint `json:"product_id"`
-	ShoppingSessionID uint `json:"shopping_session_id"`
+	ID             uint   `json:"id"`
+	ProductID      uint   `json:"product_id"`
+	ProductName    string `json:"product_name"`
+	ImageURL       string `json:"image_url"`
+	SellerID       uint   `json:"seller_id"`
+	Quantity       int    `json:"quantity"`
+	UnitPrice      int    `json:"unit_price"`
+	AddedPrice     int    `json:"added_price"`
+	Subtotal       int    `json:"subtotal"`
+	AvailableStock int    `json:"available_stock"`
+	Available      bool   `json:"available"`       // product exists with enough stock for the quantity
+	PriceChanged   bool   `json:"price_changed"`   // price differs from when the line was added or changed
+	ProductDeleted bool   `json:"product_deleted"` // product removed from the shop since it was added
+}
+
+type CartResponse struct {
+	ShoppingSessionID uint               `json:"shopping_session_id"`
+	Status            string             `json:"status"`
+	Items             []CartItemResponse `json:"items"`
+	Total             int                `json:"total"`
+}
+
+// Product data a cart line is priced with, from product service
+type CartProduct struct {
+	ID       uint
+	Name     string
+	ImageURL string
+	Price    int
+	Stock    int
+	SellerID uint
+}
+
+// Latest session of the owner, locked until the transaction ends. Changes are refused while it's checked out.
+func lockCart(tx *gorm.DB, owner CartOwner) (ShoppingSession, error) {
+	var session ShoppingSession
+	if err := owner.Sessions(tx.Clauses(clause.Locking{Strength: "UPDATE"})).Last(&session).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) && owner.Guest() {
+			return ShoppingSession{}, ErrGuestCartNotFound
+		}
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ShoppingSession{}, ErrCartNotFound
+		}
+		return ShoppingSession{}, err
+	}
+
+	if session.Status == SessionReserved {
+		return ShoppingSession{}, ErrCartReserved
+	}
+
+	return session, nil
+}
+
+// Locked cart of the owner, a new one when the user has none. Guest carts are only created by CreateGuestCart,
+// so a guest can't get a cart for a token of their choice.
+func lockOrCreateCart(tx *gorm.DB, owner CartOwner) (ShoppingSession, error) {
+	session, err := lockCart(tx, owner)
+	if err != ErrCartNotFound {
+		return session, err
+	}
+
+	// Concurrent first adds create one cart, the others lock the cart created
+	session = ShoppingSession{UserID: owner.UserID, GuestTokenHash: owner.GuestTokenHash, Status: SessionActive}
+	result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&session)
+	if result.Error != nil || result.RowsAffected == 1 {
+		return session, result.Error
+	}
+
+	return lockCart(tx, owner)
+}
+
+// Set session total to the sum of its line subtotals
+func recomputeTotal(tx *gorm.DB, sessionID uint) error {
+	return tx.Model(&ShoppingSession{}).Where("id = ?", sessionID).
+		Update("total", tx.Model(&CartItem{}).Select("COALESCE(SUM(quantity * unit_price), 0)").Where("shopping_session_id = ?", sessionID)).Error
+}
+
+// Add quantity of the product to the cart of the owner, creating the cart or the line when there is none
+func AddCartItem(tx *gorm.DB, owner CartOwner, product CartProduct, quantity int) error {
+	session, err := lockOrCreateCart(tx, owner)
+	if err != nil {
+		return err
+	}
+
+	var item CartItem
+	err = tx.Where("shopping_session_id = ? AND product_id = ?", session.ID, product.ID).First(&item).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	// Quantity already in the cart counts to the stock
+	if product.Stock < item.Quantity+quantity {
+		return ErrInsufficientStock
+	}
+
+	item.ShoppingSessionID = session.ID
+	item.ProductID = product.ID
+	item.ProductName = product.Name
+	item.UnitPrice = product.Price
+	item.AddedPrice = product.Price
+	item.Quantity += quantity
+	if err := tx.Save(&item).Error; err != nil {
+		return err
+	}
+
+	return recomputeTotal(tx, session.ID)
+}
+
+func findCartItem(tx *gorm.DB, sessionID uint, productID uint) (CartItem, error) {
+	var item CartItem
+	if err := tx.Where("shopping_session_id = ? AND product_id = ?", sessionID, productID).First(&item).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return CartItem{}, ErrCartItemNotFound
+		}
+		return CartItem{}, err
+	}
+
+	return item, nil
+}
+
+// Set quantity of a product already in the cart of the owner, quantity 0 removes it
+func SetCartItemQuantity(tx *gorm.DB, owner CartOwner, product CartProduct, quantity int) error {
+	session, err := lockCart(tx, owner)
+	if err != nil {
+		return err
+	}
+
+	item, err := findCartItem(tx, session.ID, product.ID)
+	if err != nil {
+		return err
+	}
+
+	if quantity == 0 {
+		if err := tx.Delete(&item).Error; err != nil {
+			return err
+		}
+
+		return recomputeTotal(tx, session.ID)
+	}
+
+	if product.Stock < quantity {
+		return ErrInsufficientStock
+	}
+
+	err = tx.Model(&item).Updates(CartItem{Quantity: quantity, ProductName: product.Name, UnitPrice: product.Price, AddedPrice: product.Price}).Error
+	if err != nil {
+		return err
+	}
+
+	return recomputeTotal(tx, session.ID)
+}
+
+// Remove the line of a product from the cart of the owner
+func RemoveCartItem(tx *gorm.DB, owner CartOwner, productID uint) error {
+	session, err := lockCart(tx, owner)
+	if err != nil {
+		return err
+	}
+
+	item, err := findCartItem(tx, session.ID, productID)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Delete(&item).Error; err != nil {
+		return err
+	}
+
+	return recomputeTotal(tx, session.ID)
+}
+
+// Replace every line of the cart of the owner, creating the cart when there is none.
+// Quantities of a product listed twice are added up.
+func ReplaceCart(tx *gorm.DB, owner CartOwner, products map[uint]CartProduct, items []CartItemInput) error {
+	session, err := lockOrCreateCart(tx, owner)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Where("shopping_session_id = ?", session.ID).Delete(&CartItem{}).Error; err != nil {
+		return err
+	}
+
+	quantities := make(map[uint]int)
+	var productIDs []uint
+	for _, item := range items {
+		if _, ok := quantities[item.ProductID]; !ok {
+			productIDs = append(productIDs, item.ProductID)
+		}
+		quantities[item.ProductID] += item.Quantity
+	}
+
+	for _, productID := range productIDs {
+		product := products[productID]
+		if product.Stock < quantities[productID] {
+			return ErrInsufficientStock
+		}
+
+		item := CartItem{
+			ShoppingSessionID: session.ID,
+			ProductID:         productID,
+			ProductName:       product.Name,
+			UnitPrice:         product.Price,
+			AddedPrice:        product.Price,
+			Quantity:          quantities[productID],
+		}
+		if err := tx.Create(&item).Error; err != nil {
+			return err
+		}
+	}
+
+	return recomputeTotal(tx, session.ID)
+}
+
+// Reprice lines with the current product data, lines of products not given keep their price. Done at checkout,
+// reading the cart shows current prices without storing them.
+func RepriceCart(tx *gorm.DB, owner CartOwner, products map[uint]CartProduct) error {
+	session, err := lockCart(tx, owner)
+	if err != nil {
+		return err
+	}
+
+	var items []CartItem
+	if err := tx.Where("shopping_session_id = ?", session.ID).Find(&items).Error; err != nil {
+		return err
+	}
+
+	for i := range items {
+		product, ok := products[items[i].ProductID]
+		if !ok || (product.Price == items[i].UnitPrice && product.Name == items[i].ProductName) {
+			continue
+		}
+
+		if err := tx.Model(&items[i]).Updates(CartItem{ProductName: product.Name, UnitPrice: product.Price}).Error; err != nil {
+			return err
+		}
+	}
+
+	return recomputeTotal(tx, session.ID)
+}
+
+// IDs of the products in the cart
+func (cart CartResponse) ProductIDs() []uint {
+	var productIDs []uint
+	for _, item := range cart.Items {
+		productIDs = append(productIDs, item.ProductID)
+	}
+
+	return productIDs
+}
+
+// Cart of the owner with line subtotals and total, read only. Lines are priced and enriched with the current
+// product data given unless the cart is being checked out, a product missing from it is flagged as deleted.
+// Without product data (nil) lines are left as stored.
+func GetCart(db *gorm.DB, owner CartOwner, products map[uint]CartProduct) (CartResponse, error) {
+	var session ShoppingSession
+	if err := owner.Sessions(db).Last(&session).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) && owner.Guest() {
+			return CartResponse{}, ErrGuestCartNotFound
+		}
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return CartResponse{}, ErrCartNotFound
+		}
+		return CartResponse{}, err
+	}
+
+	var items []CartItem
+	if err := db.Where("shopping_session_id = ?", session.ID).Order("id").Find(&items).Error; err != nil {
+		return CartResponse{}, err
+	}
+
+	cart := CartResponse{
+		ShoppingSessionID: session.ID,
+		Status:            session.Status,
+		Items:             []CartItemResponse{},
+		Total:             session.Total,
+	}
+
+	for _, item := range items {
+		line := CartItemResponse{
+			ID:           item.ID,
+			ProductID:    item.ProductID,
+			ProductName:  item.ProductName,
+			Quantity:     item.Quantity,
+			UnitPrice:    item.UnitPrice,
+			AddedPrice:   item.AddedPrice,
+			Subtotal:     item.Quantity * item.UnitPrice,
+			PriceChanged: item.UnitPrice != item.AddedPrice,
+		}
+
+		if products != nil {
+			product, ok := products[item.ProductID]
+			if ok && session.Status != SessionReserved {
+				line.ProductName = product.Name
+				line.UnitPrice = product.Price
+				line.Subtotal = item.Quantity * product.Price
+				line.PriceChanged = product.Price != item.AddedPrice
+			}
+
+			line.ImageURL = product.ImageURL
+			line.SellerID = product.SellerID
+			line.AvailableStock = product.Stock
+			line.Available = ok && product.Stock >= item.Quantity
+			line.ProductDeleted = !ok
+		}
+
+		cart.Items = append(cart.Items, line)
+	}
+
+	if products != nil && session.Status != SessionReserved {
+		cart.Total = 0
+		for _, line := range cart.Items {
+			cart.Total += line.Subtotal
+		}
+	}
+
+	return cart, nil
+}
+
+// Products of lines stored before lines were priced (no name and price), to be priced by PriceUnpricedCartItems
+func UnpricedCartProductIDs(db *gorm.DB) ([]uint, error) {
+	var productIDs []uint
+	err := db.Model(&CartItem{}).Distinct("product_id").Where("unit_price = 0 AND product_name = ''").Pluck("product_id", &productIDs).Error
+
+	return productIDs, err
+}
+
+// Price lines stored before lines were priced with the current product data, then recompute the totals of their carts.
+// Lines of products not given (deleted) stay unpriced.
+func PriceUnpricedCartItems(tx *gorm.DB, products map[uint]CartProduct) error {
+	var sessionIDs []uint
+	if err := tx.Model(&CartItem{}).Distinct("shopping_session_id").Where("unit_price = 0 AND product_name = ''").Pluck("shopping_session_id", &sessionIDs).Error; err != nil {
+		return err
+	}
+
+	for productID, product := range products {
+		err := tx.Model(&CartItem{}).Where("product_id = ? AND unit_price = 0 AND product_name = ''", productID).
+			Updates(map[string]interface{}{"product_name": product.Name, "unit_price": product.Price, "added_price": product.Price}).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, sessionID := range sessionIDs {
+		if err := recomputeTotal(tx, sessionID); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
@@ -0,0 +1,28 @@
+package models
+
+import "gorm.io/gorm"
+
+// Checkout saga status
+const (
+	CheckoutPending    = "pending"
+	CheckoutCommitted  = "committed"
+	CheckoutRolledBack = "rolled_back"
+)
+
+// Checkout records every checkout attempt so an interrupted one can be resumed
+type Checkout struct {
+	gorm.Model
+	ShoppingSessionID uint
+	UserID            uint
+	Status            string `gorm:"index"`
+	OrderDetailID     uint
+	Message           string
+	AddressID         uint // shipping address chosen in user service, 0 for the default one
+}
+
+type CheckoutResponse struct {
+	ID            uint   `json:"checkout_id"`
+	Status        string `json:"status"`
+	OrderDetailID uint   `json:"order_detail_id"`
+	Message       string `json:"message"`
+}
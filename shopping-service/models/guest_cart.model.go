@@ -0,0 +1,127 @@
+package models
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// Rules of merging a guest cart line of a product already in the user cart
+const (
+	MergeSum       = "sum"        // add the quantities up
+	MergeMax       = "max"        // keep the larger quantity
+	MergeKeepUser  = "keep_user"  // keep the user cart line
+	MergeKeepGuest = "keep_guest" // guest cart line replaces the user cart line
+)
+
+var ErrGuestCartNotFound = errors.New("Guest cart not found!")
+
+type GuestCartResponse struct {
+	CartToken string `json:"cart_token"`
+}
+
+// Rule empty uses the default rule of the service
+type CartMergeInput struct {
+	CartToken string `binding:"required" json:"cart_token"`
+	Rule      string `binding:"omitempty,oneof=sum max keep_user keep_guest" json:"rule"`
+}
+
+func ValidMergeRule(rule string) bool {
+	switch rule {
+	case MergeSum, MergeMax, MergeKeepUser, MergeKeepGuest:
+		return true
+	}
+
+	return false
+}
+
+// Empty cart of a guest, identified by the hash of its cart token
+func CreateGuestCart(tx *gorm.DB, guestTokenHash string) error {
+	return tx.Create(&ShoppingSession{GuestTokenHash: guestTokenHash, Status: SessionActive}).Error
+}
+
+// Fold the guest cart into the cart of the user and delete it. Lines of products in both carts are merged by the rule,
+// the other guest lines are moved as they are. Summed or larger quantities are capped to the stock of the product
+// (products missing from products are left as they are), a merge never lowers the quantity of a user cart line.
+func MergeGuestCart(tx *gorm.DB, userID uint, guestTokenHash string, rule string, products map[uint]CartProduct) error {
+	guest, err := lockCart(tx, GuestCart(guestTokenHash))
+	if err != nil {
+		return err
+	}
+
+	session, err := lockOrCreateCart(tx, UserCart(userID))
+	if err != nil {
+		return err
+	}
+
+	var guestItems []CartItem
+	if err := tx.Where("shopping_session_id = ?", guest.ID).Find(&guestItems).Error; err != nil {
+		return err
+	}
+
+	for _, guestItem := range guestItems {
+		item, err := findCartItem(tx, session.ID, guestItem.ProductID)
+		if err == ErrCartItemNotFound {
+			if err := tx.Model(&guestItem).Update("shopping_session_id", session.ID).Error; err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		item = mergeCartItem(rule, item, guestItem, products[item.ProductID])
+
+		if err := tx.Save(&item).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Delete(&guestItem).Error; err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Delete(&guest).Error; err != nil {
+		return err
+	}
+
+	return recomputeTotal(tx, session.ID)
+}
+
+// Line of the product in both carts merged into the user cart line by the rule
+func mergeCartItem(rule string, item CartItem, guestItem CartItem, product CartProduct) CartItem {
+	switch rule {
+	case MergeSum, MergeMax:
+		item.Quantity = mergedQuantity(rule, item.Quantity, guestItem.Quantity, product)
+	case MergeKeepGuest:
+		item.Quantity = guestItem.Quantity
+		item.ProductName = guestItem.ProductName
+		item.UnitPrice = guestItem.UnitPrice
+		item.AddedPrice = guestItem.AddedPrice
+	}
+
+	return item
+}
+
+// Quantity of a line in both carts merged by sum or max, capped to the stock of the product but not below the user quantity.
+// Product with zero ID is unknown, its quantity is not capped.
+func mergedQuantity(rule string, userQuantity int, guestQuantity int, product CartProduct) int {
+	quantity := userQuantity + guestQuantity
+	if rule == MergeMax {
+		quantity = userQuantity
+		if guestQuantity > quantity {
+			quantity = guestQuantity
+		}
+	}
+
+	if product.ID != 0 && quantity > product.Stock {
+		quantity = product.Stock
+	}
+
+	if quantity < userQuantity {
+		quantity = userQuantity
+	}
+
+	return quantity
+}
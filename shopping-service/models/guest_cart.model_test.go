@@ -0,0 +1,75 @@
+package models
+
+import "testing"
+
+func TestMergedQuantity(t *testing.T) {
+	inStock := func(stock int) CartProduct {
+		return CartProduct{ID: 1, Stock: stock}
+	}
+
+	tests := []struct {
+		name          string
+		rule          string
+		userQuantity  int
+		guestQuantity int
+		product       CartProduct
+		want          int
+	}{
+		{"sum", MergeSum, 2, 3, inStock(10), 5},
+		{"sum capped to stock", MergeSum, 2, 3, inStock(4), 4},
+		{"sum equal to stock", MergeSum, 2, 3, inStock(5), 5},
+		{"sum not below user quantity", MergeSum, 6, 3, inStock(4), 6},
+		{"sum out of stock keeps user quantity", MergeSum, 2, 3, inStock(0), 2},
+		{"max keeps guest quantity", MergeMax, 2, 3, inStock(10), 3},
+		{"max keeps user quantity", MergeMax, 5, 3, inStock(10), 5},
+		{"max capped to stock", MergeMax, 2, 8, inStock(4), 4},
+		{"max not below user quantity", MergeMax, 6, 8, inStock(4), 6},
+		{"unknown product is not capped", MergeSum, 2, 3, CartProduct{}, 5},
+		{"unknown product max", MergeMax, 2, 3, CartProduct{}, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mergedQuantity(tt.rule, tt.userQuantity, tt.guestQuantity, tt.product)
+			if got != tt.want {
+				t.Errorf("mergedQuantity(%s, %d, %d, stock %d) = %d, want %d", tt.rule, tt.userQuantity, tt.guestQuantity, tt.product.Stock, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeCartItem(t *testing.T) {
+	userItem := CartItem{Quantity: 2, ProductID: 1, ShoppingSessionID: 10, ProductName: "Old name", UnitPrice: 100, AddedPrice: 90}
+	guestItem := CartItem{Quantity: 3, ProductID: 1, ShoppingSessionID: 20, ProductName: "New name", UnitPrice: 120, AddedPrice: 120}
+	product := CartProduct{ID: 1, Name: "New name", Price: 120, Stock: 4}
+
+	// Only quantity, name and prices change, the line stays in the user cart
+	with := func(quantity int, name string, unitPrice int, addedPrice int) CartItem {
+		item := userItem
+		item.Quantity = quantity
+		item.ProductName = name
+		item.UnitPrice = unitPrice
+		item.AddedPrice = addedPrice
+		return item
+	}
+
+	tests := []struct {
+		name string
+		rule string
+		want CartItem
+	}{
+		{"sum capped to stock", MergeSum, with(4, "Old name", 100, 90)},
+		{"max", MergeMax, with(3, "Old name", 100, 90)},
+		{"keep user", MergeKeepUser, userItem},
+		{"keep guest", MergeKeepGuest, with(3, "New name", 120, 120)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mergeCartItem(tt.rule, userItem, guestItem, product)
+			if got != tt.want {
+				t.Errorf("mergeCartItem(%s) = %+v, want %+v", tt.rule, got, tt.want)
+			}
+		})
+	}
+}
@@ -7,11 +7,23 @@ type CartItemOrder struct {
 }
 
 type ShoppingSessionOrder struct {
-	Total  int  `binding:"required" json:"total"`
 	UserID uint `json:"user_id" binding:"required"`
 }
 
 type Order struct {
-	Session ShoppingSessionOrder `binding:"required" json:"session"`
-	Items   []CartItemInput      `binding:"required" json:"items"`
+	CheckoutID uint                 `json:"checkout_id"`
+	AddressID  uint                 `json:"address_id"` // 0 for the default address of the user
+	Session    ShoppingSessionOrder `binding:"required" json:"session"`
+	Items      []CartItemOrder      `binding:"required" json:"items"`
+}
+
+type OrderResponse struct {
+	Meta struct {
+		Message string `json:"message"`
+		Code    int    `json:"code"`
+		Status  string `json:"status"`
+	} `json:"meta"`
+	Data struct {
+		OrderDetailID uint `json:"order_detail_id"`
+	} `json:"data"`
 }
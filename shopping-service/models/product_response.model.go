@@ -1,12 +1,16 @@
 package models
 
-type ProductResponse struct {
+// Products by IDs from product service bulk lookup, IDs of deleted products are listed in MissingIDs
+type ProductLookupResponse struct {
 	Data struct {
-		Name        string `binding:"required"`
-		Description string `binding:"required"`
-		ImageURL    string `json:"image_url" binding:"required"`
-		Price       int    `binding:"required"`
-		UserID      uint   `json:"user_id" binding:"required"`
-		CategoryID  uint   `json:"category_url" binding:"required"`
-	} `binding:"required"`
+		Products []struct {
+			ID       uint   `json:"id"`
+			Name     string `json:"name"`
+			ImageURL string `json:"image_url"`
+			Price    int    `json:"price"`
+			Stock    int    `json:"stock"`
+			UserID   uint   `json:"seller_id"`
+		} `json:"products"`
+		MissingIDs []uint `json:"missing_ids"`
+	} `json:"data"`
 }
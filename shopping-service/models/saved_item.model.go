@@ -0,0 +1,117 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var ErrSavedItemNotFound = errors.New("Product is not in the saved for later list!")
+
+// Product moved out of the cart to buy later, kept per user across checkouts
+type SavedItem struct {
+	gorm.Model
+	UserID      uint `gorm:"uniqueIndex:idx_saved_items_user_product,where:deleted_at IS NULL"`
+	ProductID   uint `gorm:"uniqueIndex:idx_saved_items_user_product,where:deleted_at IS NULL"`
+	ProductName string
+	Quantity    int
+}
+
+type SavedItemResponse struct {
+	ProductID   uint      `json:"product_id"`
+	ProductName string    `json:"product_name"`
+	Quantity    int       `json:"quantity"`
+	SavedAt     time.Time `json:"saved_at"`
+}
+
+func findSavedItem(tx *gorm.DB, userID uint, productID uint) (SavedItem, error) {
+	var item SavedItem
+	if err := tx.Where("user_id = ? AND product_id = ?", userID, productID).First(&item).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return SavedItem{}, ErrSavedItemNotFound
+		}
+		return SavedItem{}, err
+	}
+
+	return item, nil
+}
+
+// Move the line of a product from the cart to the saved for later list, quantity is added to one saved before
+func SaveCartItemForLater(tx *gorm.DB, userID uint, productID uint) error {
+	session, err := lockCart(tx, UserCart(userID))
+	if err != nil {
+		return err
+	}
+
+	cartItem, err := findCartItem(tx, session.ID, productID)
+	if err != nil {
+		return err
+	}
+
+	savedItem, err := findSavedItem(tx, userID, productID)
+	if err != nil && err != ErrSavedItemNotFound {
+		return err
+	}
+
+	savedItem.UserID = userID
+	savedItem.ProductID = productID
+	savedItem.ProductName = cartItem.ProductName
+	savedItem.Quantity += cartItem.Quantity
+	if err := tx.Save(&savedItem).Error; err != nil {
+		return err
+	}
+
+	if err := tx.Delete(&cartItem).Error; err != nil {
+		return err
+	}
+
+	return recomputeTotal(tx, session.ID)
+}
+
+// Move a saved product back to the cart with its saved quantity, priced with the current product data
+func MoveSavedItemToCart(tx *gorm.DB, userID uint, product CartProduct) error {
+	// Cart lock also serializes changes of the saved list of the user
+	if _, err := lockOrCreateCart(tx, UserCart(userID)); err != nil {
+		return err
+	}
+
+	savedItem, err := findSavedItem(tx, userID, product.ID)
+	if err != nil {
+		return err
+	}
+
+	if err := AddCartItem(tx, UserCart(userID), product, savedItem.Quantity); err != nil {
+		return err
+	}
+
+	return tx.Delete(&savedItem).Error
+}
+
+func DeleteSavedItem(tx *gorm.DB, userID uint, productID uint) error {
+	savedItem, err := findSavedItem(tx, userID, productID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Delete(&savedItem).Error
+}
+
+func GetSavedItems(db *gorm.DB, userID uint) ([]SavedItemResponse, error) {
+	var items []SavedItem
+	if err := db.Where("user_id = ?", userID).Order("id DESC").Find(&items).Error; err != nil {
+		return nil, err
+	}
+
+	result := []SavedItemResponse{}
+	for _, item := range items {
+		result = append(result, SavedItemResponse{
+			ProductID:   item.ProductID,
+			ProductName: item.ProductName,
+			Quantity:    item.Quantity,
+			SavedAt:     item.CreatedAt,
+		})
+	}
+
+	return result, nil
+}
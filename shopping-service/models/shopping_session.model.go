@@ -1,10 +1,83 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"os"
+	"strconv"
+	"time"
 
+	"gorm.io/gorm"
+)
+
+// Shopping session status
+const (
+	SessionActive   = "active"
+	SessionReserved = "reserved" // locked while its checkout is in progress
+)
+
+// One cart per user or guest cart token, checked out carts are deleted
 type ShoppingSession struct {
 	gorm.Model
-	Total    int
-	UserID   uint
-	CartItem []CartItem
+	Total          int
+	UserID         uint   `gorm:"uniqueIndex:idx_shopping_sessions_user,where:user_id <> 0 AND deleted_at IS NULL"` // 0 for guest carts
+	GuestTokenHash string `gorm:"uniqueIndex:idx_shopping_sessions_guest,where:user_id = 0 AND deleted_at IS NULL"` // hash of the cart token of a guest cart, empty for user carts
+	Status         string `gorm:"default:active"`
+	CartItem       []CartItem
+}
+
+// Days a guest cart is kept after its last change
+var guestCartDayLifespan = os.Getenv("GUEST_CART_DAY_LIFESPAN")
+
+// Guest carts last changed before this time are expired
+func guestCartExpiry() time.Time {
+	lifespan, err := strconv.Atoi(guestCartDayLifespan)
+	if err != nil || lifespan <= 0 {
+		lifespan = 30
+	}
+
+	return time.Now().AddDate(0, 0, -lifespan)
+}
+
+// Owner of a cart: a logged in user, or a guest holding the cart token
+type CartOwner struct {
+	UserID         uint
+	GuestTokenHash string
+}
+
+func UserCart(userID uint) CartOwner {
+	return CartOwner{UserID: userID}
+}
+
+func GuestCart(guestTokenHash string) CartOwner {
+	return CartOwner{GuestTokenHash: guestTokenHash}
+}
+
+func (owner CartOwner) Guest() bool {
+	return owner.UserID == 0
+}
+
+// Sessions of the owner, expired guest carts are left out
+func (owner CartOwner) Sessions(db *gorm.DB) *gorm.DB {
+	if !owner.Guest() {
+		return db.Where("user_id = ?", owner.UserID)
+	}
+
+	return db.Where("user_id = 0 AND guest_token_hash = ? AND updated_at > ?", owner.GuestTokenHash, guestCartExpiry())
+}
+
+// Delete guest carts not changed within their lifespan with their lines, returns how many were deleted
+func DeleteExpiredGuestCarts(db *gorm.DB) (int64, error) {
+	var deleted int64
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		expired := tx.Model(&ShoppingSession{}).Unscoped().Select("id").Where("user_id = 0 AND updated_at <= ?", guestCartExpiry())
+		if err := tx.Unscoped().Where("shopping_session_id IN (?)", expired).Delete(&CartItem{}).Error; err != nil {
+			return err
+		}
+
+		result := tx.Unscoped().Where("user_id = 0 AND updated_at <= ?", guestCartExpiry()).Delete(&ShoppingSession{})
+		deleted = result.RowsAffected
+		return result.Error
+	})
+
+	return deleted, err
 }
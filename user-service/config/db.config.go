@@ -1,7 +1,9 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"log"
 	"os"
 
 	"github.com/tengkuroman/microshop/user-service/models"
@@ -23,7 +25,83 @@ func ConnectDatabase() *gorm.DB {
 		panic(err.Error())
 	}
 
-	db.AutoMigrate(&models.User{})
+	// Users registered before email verification keep being able to login
+	verifyExistingUsers := db.Migrator().HasTable(&models.User{}) && !db.Migrator().HasColumn(&models.User{}, "email_verified_at")
+
+	// Free text addresses are imported once, when the address book is created
+	importAddresses := db.Migrator().HasTable(&models.User{}) && !db.Migrator().HasTable(&models.Address{})
+
+	db.AutoMigrate(
+		&models.User{},
+		&models.Session{},
+		&models.RefreshToken{},
+		&models.UserRole{},
+		&models.RoleAudit{},
+		&models.SellerApplication{},
+		&models.SigningKey{},
+		&models.UserToken{},
+		&models.LoginThrottle{},
+		&models.LoginAudit{},
+		&models.TwoFactor{},
+		&models.RecoveryCode{},
+		&models.LoginChallenge{},
+		&models.Address{},
+	)
+
+	if verifyExistingUsers {
+		db.Exec("UPDATE users SET email_verified_at = created_at WHERE email_verified_at IS NULL")
+	}
+
+	// Free text address of users from before the address book becomes their default address
+	if importAddresses {
+		db.Exec(`INSERT INTO addresses (created_at, updated_at, user_id, label, recipient, street, city, postal_code, country, phone, is_default)
+			SELECT NOW(), NOW(), id, 'Imported', TRIM(first_name || ' ' || last_name), address, '', '', '', COALESCE(phone_number, ''), TRUE
+			FROM users WHERE deleted_at IS NULL AND TRIM(COALESCE(address, '')) <> ''
+			AND NOT EXISTS (SELECT 1 FROM addresses WHERE addresses.user_id = users.id)`)
+	}
+
+	// Usernames and emails are unique regardless of case, fails when existing users only differ by case
+	for _, column := range []string{"username", "email"} {
+		if err := db.Exec(fmt.Sprintf("CREATE UNIQUE INDEX IF NOT EXISTS idx_users_%s_lower ON users (LOWER(%s))", column, column)).Error; err != nil {
+			log.Printf("Create case-insensitive unique index on %s failed: %v\n", column, err)
+		}
+	}
+
+	// Single self-switched role replaced by user roles. Sellers are kept, admins are not
+	// because anyone could switch to admin.
+	if db.Migrator().HasColumn(&models.User{}, "role") {
+		db.Exec("INSERT INTO user_roles (user_id, role, granted_by, created_at) SELECT id, ?, 0, NOW() FROM users ON CONFLICT DO NOTHING", models.RoleUser)
+		db.Exec("INSERT INTO user_roles (user_id, role, granted_by, created_at) SELECT id, ?, 0, NOW() FROM users WHERE role = ? ON CONFLICT DO NOTHING", models.RoleSeller, models.RoleSeller)
+		db.Migrator().DropColumn(&models.User{}, "role")
+	}
 
 	return db
 }
+
+var errAdminExists = errors.New("An admin already exists, admins are granted by admins!")
+
+// Grant admin to the user when there is no admin yet, other admins are granted by admins.
+// Run once with the -bootstrap-admin flag, it does nothing once an admin exists.
+func BootstrapAdmin(db *gorm.DB, userID uint) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		// Serialize bootstraps so only one user can become the first admin
+		if err := tx.Exec("LOCK TABLE user_roles IN SHARE ROW EXCLUSIVE MODE").Error; err != nil {
+			return err
+		}
+
+		var admins int64
+		if err := tx.Model(&models.UserRole{}).Where("role = ?", models.RoleAdmin).Count(&admins).Error; err != nil {
+			return err
+		}
+
+		if admins > 0 {
+			return errAdminExists
+		}
+
+		if _, err := models.ActiveUser(tx, userID); err != nil {
+			return err
+		}
+
+		return models.GrantRole(tx, userID, models.RoleAdmin, 0, "Bootstrap admin")
+	})
+}
@@ -0,0 +1,233 @@
+package controllers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/jinzhu/copier"
+	"github.com/tengkuroman/microshop/user-service/mailers"
+	"github.com/tengkuroman/microshop/user-service/models"
+	"github.com/tengkuroman/microshop/user-service/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Mail a new token of the purpose to the user's email
+func sendUserToken(db *gorm.DB, user models.User, purpose string) error {
+	sender, err := mailers.Default()
+	if err != nil {
+		return err
+	}
+
+	token, err := models.IssueUserToken(db, user, purpose)
+	if err != nil {
+		return err
+	}
+
+	message := mailers.Message{
+		To:      user.Email,
+		Subject: "Verify your Microshop email",
+		Body:    fmt.Sprintf("Hi %s,\n\nUse this token to verify your email:\n\n%s\n\nIgnore this email if you didn't register to Microshop.", user.FirstName, token),
+	}
+
+	if purpose == models.TokenPasswordReset {
+		message.Subject = "Reset your Microshop password"
+		message.Body = fmt.Sprintf("Hi %s,\n\nUse this token to reset your password, it can only be used once:\n\n%s\n\nIgnore this email if you didn't ask for it, your password stays the same.", user.FirstName, token)
+	}
+
+	return sender.Send(message)
+}
+
+// @Summary 	Verify email.
+// @Description Verify email with the token mailed on registration or email change. Login needs a verified email, a verified new email replaces the current one.
+// @Tags 		User Service
+// @Param 		body body models.VerifyEmailInput true "Body required."
+// @Produce 	json
+// @Success 	200 {object} map[string]interface{}
+// @Router 		/user/v1/verify-email [post]
+func VerifyEmail(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	var verifyEmailInput models.VerifyEmailInput
+
+	if err := c.ShouldBindJSON(&verifyEmailInput); err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusBadRequest, "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		return models.VerifyEmail(tx, verifyEmailInput.Token)
+	})
+
+	if err == models.ErrUserTokenInvalid {
+		response := utils.ResponseAPI(err.Error(), http.StatusBadRequest, "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	// New email registered by another user since it was requested
+	if models.IsUniqueViolation(err) {
+		response := utils.ResponseAPI("Email is already registered!", http.StatusConflict, "error", nil)
+		c.JSON(http.StatusConflict, response)
+		return
+	}
+
+	if err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	response := utils.ResponseAPI("Email verified!", http.StatusOK, "success", nil)
+	c.JSON(http.StatusOK, response)
+}
+
+// @Summary 	Resend verification email.
+// @Description Mail a new verification token, previous tokens can't be used anymore. Always succeeds so registered emails can't be guessed.
+// @Tags 		User Service
+// @Param 		body body models.EmailInput true "Body required."
+// @Produce 	json
+// @Success 	200 {object} map[string]interface{}
+// @Router 		/user/v1/verify-email/resend [post]
+func ResendVerificationEmail(c *gin.Context) {
+	mailUserToken(c, models.TokenEmailVerification, "Verification email sent if the email is registered and not verified yet!")
+}
+
+// @Summary 	Forgot password.
+// @Description Mail a password reset token. Always succeeds so registered emails can't be guessed.
+// @Tags 		User Service
+// @Param 		body body models.EmailInput true "Body required."
+// @Produce 	json
+// @Success 	200 {object} map[string]interface{}
+// @Router 		/user/v1/password/forgot [post]
+func ForgotPassword(c *gin.Context) {
+	mailUserToken(c, models.TokenPasswordReset, "Password reset email sent if the email is registered!")
+}
+
+func mailUserToken(c *gin.Context, purpose string, message string) {
+	db := c.MustGet("db").(*gorm.DB)
+	var emailInput models.EmailInput
+
+	if !bindInput(c, &emailInput) {
+		return
+	}
+
+	// Unknown email (or already verified one) gets the same response as a sent email
+	var user models.User
+	query := db.Where("LOWER(email) = ?", emailInput.Email)
+	if purpose == models.TokenEmailVerification {
+		query = db.Where("(LOWER(email) = ? AND email_verified_at IS NULL) OR LOWER(pending_email) = ?", emailInput.Email, emailInput.Email)
+	}
+
+	if err := query.First(&user).Error; err == nil {
+		// Verification of a new email is sent to the new email
+		if purpose == models.TokenEmailVerification && models.NormalizeEmail(user.PendingEmail) == emailInput.Email {
+			user.Email = user.PendingEmail
+		}
+
+		if err := sendUserToken(db, user, purpose); err != nil {
+			log.Printf("Mail %s token to user %d failed: %v\n", purpose, user.ID, err)
+		}
+	}
+
+	response := utils.ResponseAPI(message, http.StatusOK, "success", nil)
+	c.JSON(http.StatusOK, response)
+}
+
+// @Summary 	Reset password.
+// @Description Set a new password with the token mailed by forgot password. Token can only be used once and every session is logged out.
+// @Tags 		User Service
+// @Param 		body body models.ResetPasswordInput true "Body required."
+// @Produce 	json
+// @Success 	200 {object} map[string]interface{}
+// @Router 		/user/v1/password/reset [post]
+func ResetPassword(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	var resetPasswordInput models.ResetPasswordInput
+
+	if !bindInput(c, &resetPasswordInput) {
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		return models.ResetPassword(tx, resetPasswordInput.Token, resetPasswordInput.NewPassword)
+	})
+
+	if err == models.ErrUserTokenInvalid {
+		response := utils.ResponseAPI(err.Error(), http.StatusBadRequest, "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	if err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	response := utils.ResponseAPI("Password reset successfully, login with the new password!", http.StatusOK, "success", nil)
+	c.JSON(http.StatusOK, response)
+}
+
+// @Summary 	Unlock user (role: admin)
+// @Description Unlock an account locked by too many failed logins and forget its failed logins from every IP.
+// @Tags 		User Service
+// @Produce 	json
+// @Success 	200 {object} map[string]interface{}
+// @Router 		/auth/user/v1/users/{user_id}/unlock [post]
+// @Param 		user_id path int true "Param required."
+// @Security 	BearerToken
+func UnlockUser(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	var user models.User
+
+	if err := db.Where("id = ?", c.Param("user_id")).First(&user).Error; err != nil {
+		response := utils.ResponseAPI("User not found!", http.StatusBadRequest, "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	if err := models.ResetLoginFailures(db, user.Username); err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	response := utils.ResponseAPI("User unlocked!", http.StatusOK, "success", nil)
+	c.JSON(http.StatusOK, response)
+}
+
+// @Summary 	Get login audit of user (role: admin)
+// @Description Get the latest 100 login attempts of a user, successful or not.
+// @Tags 		User Service
+// @Produce 	json
+// @Success 	200 {object} map[string]interface{}
+// @Router 		/auth/user/v1/users/{user_id}/logins [get]
+// @Param 		user_id path int true "Param required."
+// @Security 	BearerToken
+func GetLoginAudits(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	var user models.User
+
+	if err := db.Where("id = ?", c.Param("user_id")).First(&user).Error; err != nil {
+		response := utils.ResponseAPI("User not found!", http.StatusBadRequest, "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	// Attempts with a wrong username aren't linked to the user, they are found by username
+	var audits []models.LoginAudit
+	if err := db.Where("user_id = ? OR username = ?", user.ID, models.NormalizeUsername(user.Username)).Order("id DESC").Limit(100).Find(&audits).Error; err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	var auditsResponse []models.LoginAuditResponse
+	copier.Copy(&auditsResponse, &audits)
+
+	response := utils.ResponseAPI("Get login audit success!", http.StatusOK, "success", auditsResponse)
+	c.JSON(http.StatusOK, response)
+}
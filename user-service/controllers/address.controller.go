@@ -0,0 +1,229 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/jinzhu/copier"
+	"github.com/tengkuroman/microshop/common/auth"
+	"github.com/tengkuroman/microshop/user-service/models"
+	"github.com/tengkuroman/microshop/user-service/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Respond an address book error with its status
+func addressError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch err {
+	case models.ErrAddressNotFound:
+		status = http.StatusNotFound
+	case models.ErrAddressLimit:
+		status = http.StatusConflict
+	}
+
+	response := utils.ResponseAPI(err.Error(), status, "error", nil)
+	c.JSON(status, response)
+}
+
+// :address_id of the request, responds 400 when invalid
+func addressID(c *gin.Context) (uint, bool) {
+	addressID, err := strconv.ParseUint(c.Param("address_id"), 10, 32)
+	if err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusBadRequest, "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return 0, false
+	}
+
+	return uint(addressID), true
+}
+
+// @Summary 	Get addresses.
+// @Description Get shipping addresses in the address book of the logged in user, default first.
+// @Tags 		User Service
+// @Produce 	json
+// @Success 	200 {object} map[string]interface{}
+// @Router 		/auth/user/v1/addresses [get]
+// @Security 	BearerToken
+func GetAddresses(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	var addresses []models.Address
+
+	if err := db.Where("user_id = ?", auth.UserID(c)).Order("is_default DESC, id").Find(&addresses).Error; err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	addressResponses := []models.AddressResponse{}
+	copier.Copy(&addressResponses, &addresses)
+
+	response := utils.ResponseAPI("Get addresses success!", http.StatusOK, "success", addressResponses)
+	c.JSON(http.StatusOK, response)
+}
+
+// @Summary 	Add address.
+// @Description Add a shipping address to the address book. The first address becomes default.
+// @Tags 		User Service
+// @Param 		body body models.AddressInput true "Body required."
+// @Produce 	json
+// @Success 	200 {object} map[string]interface{}
+// @Router 		/auth/user/v1/addresses [post]
+// @Security 	BearerToken
+func CreateAddress(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	var addressInput models.AddressInput
+
+	if !bindInput(c, &addressInput) {
+		return
+	}
+
+	var address models.Address
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		address, err = models.CreateAddress(tx, auth.UserID(c), addressInput)
+		return err
+	})
+
+	if err != nil {
+		addressError(c, err)
+		return
+	}
+
+	var addressResponse models.AddressResponse
+	copier.Copy(&addressResponse, &address)
+
+	response := utils.ResponseAPI("Address added successfully!", http.StatusOK, "success", addressResponse)
+	c.JSON(http.StatusOK, response)
+}
+
+// @Summary 	Update address.
+// @Description Replace a shipping address in the address book. Orders already made keep the address they were made with.
+// @Tags 		User Service
+// @Param 		address_id path int true "Param required."
+// @Param 		body body models.AddressInput true "Body required."
+// @Produce 	json
+// @Success 	200 {object} map[string]interface{}
+// @Router 		/auth/user/v1/addresses/{address_id} [put]
+// @Security 	BearerToken
+func UpdateAddress(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	var addressInput models.AddressInput
+
+	addressID, ok := addressID(c)
+	if !ok {
+		return
+	}
+
+	if !bindInput(c, &addressInput) {
+		return
+	}
+
+	var address models.Address
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		address, err = models.UpdateAddress(tx, auth.UserID(c), addressID, addressInput)
+		return err
+	})
+
+	if err != nil {
+		addressError(c, err)
+		return
+	}
+
+	var addressResponse models.AddressResponse
+	copier.Copy(&addressResponse, &address)
+
+	response := utils.ResponseAPI("Address updated successfully!", http.StatusOK, "success", addressResponse)
+	c.JSON(http.StatusOK, response)
+}
+
+// @Summary 	Set default address.
+// @Description Set the address used at checkout when none is chosen.
+// @Tags 		User Service
+// @Param 		address_id path int true "Param required."
+// @Produce 	json
+// @Success 	200 {object} map[string]interface{}
+// @Router 		/auth/user/v1/addresses/{address_id}/default [patch]
+// @Security 	BearerToken
+func SetDefaultAddress(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+
+	addressID, ok := addressID(c)
+	if !ok {
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		return models.SetDefaultAddress(tx, auth.UserID(c), addressID)
+	})
+
+	if err != nil {
+		addressError(c, err)
+		return
+	}
+
+	response := utils.ResponseAPI("Default address set successfully!", http.StatusOK, "success", nil)
+	c.JSON(http.StatusOK, response)
+}
+
+// @Summary 	Delete address.
+// @Description Delete a shipping address from the address book. When it's the default, the latest remaining address becomes default.
+// @Tags 		User Service
+// @Param 		address_id path int true "Param required."
+// @Produce 	json
+// @Success 	200 {object} map[string]interface{}
+// @Router 		/auth/user/v1/addresses/{address_id} [delete]
+// @Security 	BearerToken
+func DeleteAddress(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+
+	addressID, ok := addressID(c)
+	if !ok {
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		return models.DeleteAddress(tx, auth.UserID(c), addressID)
+	})
+
+	if err != nil {
+		addressError(c, err)
+		return
+	}
+
+	response := utils.ResponseAPI("Address deleted successfully!", http.StatusOK, "success", nil)
+	c.JSON(http.StatusOK, response)
+}
+
+// Invoked by order service to snapshot the shipping address at checkout, the default one without address_id
+func GetUserAddress(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+
+	userID, err := strconv.ParseUint(c.Param("user_id"), 10, 32)
+	if err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusBadRequest, "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	addressID, err := strconv.ParseUint(c.DefaultQuery("address_id", "0"), 10, 32)
+	if err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusBadRequest, "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	address, err := models.FindAddress(db, uint(userID), uint(addressID))
+	if err != nil {
+		addressError(c, err)
+		return
+	}
+
+	var addressResponse models.AddressResponse
+	copier.Copy(&addressResponse, &address)
+
+	response := utils.ResponseAPI("Get address success!", http.StatusOK, "success", addressResponse)
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,298 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/jinzhu/copier"
+	"github.com/tengkuroman/microshop/common/auth"
+	"github.com/tengkuroman/microshop/user-service/models"
+	"github.com/tengkuroman/microshop/user-service/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// @Summary 	Apply as seller.
+// @Description Apply to be a seller. Seller role is granted when an admin approves the application.
+// @Tags 		User Service
+// @Param 		body body models.SellerApplicationInput true "Body required."
+// @Produce 	json
+// @Success 	200 {object} map[string]interface{}
+// @Router 		/auth/user/v1/seller/apply [post]
+// @Security 	BearerToken
+func ApplySeller(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	var applicationInput models.SellerApplicationInput
+
+	if err := c.ShouldBindJSON(&applicationInput); err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusBadRequest, "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	userID := auth.UserID(c)
+
+	if auth.HasRole(c, models.RoleSeller) {
+		response := utils.ResponseAPI("Already a seller!", http.StatusBadRequest, "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	application := models.SellerApplication{
+		UserID:      userID,
+		StoreName:   applicationInput.StoreName,
+		Description: applicationInput.Description,
+		Status:      models.ApplicationPending,
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// Lock the user so only one pending application is created
+		if err := tx.Exec("SELECT id FROM users WHERE id = ? FOR UPDATE", userID).Error; err != nil {
+			return err
+		}
+
+		var pending int64
+		if err := tx.Model(&models.SellerApplication{}).Where("user_id = ? AND status = ?", userID, models.ApplicationPending).Count(&pending).Error; err != nil {
+			return err
+		}
+
+		if pending > 0 {
+			return models.ErrApplicationExists
+		}
+
+		return tx.Create(&application).Error
+	})
+
+	if err == models.ErrApplicationExists {
+		response := utils.ResponseAPI(err.Error(), http.StatusConflict, "error", nil)
+		c.JSON(http.StatusConflict, response)
+		return
+	}
+
+	if err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	var applicationResponse models.SellerApplicationResponse
+	copier.Copy(&applicationResponse, &application)
+
+	response := utils.ResponseAPI("Seller application submitted!", http.StatusOK, "success", applicationResponse)
+	c.JSON(http.StatusOK, response)
+}
+
+// @Summary 	Get seller applications (role: admin)
+// @Description Get seller applications by status, pending by default.
+// @Tags 		User Service
+// @Produce 	json
+// @Success 	200 {object} map[string]interface{}
+// @Router 		/auth/user/v1/seller/applications [get]
+// @Param 		status query string false "Available status: pending, approved, rejected"
+// @Security 	BearerToken
+func GetSellerApplications(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+
+	var applications []models.SellerApplication
+	if err := db.Where("status = ?", c.DefaultQuery("status", models.ApplicationPending)).Order("id").Find(&applications).Error; err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	var applicationsResponse []models.SellerApplicationResponse
+	copier.Copy(&applicationsResponse, &applications)
+
+	response := utils.ResponseAPI("Get seller applications success!", http.StatusOK, "success", applicationsResponse)
+	c.JSON(http.StatusOK, response)
+}
+
+// @Summary 	Review seller application (role: admin)
+// @Description Approve or reject a pending seller application. Approving grants seller role to the applicant.
+// @Tags 		User Service
+// @Param 		body body models.SellerApplicationReviewInput false "Optional note."
+// @Produce 	json
+// @Success 	200 {object} map[string]interface{}
+// @Router 		/auth/user/v1/seller/applications/{application_id}/{decision} [patch]
+// @Param 		application_id path int true "Param required."
+// @Param 		decision path string true "Available decision: approve, reject"
+// @Security 	BearerToken
+func ReviewSellerApplication(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	adminID := auth.UserID(c)
+
+	decision := c.Param("decision")
+	if decision != "approve" && decision != "reject" {
+		response := utils.ResponseAPI("Decision invalid!", http.StatusBadRequest, "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	var reviewInput models.SellerApplicationReviewInput
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&reviewInput); err != nil {
+			response := utils.ResponseAPI(err.Error(), http.StatusBadRequest, "error", nil)
+			c.JSON(http.StatusBadRequest, response)
+			return
+		}
+	}
+
+	var application models.SellerApplication
+	if err := db.Where("id = ?", c.Param("application_id")).First(&application).Error; err != nil {
+		response := utils.ResponseAPI("Seller application not found!", http.StatusBadRequest, "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		return application.Review(tx, decision == "approve", adminID, reviewInput.Note)
+	})
+
+	if err == models.ErrApplicationClosed {
+		response := utils.ResponseAPI(err.Error(), http.StatusConflict, "error", nil)
+		c.JSON(http.StatusConflict, response)
+		return
+	}
+
+	if err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	var applicationResponse models.SellerApplicationResponse
+	copier.Copy(&applicationResponse, &application)
+
+	response := utils.ResponseAPI("Seller application reviewed!", http.StatusOK, "success", applicationResponse)
+	c.JSON(http.StatusOK, response)
+}
+
+// @Summary 	Get user roles.
+// @Description Get roles and role audit of a user. Users can see their own, admins can see everyone's.
+// @Tags 		User Service
+// @Produce 	json
+// @Success 	200 {object} map[string]interface{}
+// @Router 		/auth/user/v1/roles/{user_id} [get]
+// @Param 		user_id path int true "Param required."
+// @Security 	BearerToken
+func GetUserRoles(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+
+	userID, err := strconv.ParseUint(c.Param("user_id"), 10, 32)
+	if err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusBadRequest, "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	if !auth.HasRole(c, models.RoleAdmin) && uint(userID) != auth.UserID(c) {
+		response := utils.ResponseAPI("You can only see your roles!", http.StatusForbidden, "forbidden", nil)
+		c.JSON(http.StatusForbidden, response)
+		return
+	}
+
+	roles, err := models.UserRoles(db, uint(userID))
+	if err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	var audits []models.RoleAudit
+	if err := db.Where("user_id = ?", userID).Order("id").Find(&audits).Error; err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	var auditsResponse []models.RoleAuditResponse
+	copier.Copy(&auditsResponse, &audits)
+
+	response := utils.ResponseAPI("Get user roles success!", http.StatusOK, "success", gin.H{
+		"roles": roles,
+		"audit": auditsResponse,
+	})
+	c.JSON(http.StatusOK, response)
+}
+
+// @Summary 	Grant role to user (role: admin)
+// @Description Grant role to a user. Every grant is audited.
+// @Tags 		User Service
+// @Param 		body body models.RoleInput false "Optional note."
+// @Produce 	json
+// @Success 	200 {object} map[string]interface{}
+// @Router 		/auth/user/v1/roles/{user_id}/{role} [post]
+// @Param 		user_id path int true "Param required."
+// @Param 		role path string true "Available roles: seller, admin"
+// @Security 	BearerToken
+func GrantRole(c *gin.Context) {
+	changeRole(c, true)
+}
+
+// @Summary 	Revoke role from user (role: admin)
+// @Description Revoke role from a user. User role can't be revoked and the last admin can't be revoked. Every revoke is audited, the role stays in access tokens already issued until they expire.
+// @Tags 		User Service
+// @Param 		body body models.RoleInput false "Optional note."
+// @Produce 	json
+// @Success 	200 {object} map[string]interface{}
+// @Router 		/auth/user/v1/roles/{user_id}/{role} [delete]
+// @Param 		user_id path int true "Param required."
+// @Param 		role path string true "Available roles: seller, admin"
+// @Security 	BearerToken
+func RevokeRole(c *gin.Context) {
+	changeRole(c, false)
+}
+
+func changeRole(c *gin.Context, grant bool) {
+	db := c.MustGet("db").(*gorm.DB)
+	adminID := auth.UserID(c)
+
+	var roleInput models.RoleInput
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&roleInput); err != nil {
+			response := utils.ResponseAPI(err.Error(), http.StatusBadRequest, "error", nil)
+			c.JSON(http.StatusBadRequest, response)
+			return
+		}
+	}
+
+	var user models.User
+	if err := db.Where("id = ?", c.Param("user_id")).First(&user).Error; err != nil {
+		response := utils.ResponseAPI("User not found!", http.StatusBadRequest, "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	role := c.Param("role")
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if grant {
+			return models.GrantRole(tx, user.ID, role, adminID, roleInput.Note)
+		}
+
+		return models.RevokeRole(tx, user.ID, role, adminID, roleInput.Note)
+	})
+
+	switch err {
+	case nil:
+	case models.ErrRoleInvalid, models.ErrRoleAlreadyHeld, models.ErrRoleNotHeld, models.ErrLastAdmin:
+		response := utils.ResponseAPI(err.Error(), http.StatusBadRequest, "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	default:
+		response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	roles, err := models.UserRoles(db, user.ID)
+	if err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	response := utils.ResponseAPI("User roles changed successfully!", http.StatusOK, "success", gin.H{"roles": roles})
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,160 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/tengkuroman/microshop/common/auth"
+	"github.com/tengkuroman/microshop/user-service/models"
+	"github.com/tengkuroman/microshop/user-service/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Respond a two-factor error with its status, returns false when there is no error
+func twoFactorError(c *gin.Context, err error) bool {
+	if err == nil {
+		return false
+	}
+
+	status := http.StatusInternalServerError
+	switch err {
+	case models.ErrTwoFactorCodeInvalid:
+		status = http.StatusUnauthorized
+	case models.ErrTwoFactorEnabled, models.ErrTwoFactorNotEnabled, models.ErrTwoFactorNotSetUp, models.ErrTwoFactorRequired:
+		status = http.StatusConflict
+	}
+
+	response := utils.ResponseAPI(err.Error(), status, "error", nil)
+	c.JSON(status, response)
+
+	return true
+}
+
+// @Summary 	Set up two-factor authentication.
+// @Description Generate a TOTP secret and its provisioning URI (show it as QR code) to add in an authenticator app. Two-factor authentication is on after it is enabled with a code.
+// @Tags 		User Service
+// @Produce 	json
+// @Success 	200 {object} map[string]interface{}
+// @Router 		/auth/user/v1/2fa/setup [post]
+// @Security 	BearerToken
+func SetupTwoFactor(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	var user models.User
+
+	if err := db.First(&user, auth.UserID(c)).Error; err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusBadRequest, "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	var setup models.TwoFactorSetupResponse
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		setup, err = models.SetupTwoFactor(tx, user)
+		return err
+	})
+
+	if twoFactorError(c, err) {
+		return
+	}
+
+	response := utils.ResponseAPI("Add the secret to your authenticator app, then enable two-factor authentication with a code!", http.StatusOK, "success", setup)
+	c.JSON(http.StatusOK, response)
+}
+
+// @Summary 	Enable two-factor authentication.
+// @Description Enable two-factor authentication with a code of the secret set up. Returns recovery codes, they are shown only once.
+// @Tags 		User Service
+// @Param 		body body models.TwoFactorCodeInput true "Body required."
+// @Produce 	json
+// @Success 	200 {object} map[string]interface{}
+// @Router 		/auth/user/v1/2fa/enable [post]
+// @Security 	BearerToken
+func EnableTwoFactor(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	var twoFactorCodeInput models.TwoFactorCodeInput
+
+	if !bindInput(c, &twoFactorCodeInput) {
+		return
+	}
+
+	var recoveryCodes []string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		recoveryCodes, err = models.EnableTwoFactor(tx, auth.UserID(c), twoFactorCodeInput.Code)
+		return err
+	})
+
+	if twoFactorError(c, err) {
+		return
+	}
+
+	response := utils.ResponseAPI("Two-factor authentication enabled! Keep the recovery codes safe, login again to use roles requiring it.", http.StatusOK, "success", gin.H{"recovery_codes": recoveryCodes})
+	c.JSON(http.StatusOK, response)
+}
+
+// @Summary 	Disable two-factor authentication.
+// @Description Disable two-factor authentication with a code of the authenticator app. Not allowed for roles requiring it (admin).
+// @Tags 		User Service
+// @Param 		body body models.TwoFactorCodeInput true "Body required."
+// @Produce 	json
+// @Success 	200 {object} map[string]interface{}
+// @Router 		/auth/user/v1/2fa/disable [post]
+// @Security 	BearerToken
+func DisableTwoFactor(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	var twoFactorCodeInput models.TwoFactorCodeInput
+
+	if !bindInput(c, &twoFactorCodeInput) {
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		return models.DisableTwoFactor(tx, auth.UserID(c), twoFactorCodeInput.Code)
+	})
+
+	if twoFactorError(c, err) {
+		return
+	}
+
+	response := utils.ResponseAPI("Two-factor authentication disabled!", http.StatusOK, "success", nil)
+	c.JSON(http.StatusOK, response)
+}
+
+// @Summary 	Regenerate recovery codes.
+// @Description Replace every recovery code with new ones, with a code of the authenticator app or a recovery code.
+// @Tags 		User Service
+// @Param 		body body models.TwoFactorCodeInput true "Body required."
+// @Produce 	json
+// @Success 	200 {object} map[string]interface{}
+// @Router 		/auth/user/v1/2fa/recovery-codes [post]
+// @Security 	BearerToken
+func RegenerateRecoveryCodes(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	var twoFactorCodeInput models.TwoFactorCodeInput
+
+	if !bindInput(c, &twoFactorCodeInput) {
+		return
+	}
+
+	userID := auth.UserID(c)
+
+	var recoveryCodes []string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := models.VerifyTwoFactor(tx, userID, twoFactorCodeInput.Code); err != nil {
+			return err
+		}
+
+		var err error
+		recoveryCodes, err = models.RegenerateRecoveryCodes(tx, userID)
+		return err
+	})
+
+	if twoFactorError(c, err) {
+		return
+	}
+
+	response := utils.ResponseAPI("Recovery codes regenerated! The old ones can't be used anymore.", http.StatusOK, "success", gin.H{"recovery_codes": recoveryCodes})
+	c.JSON(http.StatusOK, response)
+}
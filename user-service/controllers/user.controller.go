@@ -1,12 +1,20 @@
 package controllers
 
 import (
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"log"
 	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/tengkuroman/microshop/common/auth"
 	"github.com/tengkuroman/microshop/user-service/models"
 	"github.com/tengkuroman/microshop/user-service/utils"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
@@ -24,8 +32,41 @@ func HealthCheck(c *gin.Context) {
 	})
 }
 
+// Input normalized before validation, so e.g. an email with surrounding spaces is accepted
+type normalizer interface {
+	Normalize()
+}
+
+// Bind JSON body into input, normalize and validate it. Responds 400 with per-field errors when invalid.
+func bindInput(c *gin.Context, input interface{}) bool {
+	if err := json.NewDecoder(c.Request.Body).Decode(input); err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusBadRequest, "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return false
+	}
+
+	if n, ok := input.(normalizer); ok {
+		n.Normalize()
+	}
+
+	if err := binding.Validator.ValidateStruct(input); err != nil {
+		fieldErrors := utils.FormatValidationError(err)
+		if fieldErrors == nil {
+			response := utils.ResponseAPI(err.Error(), http.StatusBadRequest, "error", nil)
+			c.JSON(http.StatusBadRequest, response)
+			return false
+		}
+
+		response := utils.ResponseAPI("Input invalid!", http.StatusBadRequest, "error", fieldErrors)
+		c.JSON(http.StatusBadRequest, response)
+		return false
+	}
+
+	return true
+}
+
 // @Summary 	Register a user.
-// @Description Registering a user from public access.
+// @Description Registering a user from public access. A verification token is mailed to the email, login needs it verified. Address given becomes the default address of the address book, complete it there before checkout.
 // @Tags 		User Service
 // @Param 		body body models.RegisterInput true "Body to register a user."
 // @Produce 	json
@@ -35,9 +76,20 @@ func Register(c *gin.Context) {
 	db := c.MustGet("db").(*gorm.DB)
 	var registerInput models.RegisterInput
 
-	if err := c.ShouldBindJSON(&registerInput); err != nil {
-		response := utils.ResponseAPI(err.Error(), http.StatusBadRequest, "error", nil)
-		c.JSON(http.StatusBadRequest, response)
+	if !bindInput(c, &registerInput) {
+		return
+	}
+
+	taken, err := models.TakenUserFields(db, registerInput.Username, registerInput.Email, 0)
+	if err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	if len(taken) > 0 {
+		response := utils.ResponseAPI("Input invalid!", http.StatusConflict, "error", taken)
+		c.JSON(http.StatusConflict, response)
 		return
 	}
 
@@ -49,45 +101,380 @@ func Register(c *gin.Context) {
 		Password:    registerInput.Password,
 		Address:     registerInput.Address,
 		PhoneNumber: registerInput.PhoneNumber,
-		Role:        "user", // default role when registering
 	}
 
-	_, err := user.SaveUser(db)
+	// Every registered user gets user role, seller role needs an approved application.
+	// Address given starts the address book as the default address, the rest is filled in later.
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if _, err := user.SaveUser(tx); err != nil {
+			return err
+		}
+
+		if err := tx.Create(&models.UserRole{UserID: user.ID, Role: models.RoleUser}).Error; err != nil {
+			return err
+		}
+
+		if user.Address == "" {
+			return nil
+		}
+
+		_, err := models.CreateAddress(tx, user.ID, models.AddressInput{
+			Label:     "Registration",
+			Recipient: user.FirstName + " " + user.LastName,
+			Street:    user.Address,
+			Phone:     user.PhoneNumber,
+		})
+
+		return err
+	})
+	if models.IsUniqueViolation(err) {
+		response := utils.ResponseAPI("Username or email is already registered!", http.StatusConflict, "error", nil)
+		c.JSON(http.StatusConflict, response)
+		return
+	}
+
 	if err != nil {
 		response := utils.ResponseAPI(err.Error(), http.StatusBadRequest, "error", nil)
 		c.JSON(http.StatusBadRequest, response)
 		return
 	}
 
-	response := utils.ResponseAPI("Registration success!", http.StatusOK, "success", nil)
+	// User can ask for another verification email if this one fails
+	if err := sendUserToken(db, user, models.TokenEmailVerification); err != nil {
+		log.Printf("Mail verification token to user %d failed: %v\n", user.ID, err)
+	}
+
+	response := utils.ResponseAPI("Registration success! Check your email to verify it before login.", http.StatusOK, "success", nil)
 	c.JSON(http.StatusOK, response)
 }
 
 // @Summary 	Login as as user, seller, or admin.
-// @Description Logging in to get JWT token to access certain API by roles.
+// @Description Logging in to get JWT token to access certain API by roles. Failed logins slow down further attempts of the account and IP, too many lock the account for that IP for a while. With two-factor authentication enabled it returns a challenge token to finish login at /login/2fa, roles requiring two-factor authentication (admin) are only granted to sessions logged in with it.
 // @Tags 		User Service
 // @Param 		body body models.LoginInput true "Body required to login."
 // @Produce 	json
 // @Success 	200 {object} map[string]interface{}
 // @Router 		/user/v1/login [post]
 func Login(c *gin.Context) {
+	// Check account and IP aren't blocked by previous failures
+	// Check username and password
+	//		OK: start session and forget account failures (or a 2FA challenge when enabled)
+	//		Not OK: count failure on account and IP
+	// Every attempt is audited
 	db := c.MustGet("db").(*gorm.DB)
 	var loginInput models.LoginInput
 
-	if err := c.ShouldBindJSON(&loginInput); err != nil {
+	if !bindInput(c, &loginInput) {
+		return
+	}
+
+	ipAddress := c.ClientIP()
+	audit := func(userID uint, reason string) {
+		err := models.AuditLogin(db, models.LoginAudit{
+			UserID:    userID,
+			Username:  loginInput.Username,
+			IPAddress: ipAddress,
+			UserAgent: c.Request.UserAgent(),
+			Success:   reason == models.LoginSucceeded,
+			Reason:    reason,
+		})
+		if err != nil {
+			log.Println("Audit login failed:", err)
+		}
+	}
+
+	block, blocked, err := models.LoginBlocked(db, models.LoginThrottleKeys(loginInput.Username, ipAddress)...)
+	if err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	if blocked {
+		retryAfter := int(time.Until(block.Until).Seconds()) + 1
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+
+		if block.Locked {
+			audit(0, models.LoginLocked)
+			response := utils.ResponseAPI(fmt.Sprintf("Account locked for your network after too many failed logins! Try again in %d minutes or ask an admin to unlock it.", (retryAfter+59)/60), http.StatusLocked, "error", nil)
+			c.JSON(http.StatusLocked, response)
+			return
+		}
+
+		audit(0, models.LoginThrottled)
+		response := utils.ResponseAPI(fmt.Sprintf("Too many failed logins! Try again in %d seconds.", retryAfter), http.StatusTooManyRequests, "error", nil)
+		c.JSON(http.StatusTooManyRequests, response)
+		return
+	}
+
+	user, err := models.LoginCheck(loginInput.Username, loginInput.Password, db)
+	if err != nil {
+		audit(user.ID, models.LoginInvalid)
+		if err := models.RecordLoginFailure(db, loginInput.Username, ipAddress); err != nil {
+			log.Println("Record login failure failed:", err)
+		}
+
+		response := utils.ResponseAPI("Username or password is incorrect!", http.StatusUnauthorized, "unauthorized", nil)
+		c.JSON(http.StatusUnauthorized, response)
+		return
+	}
+
+	if user.SuspendedAt != nil {
+		audit(user.ID, models.LoginSuspended)
+		response := utils.ResponseAPI(models.ErrUserSuspended.Error(), http.StatusForbidden, "forbidden", nil)
+		c.JSON(http.StatusForbidden, response)
+		return
+	}
+
+	if user.PasswordResetRequired {
+		audit(user.ID, models.LoginPasswordResetRequired)
+		response := utils.ResponseAPI(models.ErrPasswordResetRequired.Error(), http.StatusForbidden, "forbidden", nil)
+		c.JSON(http.StatusForbidden, response)
+		return
+	}
+
+	if user.EmailVerifiedAt == nil {
+		audit(user.ID, models.LoginEmailNotVerified)
+		response := utils.ResponseAPI("Email not verified! Check your email or ask for another verification email.", http.StatusForbidden, "forbidden", nil)
+		c.JSON(http.StatusForbidden, response)
+		return
+	}
+
+	twoFactor, err := models.TwoFactorEnabled(db, user.ID)
+	if err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	if twoFactor {
+		challenge, err := models.StartLoginChallenge(db, user.ID)
+		if err != nil {
+			response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
+			c.JSON(http.StatusInternalServerError, response)
+			return
+		}
+
+		audit(user.ID, models.LoginTwoFactorPending)
+
+		response := utils.ResponseAPI("Enter two-factor code to finish login!", http.StatusOK, "success", challenge)
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	// Failures are forgotten after a full login, with 2FA in LoginTwoFactor
+	if err := models.ResetLoginFailures(db, loginInput.Username); err != nil {
+		log.Println("Reset login failures failed:", err)
+	}
+
+	tokens, err := models.StartSession(db, user.ID, c.Request.UserAgent(), ipAddress, false)
+	if err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	audit(user.ID, models.LoginSucceeded)
+
+	message := "Login success!"
+	if userRoles, err := models.UserRoles(db, user.ID); err == nil && len(models.SessionRoles(userRoles, false)) < len(userRoles) {
+		message = "Login success! Enable two-factor authentication and login again to use all your roles."
+	}
+
+	response := utils.ResponseAPI(message, http.StatusOK, "success", tokens)
+	c.JSON(http.StatusOK, response)
+}
+
+// @Summary 	Login second step.
+// @Description Finish login of a user with two-factor authentication, with the challenge token from login and a code of the authenticator app or a recovery code.
+// @Tags 		User Service
+// @Param 		body body models.LoginTwoFactorInput true "Body required."
+// @Produce 	json
+// @Success 	200 {object} map[string]interface{}
+// @Router 		/user/v1/login/2fa [post]
+func LoginTwoFactor(c *gin.Context) {
+	// Check challenge from the password step is pending
+	// Check account and IP aren't blocked by previous failures
+	// Check TOTP or recovery code
+	//		OK: complete challenge, start 2FA session
+	//		Not OK: count failure on account and IP
+	db := c.MustGet("db").(*gorm.DB)
+	var loginTwoFactorInput models.LoginTwoFactorInput
+
+	if !bindInput(c, &loginTwoFactorInput) {
+		return
+	}
+
+	ipAddress := c.ClientIP()
+	var user models.User
+	var block models.LoginBlock
+	blocked := false
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		challenge, err := models.FindLoginChallenge(tx, loginTwoFactorInput.ChallengeToken)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.First(&user, challenge.UserID).Error; err != nil {
+			return err
+		}
+
+		// Codes are short, guessing them is throttled like passwords
+		block, blocked, err = models.LoginBlocked(tx, models.LoginThrottleKeys(user.Username, ipAddress)...)
+		if err != nil || blocked {
+			return err
+		}
+
+		if err := models.VerifyTwoFactor(tx, user.ID, loginTwoFactorInput.Code); err != nil {
+			return err
+		}
+
+		return challenge.Complete(tx)
+	})
+
+	audit := func(reason string) {
+		err := models.AuditLogin(db, models.LoginAudit{
+			UserID:    user.ID,
+			Username:  models.NormalizeUsername(user.Username),
+			IPAddress: ipAddress,
+			UserAgent: c.Request.UserAgent(),
+			Success:   reason == models.LoginSucceeded,
+			Reason:    reason,
+		})
+		if err != nil {
+			log.Println("Audit login failed:", err)
+		}
+	}
+
+	if blocked {
+		retryAfter := int(time.Until(block.Until).Seconds()) + 1
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+
+		if block.Locked {
+			audit(models.LoginLocked)
+			response := utils.ResponseAPI(fmt.Sprintf("Account locked for your network after too many failed logins! Try again in %d minutes or ask an admin to unlock it.", (retryAfter+59)/60), http.StatusLocked, "error", nil)
+			c.JSON(http.StatusLocked, response)
+			return
+		}
+
+		audit(models.LoginThrottled)
+		response := utils.ResponseAPI(fmt.Sprintf("Too many failed logins! Try again in %d seconds.", retryAfter), http.StatusTooManyRequests, "error", nil)
+		c.JSON(http.StatusTooManyRequests, response)
+		return
+	}
+
+	if err == models.ErrTwoFactorCodeInvalid {
+		audit(models.LoginTwoFactorInvalid)
+		if err := models.RecordLoginFailure(db, user.Username, ipAddress); err != nil {
+			log.Println("Record login failure failed:", err)
+		}
+
+		response := utils.ResponseAPI(err.Error(), http.StatusUnauthorized, "unauthorized", nil)
+		c.JSON(http.StatusUnauthorized, response)
+		return
+	}
+
+	if err == models.ErrLoginChallengeExpired || err == models.ErrTwoFactorNotEnabled {
+		response := utils.ResponseAPI(models.ErrLoginChallengeExpired.Error(), http.StatusUnauthorized, "unauthorized", nil)
+		c.JSON(http.StatusUnauthorized, response)
+		return
+	}
+
+	if err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	if err := models.ResetLoginFailures(db, user.Username); err != nil {
+		log.Println("Reset login failures failed:", err)
+	}
+
+	tokens, err := models.StartSession(db, user.ID, c.Request.UserAgent(), ipAddress, true)
+	if err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	audit(models.LoginSucceeded)
+
+	response := utils.ResponseAPI("Login success!", http.StatusOK, "success", tokens)
+	c.JSON(http.StatusOK, response)
+}
+
+// @Summary 	Refresh access token.
+// @Description Exchange refresh token for a new access token and refresh token. Refresh token can only be used once, reusing it logs out the session.
+// @Tags 		User Service
+// @Param 		body body models.RefreshTokenInput true "Body required."
+// @Produce 	json
+// @Success 	200 {object} map[string]interface{}
+// @Router 		/user/v1/refresh [post]
+func RefreshToken(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	var refreshTokenInput models.RefreshTokenInput
+
+	if err := c.ShouldBindJSON(&refreshTokenInput); err != nil {
 		response := utils.ResponseAPI(err.Error(), http.StatusBadRequest, "error", nil)
 		c.JSON(http.StatusBadRequest, response)
 		return
 	}
 
-	token, err := models.LoginCheck(loginInput.Username, loginInput.Password, db)
+	tokens, err := models.RotateRefreshToken(db, refreshTokenInput.RefreshToken)
+	if err == models.ErrRefreshTokenInvalid || err == models.ErrRefreshTokenReused || err == models.ErrSessionRevoked || err == models.ErrUserNotFound {
+		response := utils.ResponseAPI(err.Error(), http.StatusUnauthorized, "unauthorized", nil)
+		c.JSON(http.StatusUnauthorized, response)
+		return
+	}
+
+	if err == models.ErrUserSuspended {
+		response := utils.ResponseAPI(err.Error(), http.StatusForbidden, "forbidden", nil)
+		c.JSON(http.StatusForbidden, response)
+		return
+	}
+
 	if err != nil {
-		response := utils.ResponseAPI("Username or password is incorrect!", http.StatusUnauthorized, "unauthorized", nil)
+		response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	response := utils.ResponseAPI("Token refreshed successfully!", http.StatusOK, "success", tokens)
+	c.JSON(http.StatusOK, response)
+}
+
+// @Summary 	Logout.
+// @Description Logout the session of the refresh token. The refresh token can't be used anymore, access tokens already issued are rejected by the API gateway.
+// @Tags 		User Service
+// @Param 		body body models.RefreshTokenInput true "Body required."
+// @Produce 	json
+// @Success 	200 {object} map[string]interface{}
+// @Router 		/user/v1/logout [post]
+func Logout(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	var refreshTokenInput models.RefreshTokenInput
+
+	if err := c.ShouldBindJSON(&refreshTokenInput); err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusBadRequest, "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	err := models.RevokeRefreshToken(db, refreshTokenInput.RefreshToken)
+	if err == models.ErrRefreshTokenInvalid {
+		response := utils.ResponseAPI(err.Error(), http.StatusUnauthorized, "unauthorized", nil)
 		c.JSON(http.StatusUnauthorized, response)
 		return
 	}
 
-	response := utils.ResponseAPI("Login success!", http.StatusOK, "success", map[string]string{"token": token})
+	if err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	response := utils.ResponseAPI("Logout success!", http.StatusOK, "success", nil)
 	c.JSON(http.StatusOK, response)
 }
 
@@ -102,15 +489,13 @@ func Login(c *gin.Context) {
 func ChangePassword(c *gin.Context) {
 	var changePasswordInput models.ChangePasswordInput
 
-	if err := c.ShouldBindJSON(&changePasswordInput); err != nil {
-		response := utils.ResponseAPI(err.Error(), http.StatusBadRequest, "error", nil)
-		c.JSON(http.StatusBadRequest, response)
+	if !bindInput(c, &changePasswordInput) {
 		return
 	}
 
 	db := c.MustGet("db").(*gorm.DB)
 	var user models.User
-	userID := c.Request.Header.Get("X-User-ID")
+	userID := auth.UserID(c)
 
 	if err := db.Where("id = ?", userID).First(&user).Error; err != nil {
 		response := utils.ResponseAPI(err.Error(), http.StatusBadRequest, "error", nil)
@@ -142,7 +527,7 @@ func ChangePassword(c *gin.Context) {
 }
 
 // @Summary 	Change user details.
-// @Description Change user detail: name, email, address, phone number.
+// @Description Change user detail: name, email, address, phone number. A new email is mailed a verification token and replaces the current email once verified, the current email stays verified and in use until then.
 // @Tags 		User Service
 // @Param 		body body models.ChangeUserDetailInput true "Body required to user detail(s)."
 // @Produce 	json
@@ -152,15 +537,13 @@ func ChangePassword(c *gin.Context) {
 func ChangeUserDetail(c *gin.Context) {
 	var changeUserDetailInput models.ChangeUserDetailInput
 
-	if err := c.ShouldBindJSON(&changeUserDetailInput); err != nil {
-		response := utils.ResponseAPI(err.Error(), http.StatusBadRequest, "error", nil)
-		c.JSON(http.StatusBadRequest, response)
+	if !bindInput(c, &changeUserDetailInput) {
 		return
 	}
 
 	db := c.MustGet("db").(*gorm.DB)
 	var user models.User
-	userID := c.Request.Header.Get("X-User-ID")
+	userID := auth.UserID(c)
 
 	if err := db.Where("id = ?", userID).First(&user).Error; err != nil {
 		response := utils.ResponseAPI(err.Error(), http.StatusBadRequest, "error", nil)
@@ -168,90 +551,133 @@ func ChangeUserDetail(c *gin.Context) {
 		return
 	}
 
-	if err := db.Model(&user).Updates(changeUserDetailInput).Error; err != nil {
+	emailChanged := changeUserDetailInput.Email != "" && changeUserDetailInput.Email != models.NormalizeEmail(user.Email)
+
+	if emailChanged {
+		taken, err := models.TakenUserFields(db, "", changeUserDetailInput.Email, user.ID)
+		if err != nil {
+			response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
+			c.JSON(http.StatusInternalServerError, response)
+			return
+		}
+
+		if len(taken) > 0 {
+			response := utils.ResponseAPI("Input invalid!", http.StatusConflict, "error", taken)
+			c.JSON(http.StatusConflict, response)
+			return
+		}
+	}
+
+	// New email is kept pending until verified, the current one stays verified meanwhile
+	newEmail := changeUserDetailInput.Email
+	changeUserDetailInput.Email = ""
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Updates(changeUserDetailInput).Error; err != nil {
+			return err
+		}
+
+		if emailChanged {
+			return tx.Model(&user).Update("pending_email", newEmail).Error
+		}
+
+		return nil
+	})
+	if models.IsUniqueViolation(err) {
+		response := utils.ResponseAPI("Email is already registered!", http.StatusConflict, "error", nil)
+		c.JSON(http.StatusConflict, response)
+		return
+	}
+
+	if err != nil {
 		response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
 		c.JSON(http.StatusInternalServerError, response)
 		return
 	}
 
-	response := utils.ResponseAPI("User details changed successfully!", http.StatusOK, "success", nil)
+	message := "User details changed successfully!"
+	if emailChanged {
+		user.Email = newEmail
+		if err := sendUserToken(db, user, models.TokenEmailVerification); err != nil {
+			log.Printf("Mail verification token to user %d failed: %v\n", user.ID, err)
+		}
+
+		message = "User details changed successfully! Check your new email to verify it, your current email is used until then."
+	}
+
+	response := utils.ResponseAPI(message, http.StatusOK, "success", nil)
 	c.JSON(http.StatusOK, response)
 }
 
-// @Summary 	Switch user role.
-// @Description Change user role. Available roles: user, seller, admin.
-// @Tags 		User Service
-// @Produce 	json
-// @Success 	200 {object} map[string]interface{}
-// @Router 		/auth/user/v1/switch/{role} [patch]
-// @Param 		role path string true "Available roles: user, seller, admin"
-// @Security 	BearerToken
-func SwitchUser(c *gin.Context) {
+// Invoked by API gateway to reject tokens of logged out sessions and suspended users before they expire,
+// services behind it verify tokens with JWKS and trust their roles
+func ValidateUser(c *gin.Context) {
 	db := c.MustGet("db").(*gorm.DB)
-	var user models.User
-	userID := c.Request.Header.Get("X-User-ID")
 
-	if err := db.Where("id = ?", userID).First(&user).Error; err != nil {
-		response := utils.ResponseAPI(err.Error(), http.StatusBadRequest, "error", nil)
-		c.JSON(http.StatusBadRequest, response)
+	claims, err := utils.ExtractPayload(c, func(kid string) (ed25519.PublicKey, error) {
+		return models.SigningPublicKey(db, kid)
+	})
+	if err != nil {
+		response := utils.ResponseAPI("Token invalid!", http.StatusUnauthorized, "unauthorized", nil)
+		c.JSON(http.StatusUnauthorized, response)
 		return
 	}
 
-	newRole := c.Param("role")
-
-	switch newRole {
-	case "user":
-	case "seller":
-	case "admin":
-	default:
-		response := utils.ResponseAPI("Role invalid!", http.StatusBadRequest, "error", nil)
-		c.JSON(http.StatusBadRequest, response)
+	userID, err := strconv.ParseUint(fmt.Sprint(claims["user_id"]), 10, 32)
+	if err != nil {
+		response := utils.ResponseAPI("Token invalid!", http.StatusUnauthorized, "unauthorized", nil)
+		c.JSON(http.StatusUnauthorized, response)
 		return
 	}
 
-	if newRole == user.Role {
-		response := utils.ResponseAPI("Already in requested role!", http.StatusBadRequest, "error", nil)
-		c.JSON(http.StatusBadRequest, response)
+	// Tokens of deleted and suspended users are rejected before they expire
+	user, err := models.ActiveUser(db, uint(userID))
+	if err == models.ErrUserNotFound || err == models.ErrUserSuspended {
+		response := utils.ResponseAPI(err.Error(), http.StatusUnauthorized, "unauthorized", nil)
+		c.JSON(http.StatusUnauthorized, response)
 		return
 	}
 
-	if err := db.Model(&user).Update("role", newRole).Error; err != nil {
-		response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
+	if err != nil {
+		response := utils.ResponseAPI("Check user ID failed!", http.StatusInternalServerError, "error", nil)
 		c.JSON(http.StatusInternalServerError, response)
 		return
 	}
 
-	response := utils.ResponseAPI("Role changed successfully!", http.StatusOK, "success", nil)
-	c.JSON(http.StatusOK, response)
-}
-
-// Invoked by API gateway
-func ValidateUser(c *gin.Context) {
-	err := utils.ValidateToken(c)
+	// Token of a logged out (revoked) session is rejected, so is a token without session
+	sessionID, _ := claims["session_id"].(float64)
+	session, err := models.CheckSession(db, uint(sessionID), user.ID)
 	if err != nil {
-		response := utils.ResponseAPI("Token invalid!", http.StatusUnauthorized, "unauthorized", nil)
+		response := utils.ResponseAPI("Session revoked!", http.StatusUnauthorized, "unauthorized", nil)
 		c.JSON(http.StatusUnauthorized, response)
 		return
 	}
 
-	claims, err := utils.ExtractPayload(c)
+	userRoles, err := models.UserRoles(db, user.ID)
 	if err != nil {
-		response := utils.ResponseAPI("Extract payload data failed!", http.StatusInternalServerError, "error", nil)
+		response := utils.ResponseAPI("Check user roles failed!", http.StatusInternalServerError, "error", nil)
 		c.JSON(http.StatusInternalServerError, response)
 		return
 	}
+	roles := models.SessionRoles(userRoles, session.TwoFactorAt != nil)
+
+	c.JSON(http.StatusOK, gin.H{
+		"user_id": user.ID,
+		"role":    models.PrimaryRole(roles),
+		"roles":   roles,
+	})
+}
 
+// Invoked by services verifying access tokens locally, they cache the keys
+func GetJWKS(c *gin.Context) {
 	db := c.MustGet("db").(*gorm.DB)
-	var user models.User
 
-	if err := db.Model(&user).Where("id = ?", claims["user_id"]).Take(&user).Error; err != nil {
-		response := utils.ResponseAPI("Check user ID failed!", http.StatusInternalServerError, "error", nil)
+	keys, err := models.PublishedSigningKeys(db)
+	if err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
 		c.JSON(http.StatusInternalServerError, response)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"user_id": user.ID,
-		"role":    user.Role,
-	})
+	c.JSON(http.StatusOK, utils.PublishedJWKS(keys))
 }
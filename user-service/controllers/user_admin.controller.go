@@ -0,0 +1,229 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/tengkuroman/microshop/common/auth"
+	"github.com/tengkuroman/microshop/user-service/models"
+	"github.com/tengkuroman/microshop/user-service/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// :user_id of an admin request, responds 400 when invalid and 403 when it's the admin themself
+func targetUserID(c *gin.Context) (uint, bool) {
+	userID, err := strconv.ParseUint(c.Param("user_id"), 10, 32)
+	if err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusBadRequest, "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return 0, false
+	}
+
+	if uint(userID) == auth.UserID(c) {
+		response := utils.ResponseAPI("You can't do this to your own account!", http.StatusForbidden, "forbidden", nil)
+		c.JSON(http.StatusForbidden, response)
+		return 0, false
+	}
+
+	return uint(userID), true
+}
+
+// Respond the result of an admin action on a user
+func userAdminResult(c *gin.Context, err error, message string) {
+	if err == models.ErrUserNotFound {
+		response := utils.ResponseAPI(err.Error(), http.StatusNotFound, "error", nil)
+		c.JSON(http.StatusNotFound, response)
+		return
+	}
+
+	if err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	response := utils.ResponseAPI(message, http.StatusOK, "success", nil)
+	c.JSON(http.StatusOK, response)
+}
+
+// @Summary 	Get users (role: admin)
+// @Description Get users, paginated. Search by username, email or name, filter by role, status and email verification. Deleted users are only listed with status deleted.
+// @Tags 		User Service
+// @Produce 	json
+// @Success 	200 {object} map[string]interface{}
+// @Router 		/auth/user/v1/users [get]
+// @Param 		page query int false "Page number, default 1."
+// @Param 		limit query int false "Users per page, default 20, max 100."
+// @Param 		q query string false "Part of username, email or name."
+// @Param 		role query string false "Filter by role."
+// @Param 		status query string false "Available status: active, suspended, deleted"
+// @Param 		verified query bool false "Filter by email verification."
+// @Param 		sort query string false "Available sort: newest, oldest, username"
+// @Security 	BearerToken
+func GetUsers(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	var query models.UserQuery
+
+	if err := c.ShouldBindQuery(&query); err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusBadRequest, "error", nil)
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	query.SetDefaults()
+
+	users, total, err := models.FindUsers(db, query)
+	if err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	usersResponse, err := models.AdminUserResponses(db, users)
+	if err != nil {
+		response := utils.ResponseAPI(err.Error(), http.StatusInternalServerError, "error", nil)
+		c.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	response := utils.PaginatedResponseAPI("Get users success!", http.StatusOK, "success", usersResponse, query.Page, query.Limit, total)
+	c.JSON(http.StatusOK, response)
+}
+
+// @Summary 	Suspend user (role: admin)
+// @Description Suspend a user: login is refused and every session is logged out, access tokens already issued are rejected by the API gateway.
+// @Tags 		User Service
+// @Param 		body body models.SuspendUserInput true "Body required."
+// @Produce 	json
+// @Success 	200 {object} map[string]interface{}
+// @Router 		/auth/user/v1/users/{user_id}/suspend [post]
+// @Param 		user_id path int true "Param required."
+// @Security 	BearerToken
+func SuspendUser(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+	var suspendUserInput models.SuspendUserInput
+
+	userID, ok := targetUserID(c)
+	if !ok {
+		return
+	}
+
+	if !bindInput(c, &suspendUserInput) {
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		return models.SuspendUser(tx, userID, suspendUserInput.Reason)
+	})
+
+	userAdminResult(c, err, "User suspended!")
+}
+
+// @Summary 	Unsuspend user (role: admin)
+// @Description Lift the suspension of a user, the user can login again.
+// @Tags 		User Service
+// @Produce 	json
+// @Success 	200 {object} map[string]interface{}
+// @Router 		/auth/user/v1/users/{user_id}/suspend [delete]
+// @Param 		user_id path int true "Param required."
+// @Security 	BearerToken
+func UnsuspendUser(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+
+	userID, ok := targetUserID(c)
+	if !ok {
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		return models.UnsuspendUser(tx, userID)
+	})
+
+	userAdminResult(c, err, "User unsuspended!")
+}
+
+// @Summary 	Force password reset (role: admin)
+// @Description Log out every session of a user and refuse login until the password is reset with the token mailed to the user.
+// @Tags 		User Service
+// @Produce 	json
+// @Success 	200 {object} map[string]interface{}
+// @Router 		/auth/user/v1/users/{user_id}/password/reset [post]
+// @Param 		user_id path int true "Param required."
+// @Security 	BearerToken
+func ForcePasswordReset(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+
+	userID, ok := targetUserID(c)
+	if !ok {
+		return
+	}
+
+	var user models.User
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := models.RequirePasswordReset(tx, userID); err != nil {
+			return err
+		}
+
+		return tx.First(&user, userID).Error
+	})
+
+	if err != nil {
+		userAdminResult(c, err, "")
+		return
+	}
+
+	if err := sendUserToken(db, user, models.TokenPasswordReset); err != nil {
+		log.Printf("Mail password reset token to user %d failed: %v\n", user.ID, err)
+	}
+
+	userAdminResult(c, nil, "Password reset required, reset token mailed to the user!")
+}
+
+// @Summary 	Delete user (role: admin)
+// @Description Soft delete a user and log out every session. The user can be restored, username and email stay taken.
+// @Tags 		User Service
+// @Produce 	json
+// @Success 	200 {object} map[string]interface{}
+// @Router 		/auth/user/v1/users/{user_id} [delete]
+// @Param 		user_id path int true "Param required."
+// @Security 	BearerToken
+func DeleteUser(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+
+	userID, ok := targetUserID(c)
+	if !ok {
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		return models.DeleteUser(tx, userID)
+	})
+
+	userAdminResult(c, err, "User deleted!")
+}
+
+// @Summary 	Restore user (role: admin)
+// @Description Restore a deleted user, the user can login again.
+// @Tags 		User Service
+// @Produce 	json
+// @Success 	200 {object} map[string]interface{}
+// @Router 		/auth/user/v1/users/{user_id}/restore [post]
+// @Param 		user_id path int true "Param required."
+// @Security 	BearerToken
+func RestoreUser(c *gin.Context) {
+	db := c.MustGet("db").(*gorm.DB)
+
+	userID, ok := targetUserID(c)
+	if !ok {
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		return models.RestoreUser(tx, userID)
+	})
+
+	userAdminResult(c, err, "User restored!")
+}
@@ -0,0 +1,66 @@
+package mailers
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Local sender for development, every email is written to a file in Dir
+type FileSender struct {
+	Dir string
+
+	mu      sync.Mutex
+	counter int
+}
+
+func (s *FileSender) Send(message Message) error {
+	if err := os.MkdirAll(s.Dir, 0o755); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.counter++
+	counter := s.counter
+	s.mu.Unlock()
+
+	name := fmt.Sprintf("%s-%d.eml", time.Now().Format("20060102150405"), counter)
+	content := fmt.Sprintf("To: %s\nSubject: %s\n\n%s\n", message.To, message.Subject, message.Body)
+
+	return os.WriteFile(filepath.Join(s.Dir, name), []byte(content), 0o644)
+}
+
+// Local sender for tests, every email is kept in memory. Not registered by default, tests register it
+// so emails of a running service can't end up in memory.
+type MemorySender struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func (s *MemorySender) Send(message Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.messages = append(s.messages, message)
+
+	return nil
+}
+
+// Messages sent so far, oldest first
+func (s *MemorySender) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Message(nil), s.messages...)
+}
+
+func init() {
+	dir := os.Getenv("MAIL_FILE_DIR")
+	if dir == "" {
+		dir = "mails"
+	}
+
+	Register("file", &FileSender{Dir: dir})
+}
@@ -0,0 +1,64 @@
+package mailers
+
+import (
+	"errors"
+	"os"
+)
+
+var (
+	ErrSenderNotFound = errors.New("Mail sender not found!")
+	ErrHeaderInvalid  = errors.New("Mail header contains line break!")
+)
+
+// Implemented by senders needing config, checked before the sender is used
+type validator interface {
+	Validate() error
+}
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string // plain text
+}
+
+// Sender delivers emails to users (SMTP server, local file, memory)
+type Sender interface {
+	Send(message Message) error
+}
+
+var registry = map[string]Sender{}
+
+// Register makes a sender available by name, MAIL_SENDER picks the one used
+func Register(name string, sender Sender) {
+	registry[name] = sender
+}
+
+func Get(name string) (Sender, error) {
+	sender, ok := registry[name]
+	if !ok {
+		return nil, ErrSenderNotFound
+	}
+
+	return sender, nil
+}
+
+// Sender configured by MAIL_SENDER, file sender when not set. Fails when the sender is missing its config.
+func Default() (Sender, error) {
+	name := os.Getenv("MAIL_SENDER")
+	if name == "" {
+		name = "file"
+	}
+
+	sender, err := Get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if v, ok := sender.(validator); ok {
+		if err := v.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	return sender, nil
+}
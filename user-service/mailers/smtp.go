@@ -0,0 +1,55 @@
+package mailers
+
+import (
+	"errors"
+	"fmt"
+	"net/smtp"
+	"os"
+	"strings"
+)
+
+// Sends through an SMTP server, authenticated when Username is set
+type SMTPSender struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+var ErrSMTPConfig = errors.New("SMTP sender needs SMTP_HOST, SMTP_PORT and MAIL_FROM!")
+
+func (s *SMTPSender) Validate() error {
+	if s.Host == "" || s.Port == "" || s.From == "" {
+		return ErrSMTPConfig
+	}
+
+	return nil
+}
+
+func (s *SMTPSender) Send(message Message) error {
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+
+	// Headers can't contain line breaks, a crafted subject or address could add headers
+	if strings.ContainsAny(message.To+message.Subject, "\r\n") {
+		return ErrHeaderInvalid
+	}
+
+	body := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nMIME-Version: 1.0\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s",
+		s.From, message.To, message.Subject, message.Body)
+
+	return smtp.SendMail(s.Host+":"+s.Port, auth, s.From, []string{message.To}, []byte(body))
+}
+
+func init() {
+	Register("smtp", &SMTPSender{
+		Host:     os.Getenv("SMTP_HOST"),
+		Port:     os.Getenv("SMTP_PORT"),
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     os.Getenv("MAIL_FROM"),
+	})
+}
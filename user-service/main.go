@@ -1,13 +1,18 @@
 package main
 
 import (
+	"flag"
 	"log"
 	"net/http"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/tengkuroman/microshop/common/auth"
 	"github.com/tengkuroman/microshop/user-service/config"
 	"github.com/tengkuroman/microshop/user-service/controllers"
+	"github.com/tengkuroman/microshop/user-service/mailers"
+	"github.com/tengkuroman/microshop/user-service/middlewares"
+	"github.com/tengkuroman/microshop/user-service/utils"
 	"golang.org/x/sync/errgroup"
 )
 
@@ -30,6 +35,13 @@ func routeNonAuth(key string, value interface{}) http.Handler {
 	// Routes (public)
 	r.POST("/register", controllers.Register)
 	r.POST("/login", controllers.Login)
+	r.POST("/login/2fa", controllers.LoginTwoFactor)
+	r.POST("/refresh", controllers.RefreshToken)
+	r.POST("/logout", controllers.Logout)
+	r.POST("/verify-email", controllers.VerifyEmail)
+	r.POST("/verify-email/resend", controllers.ResendVerificationEmail)
+	r.POST("/password/forgot", controllers.ForgotPassword)
+	r.POST("/password/reset", controllers.ResetPassword)
 
 	return r
 }
@@ -45,10 +57,38 @@ func routeAuth(key string, value interface{}) http.Handler {
 		c.Set(key, value)
 	})
 
+	// Every route needs a logged in user
+	r.Use(auth.RequireAuth())
+
 	// Routes (registered)
 	r.PATCH("/change", controllers.ChangeUserDetail)
 	r.PATCH("/change/password/", controllers.ChangePassword)
-	r.PATCH("/switch/:role", controllers.SwitchUser)
+	r.POST("/seller/apply", controllers.ApplySeller)
+	r.GET("/roles/:user_id", controllers.GetUserRoles)
+	r.POST("/2fa/setup", controllers.SetupTwoFactor)
+	r.POST("/2fa/enable", controllers.EnableTwoFactor)
+	r.POST("/2fa/disable", controllers.DisableTwoFactor)
+	r.POST("/2fa/recovery-codes", controllers.RegenerateRecoveryCodes)
+	r.GET("/addresses", controllers.GetAddresses)
+	r.POST("/addresses", controllers.CreateAddress)
+	r.PUT("/addresses/:address_id", controllers.UpdateAddress)
+	r.PATCH("/addresses/:address_id/default", controllers.SetDefaultAddress)
+	r.DELETE("/addresses/:address_id", controllers.DeleteAddress)
+
+	// Routes (admin)
+	admin := auth.RequireRole(auth.RoleAdmin)
+	r.GET("/seller/applications", admin, controllers.GetSellerApplications)
+	r.PATCH("/seller/applications/:application_id/:decision", admin, controllers.ReviewSellerApplication)
+	r.POST("/roles/:user_id/:role", admin, controllers.GrantRole)
+	r.DELETE("/roles/:user_id/:role", admin, controllers.RevokeRole)
+	r.POST("/users/:user_id/unlock", admin, controllers.UnlockUser)
+	r.GET("/users/:user_id/logins", admin, controllers.GetLoginAudits)
+	r.GET("/users", admin, controllers.GetUsers)
+	r.POST("/users/:user_id/suspend", admin, controllers.SuspendUser)
+	r.DELETE("/users/:user_id/suspend", admin, controllers.UnsuspendUser)
+	r.POST("/users/:user_id/password/reset", admin, controllers.ForcePasswordReset)
+	r.DELETE("/users/:user_id", admin, controllers.DeleteUser)
+	r.POST("/users/:user_id/restore", admin, controllers.RestoreUser)
 
 	return r
 }
@@ -67,15 +107,45 @@ func routeService(key string, value interface{}) http.Handler {
 	// Routes (API gateway)
 	r.POST("/auth/validate", controllers.ValidateUser)
 
+	// Routes (order service)
+	r.GET("/users/:user_id/address", controllers.GetUserAddress)
+
+	// Routes (services verifying access tokens)
+	r.GET("/.well-known/jwks.json", controllers.GetJWKS)
+
 	return r
 }
 
 func main() {
+	// One-time step granting the first admin, e.g. ./user-service -bootstrap-admin=1
+	bootstrapAdmin := flag.Uint("bootstrap-admin", 0, "Grant admin to this user ID when there is no admin yet, then exit")
+	flag.Parse()
+
+	// Custom validation tags of inputs
+	utils.RegisterValidations()
+
+	// Logged in users are checked against the database, not user service itself
+	auth.SetAuthenticator(middlewares.Authenticate)
+
 	// Connect database
 	db := config.ConnectDatabase()
 	databaseSQL, _ := db.DB()
 	defer databaseSQL.Close()
 
+	if *bootstrapAdmin != 0 {
+		if err := config.BootstrapAdmin(db, uint(*bootstrapAdmin)); err != nil {
+			log.Fatal("Bootstrap admin failed: ", err)
+		}
+
+		log.Printf("User %d granted admin\n", *bootstrapAdmin)
+		return
+	}
+
+	// Verification and password reset emails can't be sent without a working sender
+	if _, err := mailers.Default(); err != nil {
+		log.Fatal("Mail sender misconfigured: ", err)
+	}
+
 	serverNonAuth := &http.Server{
 		Addr:    ":8080",
 		Handler: routeNonAuth("db", db),
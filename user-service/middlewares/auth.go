@@ -0,0 +1,49 @@
+package middlewares
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"strconv"
+
+	"github.com/tengkuroman/microshop/user-service/models"
+	"github.com/tengkuroman/microshop/user-service/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Authenticate finds the logged in user and their current roles in the database, other services trust
+// the roles in the access token. Set with auth.SetAuthenticator.
+func Authenticate(c *gin.Context) (uint, []string, error) {
+	db := c.MustGet("db").(*gorm.DB)
+
+	claims, err := utils.ExtractPayload(c, func(kid string) (ed25519.PublicKey, error) {
+		return models.SigningPublicKey(db, kid)
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	userID, err := strconv.ParseUint(fmt.Sprint(claims["user_id"]), 10, 32)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	// Logged out sessions, suspended users and revoked roles are rejected right away
+	sessionID, _ := claims["session_id"].(float64)
+	session, err := models.CheckSession(db, uint(sessionID), uint(userID))
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if _, err := models.ActiveUser(db, uint(userID)); err != nil {
+		return 0, nil, err
+	}
+
+	userRoles, err := models.UserRoles(db, uint(userID))
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return uint(userID), models.SessionRoles(userRoles, session.TwoFactorAt != nil), nil
+}
@@ -0,0 +1,202 @@
+package models
+
+import (
+	"errors"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+const maxAddresses = 20
+
+var (
+	ErrAddressNotFound = errors.New("Address not found!")
+	ErrAddressLimit    = errors.New("Too many addresses, delete one first!")
+)
+
+// Shipping address in the address book of a user, orders snapshot the one chosen at checkout
+type Address struct {
+	gorm.Model
+	UserID     uint `gorm:"index"`
+	Label      string
+	Recipient  string
+	Street     string
+	City       string
+	PostalCode string
+	Country    string
+	Phone      string
+	IsDefault  bool
+}
+
+type AddressInput struct {
+	Label      string `json:"label" binding:"max=50"` // e.g. home, office
+	Recipient  string `json:"recipient" binding:"required,max=100"`
+	Street     string `json:"street" binding:"required,max=255"`
+	City       string `json:"city" binding:"required,max=100"`
+	PostalCode string `json:"postal_code" binding:"required,max=20"`
+	Country    string `json:"country" binding:"required,max=100"`
+	Phone      string `json:"phone" binding:"required,phone"`
+	IsDefault  bool   `json:"is_default"`
+}
+
+type AddressResponse struct {
+	ID         uint   `json:"id"`
+	Label      string `json:"label"`
+	Recipient  string `json:"recipient"`
+	Street     string `json:"street"`
+	City       string `json:"city"`
+	PostalCode string `json:"postal_code"`
+	Country    string `json:"country"`
+	Phone      string `json:"phone"`
+	IsDefault  bool   `json:"is_default"`
+}
+
+func (i *AddressInput) Normalize() {
+	i.Label = strings.TrimSpace(i.Label)
+	i.Recipient = strings.TrimSpace(i.Recipient)
+	i.Street = strings.TrimSpace(i.Street)
+	i.City = strings.TrimSpace(i.City)
+	i.PostalCode = strings.TrimSpace(i.PostalCode)
+	i.Country = strings.TrimSpace(i.Country)
+	i.Phone = NormalizePhoneNumber(i.Phone)
+}
+
+// Lock the user row so address book changes of a user run one at a time (single default)
+func lockAddressBook(tx *gorm.DB, userID uint) error {
+	return tx.Exec("SELECT id FROM users WHERE id = ? FOR UPDATE", userID).Error
+}
+
+// Address of the user, the default one when addressID is 0
+func FindAddress(db *gorm.DB, userID uint, addressID uint) (Address, error) {
+	var address Address
+
+	query := db.Where("user_id = ?", userID)
+	if addressID == 0 {
+		query = query.Where("is_default = ?", true)
+	} else {
+		query = query.Where("id = ?", addressID)
+	}
+
+	if err := query.First(&address).Error; err != nil {
+		return Address{}, ErrAddressNotFound
+	}
+
+	return address, nil
+}
+
+func setDefaultAddress(tx *gorm.DB, userID uint, addressID uint) error {
+	if err := tx.Model(&Address{}).Where("user_id = ? AND id <> ?", userID, addressID).Update("is_default", false).Error; err != nil {
+		return err
+	}
+
+	return tx.Model(&Address{}).Where("user_id = ? AND id = ?", userID, addressID).Update("is_default", true).Error
+}
+
+// Add an address, the first one of the user becomes default
+func CreateAddress(tx *gorm.DB, userID uint, input AddressInput) (Address, error) {
+	if err := lockAddressBook(tx, userID); err != nil {
+		return Address{}, err
+	}
+
+	var count int64
+	if err := tx.Model(&Address{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+		return Address{}, err
+	}
+
+	if count >= maxAddresses {
+		return Address{}, ErrAddressLimit
+	}
+
+	address := Address{
+		UserID:     userID,
+		Label:      input.Label,
+		Recipient:  input.Recipient,
+		Street:     input.Street,
+		City:       input.City,
+		PostalCode: input.PostalCode,
+		Country:    input.Country,
+		Phone:      input.Phone,
+	}
+	if err := tx.Create(&address).Error; err != nil {
+		return Address{}, err
+	}
+
+	if input.IsDefault || count == 0 {
+		address.IsDefault = true
+		return address, setDefaultAddress(tx, userID, address.ID)
+	}
+
+	return address, nil
+}
+
+// Replace the fields of an address. Unsetting is_default is ignored, set another address as default instead.
+func UpdateAddress(tx *gorm.DB, userID uint, addressID uint, input AddressInput) (Address, error) {
+	if err := lockAddressBook(tx, userID); err != nil {
+		return Address{}, err
+	}
+
+	address, err := FindAddress(tx, userID, addressID)
+	if err != nil {
+		return Address{}, err
+	}
+
+	address.Label = input.Label
+	address.Recipient = input.Recipient
+	address.Street = input.Street
+	address.City = input.City
+	address.PostalCode = input.PostalCode
+	address.Country = input.Country
+	address.Phone = input.Phone
+	if err := tx.Save(&address).Error; err != nil {
+		return Address{}, err
+	}
+
+	if input.IsDefault && !address.IsDefault {
+		address.IsDefault = true
+		return address, setDefaultAddress(tx, userID, address.ID)
+	}
+
+	return address, nil
+}
+
+func SetDefaultAddress(tx *gorm.DB, userID uint, addressID uint) error {
+	if err := lockAddressBook(tx, userID); err != nil {
+		return err
+	}
+
+	if _, err := FindAddress(tx, userID, addressID); err != nil {
+		return err
+	}
+
+	return setDefaultAddress(tx, userID, addressID)
+}
+
+// Delete an address, the latest remaining one becomes default when the default is deleted
+func DeleteAddress(tx *gorm.DB, userID uint, addressID uint) error {
+	if err := lockAddressBook(tx, userID); err != nil {
+		return err
+	}
+
+	address, err := FindAddress(tx, userID, addressID)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Delete(&address).Error; err != nil {
+		return err
+	}
+
+	if !address.IsDefault {
+		return nil
+	}
+
+	var next Address
+	if err := tx.Where("user_id = ?", userID).Last(&next).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	return setDefaultAddress(tx, userID, next.ID)
+}
@@ -0,0 +1,208 @@
+package models
+
+import (
+	"math"
+	"os"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Login audit reason
+const (
+	LoginSucceeded             = "success"
+	LoginInvalid               = "invalid_credentials"
+	LoginThrottled             = "throttled"
+	LoginLocked                = "locked"
+	LoginEmailNotVerified      = "email_not_verified"
+	LoginSuspended             = "suspended"
+	LoginPasswordResetRequired = "password_reset_required"
+	LoginTwoFactorPending      = "two_factor_pending" // password right, waiting for the second step
+	LoginTwoFactorInvalid      = "invalid_two_factor"
+)
+
+// Failed attempts allowed before backoff starts, per account and per IP (shared by users behind NAT)
+const (
+	accountFreeAttempts = 3
+	ipFreeAttempts      = 20
+)
+
+// Backoff doubles from loginBackoffBase on every failure, failures older than loginFailureWindow are forgotten.
+// Backoff of an account from every IP stays short, so failures from anywhere can't keep its owner out.
+const (
+	loginBackoffBase   = time.Second
+	loginBackoffMax    = 15 * time.Minute
+	accountBackoffMax  = time.Minute
+	loginFailureWindow = time.Hour
+)
+
+// Account lockout config, an account is locked for the IP address the failures come from
+var (
+	loginLockoutAttempts = os.Getenv("LOGIN_LOCKOUT_ATTEMPTS")
+	loginLockoutMinute   = os.Getenv("LOGIN_LOCKOUT_MINUTE")
+)
+
+// Consecutive failed logins of an account (username), an account from an IP address, or an IP address
+type LoginThrottle struct {
+	ID            uint   `gorm:"primarykey"`
+	Key           string `gorm:"uniqueIndex"` // user:<username>, user:<username>|ip:<address> or ip:<address>
+	Username      string `gorm:"index"`       // empty for ip:<address>
+	Failures      int
+	LastFailureAt time.Time
+	BlockedUntil  time.Time
+	Locked        bool // account lockout, lifted at BlockedUntil or by an admin
+}
+
+// Every login attempt, successful or not
+type LoginAudit struct {
+	ID        uint `gorm:"primarykey"`
+	UserID    uint `gorm:"index"` // 0 when the username doesn't exist
+	Username  string
+	IPAddress string `gorm:"index"`
+	UserAgent string
+	Success   bool
+	Reason    string
+	CreatedAt time.Time
+}
+
+type LoginAuditResponse struct {
+	Username  string    `json:"username"`
+	IPAddress string    `json:"ip_address"`
+	UserAgent string    `json:"user_agent"`
+	Success   bool      `json:"success"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Login blocked until a time, by backoff or lockout
+type LoginBlock struct {
+	Until  time.Time
+	Locked bool
+}
+
+func AccountThrottleKey(username string) string {
+	return "user:" + NormalizeUsername(username)
+}
+
+func IPThrottleKey(ipAddress string) string {
+	return "ip:" + ipAddress
+}
+
+func AccountIPThrottleKey(username string, ipAddress string) string {
+	return AccountThrottleKey(username) + "|" + IPThrottleKey(ipAddress)
+}
+
+// Keys a login of the username from the IP address is throttled by
+func LoginThrottleKeys(username string, ipAddress string) []string {
+	return []string{AccountThrottleKey(username), AccountIPThrottleKey(username, ipAddress), IPThrottleKey(ipAddress)}
+}
+
+// Block of the account or IP in effect now, the longest one when both are blocked
+func LoginBlocked(db *gorm.DB, keys ...string) (LoginBlock, bool, error) {
+	var throttles []LoginThrottle
+	if err := db.Where("key IN ? AND blocked_until > ?", keys, time.Now()).Find(&throttles).Error; err != nil {
+		return LoginBlock{}, false, err
+	}
+
+	var block LoginBlock
+	for _, throttle := range throttles {
+		if throttle.BlockedUntil.After(block.Until) {
+			block.Until = throttle.BlockedUntil
+		}
+		block.Locked = block.Locked || throttle.Locked
+	}
+
+	return block, len(throttles) > 0, nil
+}
+
+func loginBackoff(failures int, freeAttempts int, maxBackoff time.Duration) time.Duration {
+	if failures <= freeAttempts {
+		return 0
+	}
+
+	backoff := float64(loginBackoffBase) * math.Pow(2, float64(failures-freeAttempts-1))
+	if backoff > float64(maxBackoff) {
+		return maxBackoff
+	}
+
+	return time.Duration(backoff)
+}
+
+// Failed logins in a row locking an account for an IP address, 10 by default
+func lockoutAttempts() int {
+	attempts, err := strconv.Atoi(loginLockoutAttempts)
+	if err != nil || attempts <= 0 {
+		attempts = 10
+	}
+
+	return attempts
+}
+
+// How long a locked account stays locked, 30 minutes by default
+func lockoutDuration() time.Duration {
+	minutes, err := strconv.Atoi(loginLockoutMinute)
+	if err != nil || minutes <= 0 {
+		minutes = 30
+	}
+
+	return time.Duration(minutes) * time.Minute
+}
+
+// Count a failed login on the account, the account from the IP and the IP, blocking them for the backoff duration.
+// The account is locked only for the IP the failures come from, its owner can still login from elsewhere.
+func RecordLoginFailure(db *gorm.DB, username string, ipAddress string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, key := range LoginThrottleKeys(username, ipAddress) {
+			throttleUsername := NormalizeUsername(username)
+			if key == IPThrottleKey(ipAddress) {
+				throttleUsername = ""
+			}
+
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&LoginThrottle{Key: key, Username: throttleUsername}).Error; err != nil {
+				return err
+			}
+
+			var throttle LoginThrottle
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("key = ?", key).First(&throttle).Error; err != nil {
+				return err
+			}
+
+			now := time.Now()
+			if now.Sub(throttle.LastFailureAt) > loginFailureWindow {
+				throttle.Failures = 0
+			}
+
+			throttle.Failures++
+			throttle.LastFailureAt = now
+
+			switch {
+			case key == IPThrottleKey(ipAddress):
+				throttle.BlockedUntil = now.Add(loginBackoff(throttle.Failures, ipFreeAttempts, loginBackoffMax))
+			case key == AccountThrottleKey(username):
+				throttle.BlockedUntil = now.Add(loginBackoff(throttle.Failures, accountFreeAttempts, accountBackoffMax))
+			case throttle.Failures >= lockoutAttempts():
+				throttle.BlockedUntil = now.Add(lockoutDuration())
+				throttle.Locked = true
+			default:
+				throttle.BlockedUntil = now.Add(loginBackoff(throttle.Failures, accountFreeAttempts, loginBackoffMax))
+			}
+
+			if err := tx.Save(&throttle).Error; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// Forget failed logins of the account from every IP. The IP keeps its count, so one valid account doesn't reset password spraying from it.
+func ResetLoginFailures(db *gorm.DB, username string) error {
+	return db.Where("username = ? OR key = ?", NormalizeUsername(username), AccountThrottleKey(username)).Delete(&LoginThrottle{}).Error
+}
+
+func AuditLogin(db *gorm.DB, audit LoginAudit) error {
+	return db.Create(&audit).Error
+}
@@ -0,0 +1,234 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Roles, a user can hold more than one
+const (
+	RoleUser   = "user"   // every registered user
+	RoleSeller = "seller" // granted when seller application is approved
+	RoleAdmin  = "admin"  // granted by another admin only
+)
+
+// Role audit action
+const (
+	RoleGranted = "grant"
+	RoleRevoked = "revoke"
+)
+
+// Seller application status
+const (
+	ApplicationPending  = "pending"
+	ApplicationApproved = "approved"
+	ApplicationRejected = "rejected"
+)
+
+var (
+	ErrRoleInvalid       = errors.New("Role invalid!")
+	ErrRoleAlreadyHeld   = errors.New("User already has the role!")
+	ErrRoleNotHeld       = errors.New("User doesn't have the role!")
+	ErrLastAdmin         = errors.New("Can't revoke the last admin!")
+	ErrApplicationExists = errors.New("Seller application is already pending!")
+	ErrApplicationClosed = errors.New("Seller application is already reviewed!")
+)
+
+// Ordered from the most privileged, first held role is the primary role
+var roles = []string{RoleAdmin, RoleSeller, RoleUser}
+
+// Role held by a user, deleted when revoked
+type UserRole struct {
+	ID        uint   `gorm:"primarykey"`
+	UserID    uint   `gorm:"uniqueIndex:idx_user_roles_user_id_role"`
+	Role      string `gorm:"uniqueIndex:idx_user_roles_user_id_role"`
+	GrantedBy uint   // 0 when granted by the system
+	CreatedAt time.Time
+}
+
+// Every role grant and revoke
+type RoleAudit struct {
+	gorm.Model
+	UserID  uint `gorm:"index"`
+	Role    string
+	Action  string
+	ActorID uint // 0 when done by the system
+	Note    string
+}
+
+type SellerApplication struct {
+	gorm.Model
+	UserID      uint `gorm:"index"`
+	StoreName   string
+	Description string
+	Status      string `gorm:"index"`
+	ReviewedBy  uint
+	ReviewNote  string
+	ReviewedAt  *time.Time
+}
+
+type RoleInput struct {
+	Note string `json:"note"`
+}
+
+type SellerApplicationInput struct {
+	StoreName   string `json:"store_name" binding:"required"`
+	Description string `json:"description" binding:"required"`
+}
+
+type SellerApplicationReviewInput struct {
+	Note string `json:"note"`
+}
+
+type RoleAuditResponse struct {
+	Role      string    `json:"role"`
+	Action    string    `json:"action"`
+	ActorID   uint      `json:"actor_id"`
+	Note      string    `json:"note"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type SellerApplicationResponse struct {
+	ID          uint       `json:"id"`
+	UserID      uint       `json:"user_id"`
+	StoreName   string     `json:"store_name"`
+	Description string     `json:"description"`
+	Status      string     `json:"status"`
+	ReviewedBy  uint       `json:"reviewed_by"`
+	ReviewNote  string     `json:"review_note"`
+	ReviewedAt  *time.Time `json:"reviewed_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+func ValidRole(role string) bool {
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Roles held by a user, most privileged first
+func UserRoles(db *gorm.DB, userID uint) ([]string, error) {
+	var userRoles []UserRole
+	if err := db.Where("user_id = ?", userID).Find(&userRoles).Error; err != nil {
+		return nil, err
+	}
+
+	held := make(map[string]bool)
+	for _, userRole := range userRoles {
+		held[userRole.Role] = true
+	}
+
+	result := []string{}
+	for _, role := range roles {
+		if held[role] {
+			result = append(result, role)
+		}
+	}
+
+	return result, nil
+}
+
+func HasRole(db *gorm.DB, userID uint, role string) (bool, error) {
+	var count int64
+	err := db.Model(&UserRole{}).Where("user_id = ? AND role = ?", userID, role).Count(&count).Error
+
+	return count > 0, err
+}
+
+// Most privileged role, sent as X-User-Role for services checking a single role
+func PrimaryRole(userRoles []string) string {
+	if len(userRoles) == 0 {
+		return RoleUser
+	}
+
+	return userRoles[0]
+}
+
+// Grant role to a user and audit it
+func GrantRole(tx *gorm.DB, userID uint, role string, actorID uint, note string) error {
+	if !ValidRole(role) {
+		return ErrRoleInvalid
+	}
+
+	result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&UserRole{UserID: userID, Role: role, GrantedBy: actorID})
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrRoleAlreadyHeld
+	}
+
+	return tx.Create(&RoleAudit{UserID: userID, Role: role, Action: RoleGranted, ActorID: actorID, Note: note}).Error
+}
+
+// Revoke role from a user and audit it. Every user keeps the user role and there is always an admin left.
+func RevokeRole(tx *gorm.DB, userID uint, role string, actorID uint, note string) error {
+	if !ValidRole(role) || role == RoleUser {
+		return ErrRoleInvalid
+	}
+
+	if role == RoleAdmin {
+		// Lock admin rows so two admins can't revoke each other at the same time
+		var admins []UserRole
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("role = ?", RoleAdmin).Find(&admins).Error; err != nil {
+			return err
+		}
+
+		if len(admins) <= 1 {
+			return ErrLastAdmin
+		}
+	}
+
+	result := tx.Where("user_id = ? AND role = ?", userID, role).Delete(&UserRole{})
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrRoleNotHeld
+	}
+
+	return tx.Create(&RoleAudit{UserID: userID, Role: role, Action: RoleRevoked, ActorID: actorID, Note: note}).Error
+}
+
+// Approve or reject a pending seller application, approval grants seller role
+func (a *SellerApplication) Review(tx *gorm.DB, approve bool, reviewerID uint, note string) error {
+	status := ApplicationRejected
+	if approve {
+		status = ApplicationApproved
+	}
+
+	reviewedAt := time.Now()
+	result := tx.Model(a).Where("status = ?", ApplicationPending).Updates(SellerApplication{
+		Status:     status,
+		ReviewedBy: reviewerID,
+		ReviewNote: note,
+		ReviewedAt: &reviewedAt,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrApplicationClosed
+	}
+
+	if !approve {
+		return nil
+	}
+
+	err := GrantRole(tx, a.UserID, RoleSeller, reviewerID, "Seller application approved")
+	if err == ErrRoleAlreadyHeld {
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,188 @@
+package models
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/tengkuroman/microshop/user-service/utils"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrRefreshTokenInvalid = errors.New("Refresh token invalid!")
+	ErrRefreshTokenReused  = errors.New("Refresh token already used, session revoked!")
+	ErrSessionRevoked      = errors.New("Session revoked!")
+)
+
+// Login session, every refresh token rotated from the same login belongs to it (token family).
+// Revoking the session revokes the whole family and the access tokens issued for it.
+type Session struct {
+	gorm.Model
+	UserID    uint `gorm:"index"`
+	UserAgent string
+	IPAddress string
+	RevokedAt *time.Time
+	// Set when logged in with two-factor authentication, roles needing 2FA are only granted then
+	TwoFactorAt *time.Time
+}
+
+// Refresh token can be used once, using it again means it was stolen
+type RefreshToken struct {
+	gorm.Model
+	SessionID uint   `gorm:"index"`
+	TokenHash string `gorm:"uniqueIndex"`
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
+
+type RefreshTokenInput struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+type TokenResponse struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"` // access token lifespan in seconds
+}
+
+// Issue access token and a new refresh token of the session, refused to deleted and suspended users
+func issueTokens(tx *gorm.DB, session Session) (TokenResponse, error) {
+	if _, err := ActiveUser(tx, session.UserID); err != nil {
+		return TokenResponse{}, err
+	}
+
+	refreshToken, tokenHash, expiresAt, err := utils.GenerateRefreshToken()
+	if err != nil {
+		return TokenResponse{}, err
+	}
+
+	if err := tx.Create(&RefreshToken{SessionID: session.ID, TokenHash: tokenHash, ExpiresAt: expiresAt}).Error; err != nil {
+		return TokenResponse{}, err
+	}
+
+	userRoles, err := UserRoles(tx, session.UserID)
+	if err != nil {
+		return TokenResponse{}, err
+	}
+	roles := SessionRoles(userRoles, session.TwoFactorAt != nil)
+
+	key, err := CurrentSigningKey(tx)
+	if err != nil {
+		return TokenResponse{}, err
+	}
+
+	token, lifespan, err := utils.GenerateToken(key, strconv.FormatUint(uint64(session.UserID), 10), session.ID, roles)
+	if err != nil {
+		return TokenResponse{}, err
+	}
+
+	return TokenResponse{Token: token, RefreshToken: refreshToken, ExpiresIn: int(lifespan.Seconds())}, nil
+}
+
+// Start a session on login
+func StartSession(db *gorm.DB, userID uint, userAgent string, ipAddress string, twoFactor bool) (TokenResponse, error) {
+	var tokens TokenResponse
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		session := Session{UserID: userID, UserAgent: userAgent, IPAddress: ipAddress}
+		if twoFactor {
+			twoFactorAt := time.Now()
+			session.TwoFactorAt = &twoFactorAt
+		}
+		if err := tx.Create(&session).Error; err != nil {
+			return err
+		}
+
+		var err error
+		tokens, err = issueTokens(tx, session)
+
+		return err
+	})
+
+	return tokens, err
+}
+
+// Exchange a refresh token for new tokens. Reusing a rotated refresh token revokes its session.
+func RotateRefreshToken(db *gorm.DB, refreshToken string) (TokenResponse, error) {
+	var tokens TokenResponse
+	reused := false
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var token RefreshToken
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("token_hash = ?", utils.HashToken(refreshToken)).First(&token).Error; err != nil {
+			return ErrRefreshTokenInvalid
+		}
+
+		var session Session
+		if err := tx.First(&session, token.SessionID).Error; err != nil {
+			return ErrRefreshTokenInvalid
+		}
+
+		if session.RevokedAt != nil {
+			return ErrSessionRevoked
+		}
+
+		if token.UsedAt != nil {
+			reused = true
+			return revokeSession(tx, session.ID)
+		}
+
+		if time.Now().After(token.ExpiresAt) {
+			return ErrRefreshTokenInvalid
+		}
+
+		usedAt := time.Now()
+		if err := tx.Model(&token).Update("used_at", &usedAt).Error; err != nil {
+			return err
+		}
+
+		var err error
+		tokens, err = issueTokens(tx, session)
+
+		return err
+	})
+
+	if err == nil && reused {
+		return TokenResponse{}, ErrRefreshTokenReused
+	}
+
+	return tokens, err
+}
+
+func revokeSession(tx *gorm.DB, sessionID uint) error {
+	revokedAt := time.Now()
+	return tx.Model(&Session{}).Where("id = ? AND revoked_at IS NULL", sessionID).Update("revoked_at", &revokedAt).Error
+}
+
+// Revoke every session of the user, e.g. when the password is reset
+func RevokeUserSessions(tx *gorm.DB, userID uint) error {
+	revokedAt := time.Now()
+	return tx.Model(&Session{}).Where("user_id = ? AND revoked_at IS NULL", userID).Update("revoked_at", &revokedAt).Error
+}
+
+// Revoke the session (token family) of a refresh token on logout
+func RevokeRefreshToken(db *gorm.DB, refreshToken string) error {
+	var token RefreshToken
+	if err := db.Where("token_hash = ?", utils.HashToken(refreshToken)).First(&token).Error; err != nil {
+		return ErrRefreshTokenInvalid
+	}
+
+	return revokeSession(db, token.SessionID)
+}
+
+// Session of an access token, if still active
+func CheckSession(db *gorm.DB, sessionID uint, userID uint) (Session, error) {
+	var session Session
+	if err := db.Where("id = ? AND user_id = ?", sessionID, userID).First(&session).Error; err != nil {
+		return Session{}, ErrSessionRevoked
+	}
+
+	if session.RevokedAt != nil {
+		return Session{}, ErrSessionRevoked
+	}
+
+	return session, nil
+}
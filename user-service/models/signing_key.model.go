@@ -0,0 +1,140 @@
+package models
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/tengkuroman/microshop/user-service/utils"
+
+	"gorm.io/gorm"
+)
+
+// Lock key serializing signing key rotation between user service instances
+const signingKeyRotationLock = 7301
+
+var signingKeyDayLifespan = os.Getenv("SIGNING_KEY_DAY_LIFESPAN")
+
+var ErrSigningKeyNotFound = errors.New("Signing key not found!")
+
+// Ed25519 key signing access tokens. A key signs new tokens until RetireAt, then it is only
+// published in JWKS until ExpiresAt so tokens signed just before retiring can still be verified.
+type SigningKey struct {
+	gorm.Model
+	KID        string `gorm:"uniqueIndex"`
+	PrivateKey []byte
+	PublicKey  []byte
+	RetireAt   time.Time `gorm:"index"`
+	ExpiresAt  time.Time `gorm:"index"`
+}
+
+func (k SigningKey) utilsKey() utils.SigningKey {
+	return utils.SigningKey{
+		KID:        k.KID,
+		PrivateKey: ed25519.PrivateKey(k.PrivateKey),
+		PublicKey:  ed25519.PublicKey(k.PublicKey),
+	}
+}
+
+// Key signing new tokens, a new key is generated when the current one is retired
+func CurrentSigningKey(db *gorm.DB) (utils.SigningKey, error) {
+	var key SigningKey
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("retire_at > ?", time.Now()).Order("retire_at DESC").First(&key).Error
+		if err == nil {
+			return nil
+		}
+
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		// Only one instance generates the next key, the others wait and use it
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", signingKeyRotationLock).Error; err != nil {
+			return err
+		}
+
+		err = tx.Where("retire_at > ?", time.Now()).Order("retire_at DESC").First(&key).Error
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		key, err = rotateSigningKey(tx)
+
+		return err
+	})
+
+	return key.utilsKey(), err
+}
+
+func rotateSigningKey(tx *gorm.DB) (SigningKey, error) {
+	keyLifespan, err := strconv.Atoi(signingKeyDayLifespan)
+	if err != nil {
+		return SigningKey{}, err
+	}
+
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return SigningKey{}, err
+	}
+
+	kid := make([]byte, 8)
+	if _, err := rand.Read(kid); err != nil {
+		return SigningKey{}, err
+	}
+
+	tokenLifespan, err := utils.AccessTokenLifespan()
+	if err != nil {
+		return SigningKey{}, err
+	}
+
+	retireAt := time.Now().Add(time.Hour * 24 * time.Duration(keyLifespan))
+	key := SigningKey{
+		KID:        hex.EncodeToString(kid),
+		PrivateKey: privateKey,
+		PublicKey:  publicKey,
+		RetireAt:   retireAt,
+		ExpiresAt:  retireAt.Add(tokenLifespan),
+	}
+
+	if err := tx.Create(&key).Error; err != nil {
+		return SigningKey{}, err
+	}
+
+	// Tokens signed by expired keys are expired as well
+	if err := tx.Unscoped().Where("expires_at <= ?", time.Now()).Delete(&SigningKey{}).Error; err != nil {
+		return SigningKey{}, err
+	}
+
+	return key, nil
+}
+
+// Keys whose tokens may still be valid, published in JWKS
+func PublishedSigningKeys(db *gorm.DB) ([]utils.SigningKey, error) {
+	var keys []SigningKey
+	if err := db.Where("expires_at > ?", time.Now()).Order("retire_at DESC").Find(&keys).Error; err != nil {
+		return nil, err
+	}
+
+	result := []utils.SigningKey{}
+	for _, key := range keys {
+		result = append(result, key.utilsKey())
+	}
+
+	return result, nil
+}
+
+// Public key verifying tokens signed by the key ID
+func SigningPublicKey(db *gorm.DB, kid string) (ed25519.PublicKey, error) {
+	var key SigningKey
+	if err := db.Where("kid = ? AND expires_at > ?", kid, time.Now()).First(&key).Error; err != nil {
+		return nil, ErrSigningKeyNotFound
+	}
+
+	return ed25519.PublicKey(key.PublicKey), nil
+}
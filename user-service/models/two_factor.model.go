@@ -0,0 +1,316 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/tengkuroman/microshop/user-service/utils"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Issuer shown in authenticator apps
+const twoFactorIssuer = "Microshop"
+
+// Second login step has to be done within this time after the password
+const loginChallengeLifespan = 5 * time.Minute
+
+const recoveryCodeCount = 10
+
+// Roles only granted to sessions logged in with two-factor authentication, comma separated
+var twoFactorRequiredRoles = os.Getenv("TWO_FACTOR_REQUIRED_ROLES")
+
+var (
+	ErrTwoFactorEnabled      = errors.New("Two-factor authentication is already enabled!")
+	ErrTwoFactorNotEnabled   = errors.New("Two-factor authentication is not enabled!")
+	ErrTwoFactorNotSetUp     = errors.New("Two-factor authentication is not set up, set it up first!")
+	ErrTwoFactorCodeInvalid  = errors.New("Two-factor code invalid!")
+	ErrTwoFactorRequired     = errors.New("Two-factor authentication is required for your role!")
+	ErrLoginChallengeExpired = errors.New("Login challenge invalid or expired, login again!")
+)
+
+// TOTP secret of a user, 2FA is on once enabled with a valid code
+type TwoFactor struct {
+	gorm.Model
+	UserID       uint `gorm:"uniqueIndex"`
+	Secret       string
+	EnabledAt    *time.Time
+	LastUsedStep int64 // codes of this step or earlier are rejected (replay)
+}
+
+// Single-use code to login when the authenticator is lost, only its hash is stored
+type RecoveryCode struct {
+	ID       uint `gorm:"primarykey"`
+	UserID   uint `gorm:"index"`
+	CodeHash string
+	UsedAt   *time.Time
+}
+
+// Password checked, waiting for the second login step
+type LoginChallenge struct {
+	gorm.Model
+	UserID    uint   `gorm:"index"`
+	TokenHash string `gorm:"uniqueIndex"`
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
+
+type TwoFactorCodeInput struct {
+	Code string `json:"code" binding:"required"` // TOTP code, or recovery code where accepted
+}
+
+type LoginTwoFactorInput struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code" binding:"required"`
+}
+
+type TwoFactorSetupResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"` // otpauth:// URI, show it as QR code
+}
+
+type LoginChallengeResponse struct {
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	ChallengeToken    string `json:"challenge_token"`
+	ExpiresIn         int    `json:"expires_in"`
+}
+
+// Roles needing a 2FA session, from TWO_FACTOR_REQUIRED_ROLES, admin by default
+func TwoFactorRequiredRoles() []string {
+	roles := twoFactorRequiredRoles
+	if strings.TrimSpace(roles) == "" {
+		roles = RoleAdmin
+	}
+
+	var required []string
+	for _, role := range strings.Split(roles, ",") {
+		if role = strings.TrimSpace(role); role != "" {
+			required = append(required, role)
+		}
+	}
+
+	return required
+}
+
+// Roles usable by a session, roles needing 2FA are dropped when the session didn't use it
+func SessionRoles(userRoles []string, twoFactor bool) []string {
+	if twoFactor {
+		return userRoles
+	}
+
+	required := TwoFactorRequiredRoles()
+
+	result := []string{}
+	for _, role := range userRoles {
+		needsTwoFactor := false
+		for _, r := range required {
+			needsTwoFactor = needsTwoFactor || r == role
+		}
+
+		if !needsTwoFactor {
+			result = append(result, role)
+		}
+	}
+
+	return result
+}
+
+func TwoFactorEnabled(db *gorm.DB, userID uint) (bool, error) {
+	var count int64
+	err := db.Model(&TwoFactor{}).Where("user_id = ? AND enabled_at IS NOT NULL", userID).Count(&count).Error
+
+	return count > 0, err
+}
+
+// New secret to enrol, replaces a secret not enabled yet
+func SetupTwoFactor(tx *gorm.DB, user User) (TwoFactorSetupResponse, error) {
+	var twoFactor TwoFactor
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("user_id = ?", user.ID).First(&twoFactor).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return TwoFactorSetupResponse{}, err
+	}
+
+	if twoFactor.EnabledAt != nil {
+		return TwoFactorSetupResponse{}, ErrTwoFactorEnabled
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return TwoFactorSetupResponse{}, err
+	}
+
+	twoFactor.UserID = user.ID
+	twoFactor.Secret = secret
+	twoFactor.LastUsedStep = 0
+	if err := tx.Save(&twoFactor).Error; err != nil {
+		return TwoFactorSetupResponse{}, err
+	}
+
+	return TwoFactorSetupResponse{
+		Secret:          secret,
+		ProvisioningURI: utils.TOTPProvisioningURI(secret, twoFactorIssuer, user.Username),
+	}, nil
+}
+
+// Check a TOTP code of the user, a code can only be used once
+func checkTOTP(tx *gorm.DB, twoFactor *TwoFactor, code string) error {
+	step, ok := utils.ValidateTOTP(twoFactor.Secret, code, time.Now())
+	if !ok || step <= twoFactor.LastUsedStep {
+		return ErrTwoFactorCodeInvalid
+	}
+
+	twoFactor.LastUsedStep = step
+
+	return tx.Model(twoFactor).Update("last_used_step", step).Error
+}
+
+func lockedTwoFactor(tx *gorm.DB, userID uint) (TwoFactor, error) {
+	var twoFactor TwoFactor
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("user_id = ?", userID).First(&twoFactor).Error; err != nil {
+		return TwoFactor{}, ErrTwoFactorNotSetUp
+	}
+
+	return twoFactor, nil
+}
+
+// Enable 2FA with a code of the secret set up, returns recovery codes to show once
+func EnableTwoFactor(tx *gorm.DB, userID uint, code string) ([]string, error) {
+	twoFactor, err := lockedTwoFactor(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if twoFactor.EnabledAt != nil {
+		return nil, ErrTwoFactorEnabled
+	}
+
+	if err := checkTOTP(tx, &twoFactor, code); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Model(&twoFactor).Update("enabled_at", time.Now()).Error; err != nil {
+		return nil, err
+	}
+
+	return RegenerateRecoveryCodes(tx, userID)
+}
+
+// Disable 2FA with a TOTP code, not allowed for roles needing it
+func DisableTwoFactor(tx *gorm.DB, userID uint, code string) error {
+	userRoles, err := UserRoles(tx, userID)
+	if err != nil {
+		return err
+	}
+
+	if len(SessionRoles(userRoles, false)) < len(userRoles) {
+		return ErrTwoFactorRequired
+	}
+
+	twoFactor, err := lockedTwoFactor(tx, userID)
+	if err != nil || twoFactor.EnabledAt == nil {
+		return ErrTwoFactorNotEnabled
+	}
+
+	if err := checkTOTP(tx, &twoFactor, code); err != nil {
+		return err
+	}
+
+	if err := tx.Where("user_id = ?", userID).Delete(&RecoveryCode{}).Error; err != nil {
+		return err
+	}
+
+	return tx.Unscoped().Delete(&twoFactor).Error
+}
+
+// Replace every recovery code of the user, returns the new ones
+func RegenerateRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := []string{}
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+
+		code := hex.EncodeToString(b)
+		code = code[:5] + "-" + code[5:]
+		if err := tx.Create(&RecoveryCode{UserID: userID, CodeHash: utils.HashToken(code)}).Error; err != nil {
+			return nil, err
+		}
+
+		codes = append(codes, code)
+	}
+
+	return codes, nil
+}
+
+// Check a TOTP code, or a recovery code which is used up
+func VerifyTwoFactor(tx *gorm.DB, userID uint, code string) error {
+	twoFactor, err := lockedTwoFactor(tx, userID)
+	if err != nil || twoFactor.EnabledAt == nil {
+		return ErrTwoFactorNotEnabled
+	}
+
+	if err := checkTOTP(tx, &twoFactor, code); err != ErrTwoFactorCodeInvalid {
+		return err
+	}
+
+	usedAt := time.Now()
+	result := tx.Model(&RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, utils.HashToken(strings.ToLower(strings.TrimSpace(code)))).
+		Update("used_at", &usedAt)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrTwoFactorCodeInvalid
+	}
+
+	return nil
+}
+
+// Start the second login step after the password is checked
+func StartLoginChallenge(db *gorm.DB, userID uint) (LoginChallengeResponse, error) {
+	token, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return LoginChallengeResponse{}, err
+	}
+
+	challenge := LoginChallenge{UserID: userID, TokenHash: utils.HashToken(token), ExpiresAt: time.Now().Add(loginChallengeLifespan)}
+	if err := db.Create(&challenge).Error; err != nil {
+		return LoginChallengeResponse{}, err
+	}
+
+	return LoginChallengeResponse{
+		TwoFactorRequired: true,
+		ChallengeToken:    token,
+		ExpiresIn:         int(loginChallengeLifespan.Seconds()),
+	}, nil
+}
+
+// Pending challenge of the token, locked until the transaction ends
+func FindLoginChallenge(tx *gorm.DB, token string) (LoginChallenge, error) {
+	var challenge LoginChallenge
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("token_hash = ?", utils.HashToken(token)).First(&challenge).Error; err != nil {
+		return LoginChallenge{}, ErrLoginChallengeExpired
+	}
+
+	if challenge.UsedAt != nil || time.Now().After(challenge.ExpiresAt) {
+		return LoginChallenge{}, ErrLoginChallengeExpired
+	}
+
+	return challenge, nil
+}
+
+func (c *LoginChallenge) Complete(tx *gorm.DB) error {
+	return tx.Model(c).Update("used_at", time.Now()).Error
+}
@@ -1,12 +1,11 @@
 package models
 
 import (
-	"html"
-	"strconv"
+	"errors"
 	"strings"
+	"time"
 
-	"github.com/tengkuroman/microshop/user-service/utils"
-
+	"github.com/jackc/pgconn"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
@@ -20,45 +19,105 @@ type User struct {
 	Password    string
 	Address     string
 	PhoneNumber string `json:"phone_number"`
-	Role        string
+	// nil until the user opens the verification link, login needs a verified email
+	EmailVerifiedAt *time.Time
+	// New email waiting for verification, the verified email stays in use until it replaces it
+	PendingEmail string
+	// Set by an admin, a suspended user can't login and their tokens are rejected
+	SuspendedAt     *time.Time
+	SuspendedReason string
+	// Set by an admin, login is refused until the password is reset from the mailed token
+	PasswordResetRequired bool
 }
 
+var (
+	ErrUserNotFound          = errors.New("User not found!")
+	ErrUserSuspended         = errors.New("Account suspended!")
+	ErrPasswordResetRequired = errors.New("Password reset required! Check your email to reset it.")
+)
+
 type RegisterInput struct {
-	FirstName   string `json:"first_name" binding:"required"`
-	LastName    string `json:"last_name" binding:"required"`
-	Username    string `binding:"required"`
-	Email       string `binding:"required"`
-	Password    string `binding:"required"`
-	Address     string
-	PhoneNumber string `json:"phone_number"`
+	FirstName   string `json:"first_name" binding:"required,max=100"`
+	LastName    string `json:"last_name" binding:"required,max=100"`
+	Username    string `json:"username" binding:"required,username"`
+	Email       string `json:"email" binding:"required,email,max=254"`
+	Password    string `json:"password" binding:"required,password"`
+	Address     string `json:"address" binding:"max=500"`
+	PhoneNumber string `json:"phone_number" binding:"omitempty,phone"`
 }
 
 type LoginInput struct {
-	Username string `binding:"required"`
-	Password string `binding:"required"`
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
 }
 
 type ChangePasswordInput struct {
 	OldPassword string `json:"old_password" binding:"required"`
-	NewPassword string `json:"new_password" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required,password"`
 }
 
 type ChangeUserDetailInput struct {
-	FirstName   string `json:"first_name"`
-	LastName    string `json:"last_name"`
-	Email       string
-	Address     string
-	PhoneNumber string `json:"phone_number"`
+	FirstName   string `json:"first_name" binding:"max=100"`
+	LastName    string `json:"last_name" binding:"max=100"`
+	Email       string `json:"email" binding:"omitempty,email,max=254"`
+	Address     string `json:"address" binding:"max=500"`
+	PhoneNumber string `json:"phone_number" binding:"omitempty,phone"`
+}
+
+// Emails and usernames are stored lowercase and compared case-insensitively
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+func NormalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+// Spaces, dashes, dots and brackets people type in phone numbers are dropped
+func NormalizePhoneNumber(phoneNumber string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(" -.()", r) {
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(phoneNumber))
+}
+
+func (i *RegisterInput) Normalize() {
+	i.FirstName = strings.TrimSpace(i.FirstName)
+	i.LastName = strings.TrimSpace(i.LastName)
+	i.Username = NormalizeUsername(i.Username)
+	i.Email = NormalizeEmail(i.Email)
+	i.Address = strings.TrimSpace(i.Address)
+	i.PhoneNumber = NormalizePhoneNumber(i.PhoneNumber)
+}
+
+func (i *ChangeUserDetailInput) Normalize() {
+	i.FirstName = strings.TrimSpace(i.FirstName)
+	i.LastName = strings.TrimSpace(i.LastName)
+	i.Email = NormalizeEmail(i.Email)
+	i.Address = strings.TrimSpace(i.Address)
+	i.PhoneNumber = NormalizePhoneNumber(i.PhoneNumber)
+}
+
+func (i *LoginInput) Normalize() {
+	i.Username = NormalizeUsername(i.Username)
+}
+
+func HashPassword(password string) (string, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hashedPassword), err
 }
 
 func (u *User) SaveUser(db *gorm.DB) (*User, error) {
-	hashedPassword, errPassword := bcrypt.GenerateFromPassword([]byte(u.Password), bcrypt.DefaultCost)
+	hashedPassword, errPassword := HashPassword(u.Password)
 	if errPassword != nil {
 		return &User{}, errPassword
 	}
 
-	u.Password = string(hashedPassword)
-	u.Username = html.EscapeString(strings.TrimSpace(u.Username))
+	u.Password = hashedPassword
+	u.Username = NormalizeUsername(u.Username)
+	u.Email = NormalizeEmail(u.Email)
 
 	var err error = db.Create(&u).Error
 	if err != nil {
@@ -68,31 +127,80 @@ func (u *User) SaveUser(db *gorm.DB) (*User, error) {
 	return u, nil
 }
 
+// Fields of the input already used by another user, as field errors
+func TakenUserFields(db *gorm.DB, username string, email string, exceptUserID uint) (map[string]string, error) {
+	taken := make(map[string]string)
+
+	checks := []struct {
+		field  string
+		column string
+		value  string
+	}{
+		{"username", "username", username},
+		{"email", "email", email},
+	}
+
+	for _, check := range checks {
+		if check.value == "" {
+			continue
+		}
+
+		// Deleted users keep their username and email, they can be restored
+		var count int64
+		if err := db.Unscoped().Model(&User{}).Where("LOWER("+check.column+") = ? AND id <> ?", check.value, exceptUserID).Count(&count).Error; err != nil {
+			return nil, err
+		}
+
+		if count > 0 {
+			taken[check.field] = "is already registered"
+		}
+	}
+
+	return taken, nil
+}
+
+// Unique index violation, e.g. two registrations with the same email at the same time
+func IsUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
 func VerifyPassword(password, hashedPassword string) error {
 	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
 }
 
-func LoginCheck(username string, password string, db *gorm.DB) (string, error) {
+func LoginCheck(username string, password string, db *gorm.DB) (User, error) {
 	var err error
 
 	u := User{}
 
-	err = db.Model(User{}).Where("username = ?", username).Take(&u).Error
+	err = db.Model(User{}).Where("LOWER(username) = ?", NormalizeUsername(username)).Take(&u).Error
 	if err != nil {
-		return "", err
+		return User{}, err
 	}
 
+	// User is returned with a wrong password too, so the failed attempt can be audited
 	err = VerifyPassword(password, u.Password)
-	if err != nil && err == bcrypt.ErrMismatchedHashAndPassword {
-		return "", err
+	if err != nil {
+		return u, err
 	}
 
-	userID := strconv.FormatUint(uint64(u.ID), 10)
+	return u, nil
+}
 
-	token, err := utils.GenerateToken(userID)
-	if err != nil {
-		return "", err
+// User not deleted nor suspended, tokens of other users are rejected
+func ActiveUser(db *gorm.DB, userID uint) (User, error) {
+	var user User
+	if err := db.First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return User{}, ErrUserNotFound
+		}
+		return User{}, err
+	}
+
+	if user.SuspendedAt != nil {
+		return User{}, ErrUserSuspended
 	}
 
-	return token, nil
+	return user, nil
 }
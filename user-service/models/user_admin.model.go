@@ -0,0 +1,234 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultUserLimit = 20
+	MaxUserLimit     = 100
+)
+
+// User status filter of user listing
+const (
+	UserActive    = "active"
+	UserSuspended = "suspended"
+	UserDeleted   = "deleted"
+)
+
+// Sort options of user listing
+var userSorts = map[string]string{
+	"newest":   "id DESC",
+	"oldest":   "id ASC",
+	"username": "username ASC, id ASC",
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// Query params of user listing, every filter is optional
+type UserQuery struct {
+	Page     int    `form:"page" binding:"omitempty,min=1"`
+	Limit    int    `form:"limit" binding:"omitempty,min=1,max=100"`
+	Q        string `form:"q" binding:"max=100"` // part of username, email or name
+	Role     string `form:"role"`
+	Status   string `form:"status" binding:"omitempty,oneof=active suspended deleted"`
+	Verified *bool  `form:"verified"`
+	Sort     string `form:"sort" binding:"omitempty,oneof=newest oldest username"`
+}
+
+type SuspendUserInput struct {
+	Reason string `json:"reason" binding:"required,max=500"`
+}
+
+type AdminUserResponse struct {
+	ID                    uint       `json:"id"`
+	FirstName             string     `json:"first_name"`
+	LastName              string     `json:"last_name"`
+	Username              string     `json:"username"`
+	Email                 string     `json:"email"`
+	PhoneNumber           string     `json:"phone_number"`
+	Roles                 []string   `json:"roles"`
+	EmailVerifiedAt       *time.Time `json:"email_verified_at"`
+	PendingEmail          string     `json:"pending_email"`
+	SuspendedAt           *time.Time `json:"suspended_at"`
+	SuspendedReason       string     `json:"suspended_reason"`
+	PasswordResetRequired bool       `json:"password_reset_required"`
+	CreatedAt             time.Time  `json:"created_at"`
+	DeletedAt             *time.Time `json:"deleted_at"`
+}
+
+// Fill page and limit when not given
+func (q *UserQuery) SetDefaults() {
+	if q.Page == 0 {
+		q.Page = 1
+	}
+
+	if q.Limit == 0 {
+		q.Limit = DefaultUserLimit
+	}
+}
+
+func (q UserQuery) filter(db *gorm.DB) *gorm.DB {
+	// Deleted users are only listed when asked for
+	if q.Status == UserDeleted {
+		db = db.Unscoped().Where("deleted_at IS NOT NULL")
+	}
+
+	if q.Status == UserActive {
+		db = db.Where("suspended_at IS NULL")
+	}
+
+	if q.Status == UserSuspended {
+		db = db.Where("suspended_at IS NOT NULL")
+	}
+
+	if q.Q != "" {
+		pattern := "%" + likeEscaper.Replace(strings.ToLower(strings.TrimSpace(q.Q))) + "%"
+		db = db.Where("(LOWER(username) LIKE ? OR LOWER(email) LIKE ? OR LOWER(first_name || ' ' || last_name) LIKE ?)", pattern, pattern, pattern)
+	}
+
+	if q.Role != "" {
+		db = db.Where("id IN (?)", db.Session(&gorm.Session{NewDB: true}).Model(&UserRole{}).Select("user_id").Where("role = ?", q.Role))
+	}
+
+	if q.Verified != nil && *q.Verified {
+		db = db.Where("email_verified_at IS NOT NULL")
+	}
+
+	if q.Verified != nil && !*q.Verified {
+		db = db.Where("email_verified_at IS NULL")
+	}
+
+	return db
+}
+
+// Find a page of users matching the query and count all of them
+func FindUsers(db *gorm.DB, q UserQuery) ([]User, int64, error) {
+	var users []User
+	var total int64
+
+	if err := q.filter(db.Model(&User{})).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	order, ok := userSorts[q.Sort]
+	if !ok {
+		order = "id ASC"
+	}
+
+	err := q.filter(db).Order(order).Limit(q.Limit).Offset((q.Page - 1) * q.Limit).Find(&users).Error
+
+	return users, total, err
+}
+
+// Admin view of users, with their roles
+func AdminUserResponses(db *gorm.DB, users []User) ([]AdminUserResponse, error) {
+	result := []AdminUserResponse{}
+	for _, user := range users {
+		roles, err := UserRoles(db, user.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		response := AdminUserResponse{
+			ID:                    user.ID,
+			FirstName:             user.FirstName,
+			LastName:              user.LastName,
+			Username:              user.Username,
+			Email:                 user.Email,
+			PhoneNumber:           user.PhoneNumber,
+			Roles:                 roles,
+			EmailVerifiedAt:       user.EmailVerifiedAt,
+			PendingEmail:          user.PendingEmail,
+			SuspendedAt:           user.SuspendedAt,
+			SuspendedReason:       user.SuspendedReason,
+			PasswordResetRequired: user.PasswordResetRequired,
+			CreatedAt:             user.CreatedAt,
+		}
+		if user.DeletedAt.Valid {
+			response.DeletedAt = &user.DeletedAt.Time
+		}
+
+		result = append(result, response)
+	}
+
+	return result, nil
+}
+
+// Suspend a user and log out every session, tokens already issued are rejected by the API gateway
+func SuspendUser(tx *gorm.DB, userID uint, reason string) error {
+	suspendedAt := time.Now()
+	result := tx.Model(&User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"suspended_at":     &suspendedAt,
+		"suspended_reason": reason,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrUserNotFound
+	}
+
+	return RevokeUserSessions(tx, userID)
+}
+
+func UnsuspendUser(tx *gorm.DB, userID uint) error {
+	result := tx.Model(&User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"suspended_at":     nil,
+		"suspended_reason": "",
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// Refuse login until the password is reset and log out every session
+func RequirePasswordReset(tx *gorm.DB, userID uint) error {
+	result := tx.Model(&User{}).Where("id = ?", userID).Update("password_reset_required", true)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrUserNotFound
+	}
+
+	return RevokeUserSessions(tx, userID)
+}
+
+// Soft delete a user (gorm.Model DeletedAt) and log out every session, data is kept to restore it
+func DeleteUser(tx *gorm.DB, userID uint) error {
+	result := tx.Delete(&User{}, userID)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrUserNotFound
+	}
+
+	return RevokeUserSessions(tx, userID)
+}
+
+func RestoreUser(tx *gorm.DB, userID uint) error {
+	result := tx.Unscoped().Model(&User{}).Where("id = ? AND deleted_at IS NOT NULL", userID).Update("deleted_at", nil)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
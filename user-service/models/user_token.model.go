@@ -0,0 +1,177 @@
+package models
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/tengkuroman/microshop/user-service/utils"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// User token purpose
+const (
+	TokenEmailVerification = "email_verification"
+	TokenPasswordReset     = "password_reset"
+)
+
+var (
+	emailVerificationHourLifespan = os.Getenv("EMAIL_VERIFICATION_HOUR_LIFESPAN")
+	passwordResetMinuteLifespan   = os.Getenv("PASSWORD_RESET_MINUTE_LIFESPAN")
+)
+
+var ErrUserTokenInvalid = errors.New("Token invalid or expired!")
+
+// Single-use token mailed to the user, only its hash is stored.
+// Issuing a new token of the same purpose invalidates the previous ones.
+type UserToken struct {
+	gorm.Model
+	UserID    uint `gorm:"index"`
+	Purpose   string
+	Email     string // address the token was sent to, verification fails if it changed since
+	TokenHash string `gorm:"uniqueIndex"`
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
+
+type VerifyEmailInput struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type EmailInput struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ResetPasswordInput struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required,password"`
+}
+
+func (i *EmailInput) Normalize() {
+	i.Email = NormalizeEmail(i.Email)
+}
+
+func userTokenLifespan(purpose string) (time.Duration, error) {
+	if purpose == TokenPasswordReset {
+		lifespan, err := strconv.Atoi(passwordResetMinuteLifespan)
+		return time.Minute * time.Duration(lifespan), err
+	}
+
+	lifespan, err := strconv.Atoi(emailVerificationHourLifespan)
+	return time.Hour * time.Duration(lifespan), err
+}
+
+// Issue a token of the purpose for the user's current email, returns the raw token to mail
+func IssueUserToken(tx *gorm.DB, user User, purpose string) (string, error) {
+	lifespan, err := userTokenLifespan(purpose)
+	if err != nil {
+		return "", err
+	}
+
+	token, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	usedAt := time.Now()
+	if err := tx.Model(&UserToken{}).Where("user_id = ? AND purpose = ? AND used_at IS NULL", user.ID, purpose).Update("used_at", &usedAt).Error; err != nil {
+		return "", err
+	}
+
+	userToken := UserToken{
+		UserID:    user.ID,
+		Purpose:   purpose,
+		Email:     user.Email,
+		TokenHash: utils.HashToken(token),
+		ExpiresAt: time.Now().Add(lifespan),
+	}
+
+	if err := tx.Create(&userToken).Error; err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// Mark a token of the purpose used, fails when it is unknown, used or expired
+func ConsumeUserToken(tx *gorm.DB, token string, purpose string) (UserToken, error) {
+	var userToken UserToken
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("token_hash = ? AND purpose = ?", utils.HashToken(token), purpose).First(&userToken).Error; err != nil {
+		return UserToken{}, ErrUserTokenInvalid
+	}
+
+	if userToken.UsedAt != nil || time.Now().After(userToken.ExpiresAt) {
+		return UserToken{}, ErrUserTokenInvalid
+	}
+
+	usedAt := time.Now()
+	if err := tx.Model(&userToken).Update("used_at", &usedAt).Error; err != nil {
+		return UserToken{}, err
+	}
+
+	return userToken, nil
+}
+
+// Verify the email the token was sent to, unless the user changed it since.
+// A verified new email replaces the email of the user.
+func VerifyEmail(tx *gorm.DB, token string) error {
+	userToken, err := ConsumeUserToken(tx, token, TokenEmailVerification)
+	if err != nil {
+		return err
+	}
+
+	verifiedAt := time.Now()
+	result := tx.Model(&User{}).Where("id = ? AND email = ?", userToken.UserID, userToken.Email).Update("email_verified_at", &verifiedAt)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		result = tx.Model(&User{}).Where("id = ? AND pending_email = ?", userToken.UserID, userToken.Email).Updates(map[string]interface{}{
+			"email":             userToken.Email,
+			"pending_email":     "",
+			"email_verified_at": &verifiedAt,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrUserTokenInvalid
+	}
+
+	return nil
+}
+
+// Set a new password with a reset token, every session of the user is logged out
+func ResetPassword(tx *gorm.DB, token string, newPassword string) error {
+	userToken, err := ConsumeUserToken(tx, token, TokenPasswordReset)
+	if err != nil {
+		return err
+	}
+
+	hashedPassword, err := HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Model(&User{}).Where("id = ?", userToken.UserID).Updates(map[string]interface{}{
+		"password":                hashedPassword,
+		"password_reset_required": false,
+	}).Error
+	if err != nil {
+		return err
+	}
+
+	// Reset link was opened from the mailbox, so the email is verified as well
+	verifiedAt := time.Now()
+	if err := tx.Model(&User{}).Where("id = ? AND email = ? AND email_verified_at IS NULL", userToken.UserID, userToken.Email).Update("email_verified_at", &verifiedAt).Error; err != nil {
+		return err
+	}
+
+	return RevokeUserSessions(tx, userToken.UserID)
+}
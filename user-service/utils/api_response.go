@@ -1,6 +1,10 @@
 package utils
 
-import "github.com/go-playground/validator/v10"
+import (
+	"errors"
+
+	"github.com/go-playground/validator/v10"
+)
 
 type Response struct {
 	Meta Meta        `json:"meta"`
@@ -8,9 +12,17 @@ type Response struct {
 }
 
 type Meta struct {
-	Message string `json:"message"`
-	Code    int    `json:"code"`
-	Status  string `json:"status"`
+	Message    string      `json:"message"`
+	Code       int         `json:"code"`
+	Status     string      `json:"status"`
+	Pagination *Pagination `json:"pagination,omitempty"`
+}
+
+type Pagination struct {
+	Page       int   `json:"page"`
+	Limit      int   `json:"limit"`
+	Total      int64 `json:"total"`
+	TotalPages int   `json:"total_pages"`
 }
 
 func ResponseAPI(message string, code int, status string, data interface{}) Response {
@@ -28,12 +40,35 @@ func ResponseAPI(message string, code int, status string, data interface{}) Resp
 	return response
 }
 
-func FormatValidationError(err error) []string {
-	var errors []string
+// ResponseAPI with pagination of listed data in meta
+func PaginatedResponseAPI(message string, code int, status string, data interface{}, page int, limit int, total int64) Response {
+	response := ResponseAPI(message, code, status, data)
+	response.Meta.Pagination = &Pagination{
+		Page:       page,
+		Limit:      limit,
+		Total:      total,
+		TotalPages: int((total + int64(limit) - 1) / int64(limit)),
+	}
+
+	return response
+}
+
+// Message of every invalid field keyed by its JSON name, nil when err is not a validation error
+func FormatValidationError(err error) map[string]string {
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		return nil
+	}
+
+	fieldErrors := make(map[string]string)
+	for _, e := range validationErrors {
+		message, ok := validationMessages[e.Tag()]
+		if !ok {
+			message = "is invalid"
+		}
 
-	for _, e := range err.(validator.ValidationErrors) {
-		errors = append(errors, e.Error())
+		fieldErrors[e.Field()] = message
 	}
 
-	return errors
+	return fieldErrors
 }
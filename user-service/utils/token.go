@@ -1,6 +1,12 @@
 package utils
 
 import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"os"
 	"strconv"
@@ -12,38 +18,113 @@ import (
 )
 
 var (
-	secret            = os.Getenv("API_SECRET")
-	tokenHourLifespan = os.Getenv("TOKEN_HOUR_LIFESPAN")
+	accessTokenMinuteLifespan = os.Getenv("ACCESS_TOKEN_MINUTE_LIFESPAN")
+	refreshTokenHourLifespan  = os.Getenv("REFRESH_TOKEN_HOUR_LIFESPAN")
 )
 
-func GenerateToken(userID interface{}) (string, error) {
-	tokenLifespan, err := strconv.Atoi(tokenHourLifespan)
+// Issuer of access tokens, checked by every service verifying them
+const tokenIssuer = "user-service"
+
+// Ed25519 key signing access tokens, identified by KID in the token header
+type SigningKey struct {
+	KID        string
+	PrivateKey ed25519.PrivateKey
+	PublicKey  ed25519.PublicKey
+}
+
+// Public key verifying tokens of the key ID, see PublishedJWKS
+type PublicKeyFunc func(kid string) (ed25519.PublicKey, error)
+
+// JSON Web Key (RFC 8037) of an Ed25519 public key
+type JWK struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+func AccessTokenLifespan() (time.Duration, error) {
+	tokenLifespan, err := strconv.Atoi(accessTokenMinuteLifespan)
 	if err != nil {
-		return "", err
+		return 0, err
+	}
+
+	return time.Minute * time.Duration(tokenLifespan), nil
+}
+
+// Short lived access token, bound to the login session it was issued for. Roles are included so
+// services authorize with the token alone, role changes apply on the next refresh.
+func GenerateToken(key SigningKey, userID interface{}, sessionID uint, roles []string) (string, time.Duration, error) {
+	lifespan, err := AccessTokenLifespan()
+	if err != nil {
+		return "", 0, err
 	}
 
 	claims := jwt.MapClaims{}
+	claims["iss"] = tokenIssuer
 	claims["user_id"] = userID
-	claims["exp"] = time.Now().Add(time.Hour * time.Duration(tokenLifespan)).Unix()
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	claims["session_id"] = sessionID
+	claims["roles"] = roles
+	claims["iat"] = time.Now().Unix()
+	claims["exp"] = time.Now().Add(lifespan).Unix()
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	token.Header["kid"] = key.KID
+
+	signed, err := token.SignedString(key.PrivateKey)
 
-	return token.SignedString([]byte(secret))
+	return signed, lifespan, err
 }
 
-func ValidateToken(c *gin.Context) error {
-	tokenString := ExtractToken(c)
-	_, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(secret), nil
-	})
+func PublishedJWKS(keys []SigningKey) JWKSet {
+	jwks := JWKSet{Keys: []JWK{}}
+	for _, key := range keys {
+		jwks.Keys = append(jwks.Keys, JWK{
+			Kty: "OKP",
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(key.PublicKey),
+			Kid: key.KID,
+			Alg: jwt.SigningMethodEdDSA.Alg(),
+			Use: "sig",
+		})
+	}
+
+	return jwks
+}
+
+// Opaque refresh token, only its hash is stored
+func GenerateRefreshToken() (string, string, time.Time, error) {
+	tokenLifespan, err := strconv.Atoi(refreshTokenHourLifespan)
+	if err != nil {
+		return "", "", time.Time{}, err
+	}
 
+	token, err := GenerateOpaqueToken()
 	if err != nil {
-		return err
+		return "", "", time.Time{}, err
 	}
 
-	return nil
+	return token, HashToken(token), time.Now().Add(time.Hour * time.Duration(tokenLifespan)), nil
+}
+
+// Random URL safe token, stored hashed (see HashToken)
+func GenerateOpaqueToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func HashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
 }
 
 func ExtractToken(c *gin.Context) string {
@@ -61,13 +142,16 @@ func ExtractToken(c *gin.Context) string {
 	return ""
 }
 
-func ExtractPayload(c *gin.Context) (map[string]interface{}, error) {
+// Verify the token and return its claims
+func ExtractPayload(c *gin.Context, publicKey PublicKeyFunc) (jwt.MapClaims, error) {
 	tokenString := ExtractToken(c)
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		if token.Method != jwt.SigningMethodEdDSA {
 			return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
 		}
-		return []byte(secret), nil
+
+		kid, _ := token.Header["kid"].(string)
+		return publicKey(kid)
 	})
 
 	if err != nil {
@@ -75,9 +159,9 @@ func ExtractPayload(c *gin.Context) (map[string]interface{}, error) {
 	}
 
 	claims, ok := token.Claims.(jwt.MapClaims)
-	if ok && token.Valid {
-		return claims, nil
+	if !ok || !token.Valid || !claims.VerifyIssuer(tokenIssuer, true) {
+		return nil, errors.New("Token invalid!")
 	}
 
-	return nil, nil
+	return claims, nil
 }
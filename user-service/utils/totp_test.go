@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// Secret of the RFC 6238 test vectors ("12345678901234567890")
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestValidateTOTP(t *testing.T) {
+	tests := []struct {
+		name     string
+		secret   string
+		code     string
+		now      int64
+		wantStep int64
+		wantOK   bool
+	}{
+		// RFC 6238 appendix B (SHA1), last 6 digits
+		{"rfc vector 59", rfcSecret, "287082", 59, 1, true},
+		{"rfc vector 1111111109", rfcSecret, "081804", 1111111109, 37037036, true},
+		{"rfc vector 1111111111", rfcSecret, "050471", 1111111111, 37037037, true},
+		{"rfc vector 1234567890", rfcSecret, "005924", 1234567890, 41152263, true},
+		{"rfc vector 2000000000", rfcSecret, "279037", 2000000000, 66666666, true},
+		{"rfc vector 20000000000", rfcSecret, "353130", 20000000000, 666666666, true},
+
+		// Clock drift of one step either way is accepted
+		{"code of previous step", rfcSecret, "081804", 1111111109 + 30, 37037036, true},
+		{"code of next step", rfcSecret, "081804", 1111111109 - 30, 37037036, true},
+		{"code two steps old", rfcSecret, "081804", 1111111109 + 60, 0, false},
+		{"code two steps ahead", rfcSecret, "081804", 1111111109 - 60, 0, false},
+
+		{"lowercase secret", strings.ToLower(rfcSecret), "287082", 59, 1, true},
+		{"code with spaces", rfcSecret, "287 082", 59, 1, true},
+		{"wrong code", rfcSecret, "287083", 59, 0, false},
+		{"empty code", rfcSecret, "", 59, 0, false},
+		{"code without leading zero", rfcSecret, "5924", 1234567890, 0, false},
+		{"invalid secret", "not base32!", "287082", 59, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := ValidateTOTP(tt.secret, tt.code, time.Unix(tt.now, 0))
+			if ok != tt.wantOK || step != tt.wantStep {
+				t.Errorf("ValidateTOTP(%q, %q, %d) = %d, %v, want %d, %v", tt.secret, tt.code, tt.now, step, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil || len(key) != 20 {
+		t.Fatalf("secret %q decodes to %d bytes (%v), want 20", secret, len(key), err)
+	}
+
+	now := time.Now()
+	code := totpCode(key, now.Unix()/totpPeriod)
+	if _, ok := ValidateTOTP(secret, code, now); !ok {
+		t.Errorf("code %s of generated secret %s is not valid", code, secret)
+	}
+}
@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+var (
+	usernamePattern    = regexp.MustCompile(`^[a-z0-9_.]{3,30}$`)
+	phoneNumberPattern = regexp.MustCompile(`^\+?[0-9]{8,15}$`)
+)
+
+// Message of every validation tag, used by FormatValidationError
+var validationMessages = map[string]string{
+	"required": "is required",
+	"email":    "must be a valid email",
+	"username": "must be 3-30 letters, numbers, dots or underscores",
+	"password": "must be 8-72 characters with at least a letter and a number",
+	"phone":    "must be a valid phone number, 8-15 digits with optional leading +",
+	"max":      "is too long",
+}
+
+// Register custom validation tags on gin binding, called once on startup
+func RegisterValidations() {
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return
+	}
+
+	// Errors are reported with JSON field names
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+		if name == "" || name == "-" {
+			return field.Name
+		}
+
+		return name
+	})
+
+	v.RegisterValidation("username", func(fl validator.FieldLevel) bool {
+		return usernamePattern.MatchString(fl.Field().String())
+	})
+
+	v.RegisterValidation("phone", func(fl validator.FieldLevel) bool {
+		return phoneNumberPattern.MatchString(fl.Field().String())
+	})
+
+	// bcrypt only uses the first 72 bytes
+	v.RegisterValidation("password", func(fl validator.FieldLevel) bool {
+		password := fl.Field().String()
+		if len(password) < 8 || len(password) > 72 {
+			return false
+		}
+
+		hasLetter, hasNumber := false, false
+		for _, r := range password {
+			hasLetter = hasLetter || unicode.IsLetter(r)
+			hasNumber = hasNumber || unicode.IsDigit(r)
+		}
+
+		return hasLetter && hasNumber
+	})
+}